@@ -0,0 +1,283 @@
+/*
+offline-bundle creates, signs and finalizes offline signing bundles through the daemon API.
+
+The online machine exports an unsigned bundle, the air-gapped signing station signs it with its
+hardware wallet and the online machine finalizes the signed bundle and broadcasts the transaction.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/therealssj/testingdep2/src/bundle"
+)
+
+const defaultDaemon = "http://127.0.0.1:9510"
+
+const usage = `Usage: %s <command> [flags] <file>
+
+Commands:
+  export    create an unsigned bundle from an export request file, on the online machine
+  sign      sign an unsigned bundle with the hardware wallet, on the signing station
+  inspect   verify a bundle and print its transaction
+  finalize  verify a signed bundle and print its raw transaction, broadcast it with -broadcast
+
+Run %s <command> -h for the flags of a command.
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0], os.Args[0])
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	commands := map[string]func([]string) error{
+		"export":   export,
+		"sign":     sign,
+		"inspect":  inspect,
+		"finalize": finalize,
+	}
+
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := command(flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet returns the flags of a command taking a single file argument
+func newFlagSet(name, file string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [flags] <%s>\n", os.Args[0], name, file)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of a command and returns its file argument
+func parse(fs *flag.FlagSet, args []string) string {
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return fs.Arg(0)
+}
+
+func export(args []string) error {
+	fs := newFlagSet("export", "export request file")
+	daemon := fs.String("daemon", defaultDaemon, "daemon URL")
+	output := fs.String("o", "", "unsigned bundle file, stdout if empty")
+	path := parse(fs, args)
+
+	req, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := post(*daemon+"/api/v1/bundle/export", req)
+	if err != nil {
+		return err
+	}
+
+	b, err := bundle.Read(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	return writeBundle(b, *output)
+}
+
+func sign(args []string) error {
+	fs := newFlagSet("sign", "unsigned bundle file")
+	daemon := fs.String("daemon", defaultDaemon, "daemon URL")
+	emulator := fs.Bool("emulator", false, "sign with the emulator instead of the usb device")
+	output := fs.String("o", "", "signed bundle file, stdout if empty")
+	path := parse(fs, args)
+
+	b, err := bundle.Load(path)
+	if err != nil {
+		return err
+	}
+	if b.Signed() {
+		return bundle.ErrSigned
+	}
+
+	var buf bytes.Buffer
+	if err := b.Write(&buf); err != nil {
+		return err
+	}
+
+	endpoint := "/api/v1/bundle/sign"
+	if *emulator {
+		endpoint = "/api/v1/emulator/bundle/sign"
+	}
+
+	data, err := post(*daemon+endpoint, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	signed, err := bundle.Read(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	return writeBundle(signed, *output)
+}
+
+func inspect(args []string) error {
+	fs := newFlagSet("inspect", "bundle file")
+	path := parse(fs, args)
+
+	b, err := bundle.Load(path)
+	if err != nil {
+		return err
+	}
+
+	txn, err := b.Transaction()
+	if err != nil {
+		return err
+	}
+
+	state := "unsigned"
+	if b.Signed() {
+		state = "signed, signatures verified"
+	}
+
+	fmt.Printf("bundle version %d created at %s, %s\n", b.Version, b.CreatedAt, state)
+	for k, v := range b.Metadata {
+		fmt.Printf("%s: %s\n", k, v)
+	}
+
+	var inputHours, outputHours uint64
+	fmt.Println("inputs:")
+	for _, in := range b.Inputs {
+		fmt.Printf("  %s  %s (index %d)  %s coins  %d hours\n", in.Hash, in.Address, in.AddressIndex, coins(in.Coins.Value()), in.Hours)
+		inputHours += in.Hours.Value()
+	}
+	fmt.Println("outputs:")
+	for _, o := range b.Outputs {
+		change := ""
+		if o.AddressIndex != nil {
+			change = fmt.Sprintf(" (change, index %d)", *o.AddressIndex)
+		}
+		fmt.Printf("  %s%s  %s coins  %d hours\n", o.Address, change, coins(o.Coins.Value()), o.Hours)
+		outputHours += o.Hours.Value()
+	}
+	// Transaction rejects bundles whose outputs hold more hours than their inputs
+	fmt.Printf("fee: %d hours\n", inputHours-outputHours)
+	fmt.Printf("inner hash: %s\n", txn.InnerHash.Hex())
+
+	return nil
+}
+
+// coins formats droplets as a decimal number of coins
+func coins(droplets uint64) string {
+	s, err := droplet.ToString(droplets)
+	if err != nil {
+		return fmt.Sprintf("%d droplets", droplets)
+	}
+	return s
+}
+
+func finalize(args []string) error {
+	fs := newFlagSet("finalize", "signed bundle file")
+	daemon := fs.String("daemon", defaultDaemon, "daemon URL")
+	broadcast := fs.Bool("broadcast", false, "broadcast the transaction through the daemon's skycoin node")
+	path := parse(fs, args)
+
+	b, err := bundle.Load(path)
+	if err != nil {
+		return err
+	}
+
+	txn, err := b.Finalize()
+	if err != nil {
+		return err
+	}
+
+	if *broadcast {
+		var buf bytes.Buffer
+		if err := b.Write(&buf); err != nil {
+			return err
+		}
+		if _, err := post(*daemon+"/api/v1/bundle/import?broadcast=true", buf.Bytes()); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "transaction %s broadcast\n", txn.Hash().Hex())
+	}
+
+	fmt.Println(hex.EncodeToString(txn.Serialize()))
+	return nil
+}
+
+// post sends a JSON body to the daemon and returns the data of its response
+func post(url string, body []byte) (json.RawMessage, error) {
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var r struct {
+		Data  json.RawMessage `json:"data"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("invalid daemon response with status %s: %v", resp.Status, err)
+	}
+	if r.Error != nil {
+		return nil, fmt.Errorf("daemon returned %d: %s", r.Error.Code, r.Error.Message)
+	}
+
+	// the device answers a locked request with the name of the message it expects
+	var firmwareRequest string
+	if json.Unmarshal(r.Data, &firmwareRequest) == nil {
+		return nil, fmt.Errorf("device answered %s, unlock it and sign again", strings.TrimSpace(firmwareRequest))
+	}
+
+	return r.Data, nil
+}
+
+func writeBundle(b *bundle.Bundle, path string) error {
+	var w io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := b.Write(w); err != nil {
+		return fmt.Errorf("writing the bundle: %v", err)
+	}
+	return nil
+}
@@ -2,7 +2,15 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
 )
 
 // GenerateAddressesRequest is request data for /api/v1/generate_addresses
@@ -12,11 +20,30 @@ type GenerateAddressesRequest struct {
 	ConfirmAddress bool `json:"confirm_address"`
 }
 
+// AddressBatch is a batch of addresses streamed by /api/v1/generate_addresses
+type AddressBatch struct {
+	StartIndex int      `json:"start_index"`
+	Addresses  []string `json:"addresses"`
+}
+
+// shortAddressesError is returned when the device answers fewer or more addresses than requested
+type shortAddressesError struct {
+	got      int
+	expected int
+}
+
+func (e shortAddressesError) Error() string {
+	return fmt.Sprintf("device returned %d addresses, expected %d", e.got, e.expected)
+}
+
 // generateAddresses generates addresses for hardware wallet.
+// Large ranges are requested from the device in batches of batchSize addresses. Clients sending
+// "Accept: application/x-ndjson" receive each batch as an AddressBatch line as soon as it is derived.
+// Derived addresses are cached by device ID and passphrase session.
 // URI: /api/v1/generate_addresses
 // Method: POST
 // Args: JSON Body
-func generateAddresses(gateway Gatewayer) http.HandlerFunc {
+func generateAddresses(gateway Gatewayer, cache *addressCache, batchSize int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
@@ -50,25 +77,276 @@ func generateAddresses(gateway Gatewayer) http.HandlerFunc {
 			return
 		}
 
+		if req.AddressN > maxDiscoveredAddresses {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, fmt.Sprintf("address_n cannot be more than %d", maxDiscoveredAddresses))
+			writeHTTPResponse(w, resp)
+			return
+		}
+
 		if req.StartIndex < 0 {
 			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, "start_index cannot be negative")
 			writeHTTPResponse(w, resp)
 			return
 		}
 
+		// address indexes are uint32, the last requested address must have one
+		if uint64(req.StartIndex)+uint64(req.AddressN)-1 > math.MaxUint32 {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, "start_index+address_n is past the last address index")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
 		// simple warning for logs
 		if req.AddressN+req.StartIndex > 8 {
 			logger.Warnf("wallet generating high index addresses: start_index: %d; address_n: %d", req.StartIndex, req.AddressN)
 		}
 
-		msg, err := gateway.AddressGen(req.AddressN, req.StartIndex, req.ConfirmAddress)
+		// addresses confirmed on the device screen are neither batched nor cached
+		if req.ConfirmAddress {
+			msg, err := gateway.AddressGen(req.AddressN, req.StartIndex, req.ConfirmAddress)
+			if err != nil {
+				logger.Error("generateAddress failed: %s", err.Error())
+				resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+				writeHTTPResponse(w, resp)
+				return
+			}
+
+			HandleFirmwareResponseMessages(w, r, gateway, msg)
+			return
+		}
+
+		var stream *ndjsonWriter
+		if acceptsNDJSON(r) {
+			stream = newNDJSONWriter(w)
+		}
+
+		key, msg, err := addressCacheKey(gateway, cache)
 		if err != nil {
 			logger.Error("generateAddress failed: %s", err.Error())
-			resp := NewHTTPErrorResponse(http.StatusInternalServerError, err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		end := req.StartIndex + req.AddressN
+		var addresses []string
+
+		for start := req.StartIndex; start < end; start += batchSize {
+			n := batchSize
+			if end-start < n {
+				n = end - start
+			}
+
+			batch, msg, err := generateAddressBatch(gateway, cache, key, start, n)
+			if err != nil {
+				logger.Error("generateAddress failed: %s", err.Error())
+				resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+				if stream != nil && stream.started {
+					stream.write(resp)
+				} else {
+					writeHTTPResponse(w, resp)
+				}
+				return
+			}
+
+			if batch == nil {
+				// the device asks for its PIN or passphrase or refuses the request. The client
+				// repeats the request once the device is unlocked.
+				if stream != nil && stream.started {
+					stream.write(interruptedBatchResponse(msg))
+				} else {
+					HandleFirmwareResponseMessages(w, r, gateway, msg)
+				}
+				return
+			}
+
+			if stream != nil {
+				stream.write(HTTPResponse{
+					Data: AddressBatch{
+						StartIndex: start,
+						Addresses:  batch,
+					},
+				})
+			}
+			addresses = append(addresses, batch...)
+		}
+
+		if stream == nil {
+			writeHTTPResponse(w, HTTPResponse{
+				Data: addresses,
+			})
+		}
+	}
+}
+
+// generateAddressBatch returns n addresses from startIndex, from the cache if they are all in it.
+// If the device answers with anything else than addresses, the answer is returned instead.
+// An answer with a different number of addresses is a shortAddressesError, its indices are unknown.
+func generateAddressBatch(gateway Gatewayer, cache *addressCache, key walletKey, startIndex, n int) ([]string, wire.Message, error) {
+	if key.DeviceID != "" {
+		if addresses, ok := cache.get(key, startIndex, n); ok {
+			return addresses, wire.Message{}, nil
+		}
+	}
+
+	msg, err := addressGen(gateway, n, startIndex)
+	if err != nil {
+		return nil, msg, err
+	}
+
+	if msg.Kind != uint16(messages.MessageType_MessageType_ResponseSkycoinAddress) {
+		return nil, msg, nil
+	}
+
+	addresses, err := deviceWallet.DecodeResponseSkycoinAddress(msg)
+	if err != nil {
+		return nil, msg, err
+	}
+	if len(addresses) != n {
+		return nil, msg, shortAddressesError{
+			got:      len(addresses),
+			expected: n,
+		}
+	}
+
+	if key.DeviceID != "" {
+		cache.add(key, startIndex, addresses)
+	}
+
+	return addresses, msg, nil
+}
+
+// addressGen asks the device for n addresses from startIndex without confirmation,
+// acknowledging button requests
+func addressGen(gateway Gatewayer, n, startIndex int) (wire.Message, error) {
+	msg, err := gateway.AddressGen(n, startIndex, false)
+	for err == nil && msg.Kind == uint16(messages.MessageType_MessageType_ButtonRequest) {
+		start := time.Now()
+		msg, err = gateway.ButtonAck()
+		observeButtonAck(start, msg, err)
+	}
+	return msg, err
+}
+
+// interruptedBatchResponse is the error streamed when the device refuses a batch after the
+// first batches were streamed
+func interruptedBatchResponse(msg wire.Message) HTTPResponse {
+	if msg.Kind == uint16(messages.MessageType_MessageType_Failure) {
+		recordFirmwareFailure(msg)
+		failureMsg, err := deviceWallet.DecodeFailMsg(msg)
+		if err != nil {
+			return NewHTTPErrorResponse(http.StatusInternalServerError, err.Error())
+		}
+		return NewHTTPErrorResponse(http.StatusConflict, failureMsg)
+	}
+
+	return NewHTTPErrorResponse(http.StatusInternalServerError,
+		fmt.Sprintf("recevied unexpected response message type: %s", messages.MessageType(msg.Kind)))
+}
+
+// CachedAddressesResponse is data returned by /api/v1/addresses
+type CachedAddressesResponse struct {
+	DeviceID  string          `json:"device_id"`
+	Addresses []CachedAddress `json:"addresses"`
+}
+
+// cachedAddresses returns the addresses of the connected device found in the address cache,
+// without deriving any. For a passphrase protected device the first address is derived to
+// identify the passphrase session. The range starts at start_index, 0 by default, and spans
+// address_n indices, or all cached addresses if address_n is 0 or missing.
+// URI: /api/v1/addresses
+// Method: GET
+// Args: start_index [int], address_n [int] query parameters
+func cachedAddresses(gateway Gatewayer, cache *addressCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		startIndex, ok := queryIndex(w, r, "start_index")
+		if !ok {
+			return
+		}
+		addressN, ok := queryIndex(w, r, "address_n")
+		if !ok {
+			return
+		}
+
+		key, msg, err := addressCacheKey(gateway, cache)
+		if err != nil {
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+		if key.DeviceID == "" {
+			resp := NewHTTPErrorResponse(http.StatusConflict, "device is not initialized")
 			writeHTTPResponse(w, resp)
 			return
 		}
 
-		HandleFirmwareResponseMessages(w, r, gateway, msg)
+		writeHTTPResponse(w, HTTPResponse{
+			Data: CachedAddressesResponse{
+				DeviceID:  key.DeviceID,
+				Addresses: cache.list(key, startIndex, addressN),
+			},
+		})
+	}
+}
+
+// queryIndex returns the non-negative integer query parameter name, 0 if it is missing.
+// If the value is invalid, an error response is written and false is returned.
+func queryIndex(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return 0, true
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		resp := NewHTTPErrorResponse(http.StatusBadRequest, fmt.Sprintf("invalid %s value", name))
+		writeHTTPResponse(w, resp)
+		return 0, false
+	}
+	if n < 0 {
+		resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, fmt.Sprintf("%s cannot be negative", name))
+		writeHTTPResponse(w, resp)
+		return 0, false
+	}
+
+	return n, true
+}
+
+// deriveAddresses returns n addresses of the wallet key from startIndex, deriving the ones that
+// aren't cached in batches of batchSize. If the device answers with anything else than addresses,
+// the answer is returned instead.
+func deriveAddresses(gateway Gatewayer, cache *addressCache, key walletKey, batchSize, startIndex, n int) ([]string, *wire.Message, error) {
+	end := startIndex + n
+	addresses := make([]string, 0, n)
+	for start := startIndex; start < end; start += batchSize {
+		size := batchSize
+		if end-start < size {
+			size = end - start
+		}
+
+		batch, msg, err := generateAddressBatch(gateway, cache, key, start, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		if batch == nil {
+			return nil, &msg, nil
+		}
+		addresses = append(addresses, batch...)
 	}
+
+	return addresses, nil, nil
 }
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+)
+
+// walletKey identifies the wallet a device derives addresses from: the device's seed, and for
+// passphrase protected devices the passphrase of the current session
+type walletKey struct {
+	DeviceID string
+	// Fingerprint identifies the passphrase session, it is empty for devices without passphrase protection
+	Fingerprint string
+}
+
+// CachedAddress is an address in the address cache
+type CachedAddress struct {
+	Index   int    `json:"index"`
+	Address string `json:"address"`
+}
+
+// cachedDevice holds the cached addresses of a device by session fingerprint and address index
+type cachedDevice map[string]map[int]string
+
+// addressCache keeps the addresses derived by devices. If it has a path, it is persisted there
+// as JSON after every change.
+type addressCache struct {
+	lock    sync.Mutex
+	path    string
+	devices map[string]cachedDevice
+}
+
+func newAddressCache() *addressCache {
+	return &addressCache{
+		devices: make(map[string]cachedDevice),
+	}
+}
+
+// loadAddressCache loads the address cache persisted at path, the cache is empty if the file doesn't exist
+func loadAddressCache(path string) (*addressCache, error) {
+	c := newAddressCache()
+	c.path = path
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &c.devices); err != nil {
+		return nil, err
+	}
+	if c.devices == nil {
+		c.devices = make(map[string]cachedDevice)
+	}
+
+	return c, nil
+}
+
+// get returns the n addresses from startIndex if they are all cached
+func (c *addressCache) get(key walletKey, startIndex, n int) ([]string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cached := c.devices[key.DeviceID][key.Fingerprint]
+	if cached == nil {
+		return nil, false
+	}
+
+	addresses := make([]string, n)
+	for i := range addresses {
+		a, ok := cached[startIndex+i]
+		if !ok {
+			return nil, false
+		}
+		addresses[i] = a
+	}
+
+	return addresses, true
+}
+
+// list returns the cached addresses from startIndex to the end of the range, or all of them if n is 0
+func (c *addressCache) list(key walletKey, startIndex, n int) []CachedAddress {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	addresses := []CachedAddress{}
+	for i, a := range c.devices[key.DeviceID][key.Fingerprint] {
+		if i < startIndex || (n > 0 && i >= startIndex+n) {
+			continue
+		}
+		addresses = append(addresses, CachedAddress{
+			Index:   i,
+			Address: a,
+		})
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].Index < addresses[j].Index
+	})
+
+	return addresses
+}
+
+// add caches addresses derived from startIndex
+func (c *addressCache) add(key walletKey, startIndex int, addresses []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	device := c.devices[key.DeviceID]
+	if device == nil {
+		device = make(cachedDevice)
+		c.devices[key.DeviceID] = device
+	}
+	cached := device[key.Fingerprint]
+	if cached == nil {
+		cached = make(map[int]string)
+		device[key.Fingerprint] = cached
+	}
+
+	for i, a := range addresses {
+		cached[startIndex+i] = a
+	}
+
+	c.save()
+}
+
+// invalidate drops every address cached for the device
+func (c *addressCache) invalidate(deviceID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.devices[deviceID]; !ok {
+		return
+	}
+	delete(c.devices, deviceID)
+
+	c.save()
+}
+
+// save persists the cache. The cache only saves device round trips, failing to persist it is logged.
+func (c *addressCache) save() {
+	if c.path == "" {
+		return
+	}
+
+	b, err := json.Marshal(c.devices)
+	if err != nil {
+		logger.WithError(err).Error("Saving the address cache failed")
+		return
+	}
+
+	// write to a temporary file first so that a crash can't leave a truncated cache
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".tmp")
+	if err != nil {
+		logger.WithError(err).Error("Saving the address cache failed")
+		return
+	}
+
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logger.WithError(err).Error("Saving the address cache failed")
+	}
+}
+
+// deviceFeatures asks the device for its features. It returns nil if the device answered
+// with something else, and an error only if it couldn't be reached.
+func deviceFeatures(gateway Gatewayer) (*messages.Features, error) {
+	msg, err := gateway.GetFeatures()
+	if err != nil {
+		return nil, err
+	}
+	if msg.Kind != uint16(messages.MessageType_MessageType_Features) {
+		return nil, nil
+	}
+
+	features := &messages.Features{}
+	if err := proto.Unmarshal(msg.Data, features); err != nil {
+		return nil, nil
+	}
+
+	return features, nil
+}
+
+// addressCacheKey returns the key of the wallet the device derives addresses from, an empty
+// key if they can't be cached. The session of a passphrase protected device is fingerprinted
+// with its first address, so deriving it may return a firmware request (PIN, passphrase) instead.
+func addressCacheKey(gateway Gatewayer, cache *addressCache) (walletKey, *wire.Message, error) {
+	features, err := deviceFeatures(gateway)
+	if err != nil {
+		return walletKey{}, nil, err
+	}
+	if features == nil || !features.GetInitialized() || features.GetDeviceId() == "" {
+		return walletKey{}, nil, nil
+	}
+	if !features.GetPassphraseProtection() {
+		return walletKey{DeviceID: features.GetDeviceId()}, nil, nil
+	}
+
+	msg, err := addressGen(gateway, 1, 0)
+	if err != nil {
+		return walletKey{}, nil, err
+	}
+	if msg.Kind != uint16(messages.MessageType_MessageType_ResponseSkycoinAddress) {
+		return walletKey{}, &msg, nil
+	}
+
+	addresses, err := deviceWallet.DecodeResponseSkycoinAddress(msg)
+	if err != nil {
+		return walletKey{}, nil, err
+	}
+	if len(addresses) != 1 {
+		return walletKey{}, nil, nil
+	}
+
+	key := walletKey{
+		DeviceID:    features.GetDeviceId(),
+		Fingerprint: sessionFingerprint(addresses[0]),
+	}
+	cache.add(key, 0, addresses)
+
+	return key, nil, nil
+}
+
+// sessionFingerprint identifies a passphrase session by the first address it derives
+func sessionFingerprint(firstAddress string) string {
+	h := sha256.Sum256([]byte(firstAddress))
+	return hex.EncodeToString(h[:8])
+}
+
+// addressCachingGateway drops the addresses cached for a device before the operations that
+// replace its seed
+type addressCachingGateway struct {
+	Gatewayer
+	cache *addressCache
+}
+
+func (g addressCachingGateway) invalidate() {
+	// the device may keep its ID when it is wiped, so the ID of an uninitialized device is used too
+	if features, _ := deviceFeatures(g.Gatewayer); features.GetDeviceId() != "" {
+		g.cache.invalidate(features.GetDeviceId())
+	}
+}
+
+// Wipe invalidates the device's cached addresses and wipes it
+func (g addressCachingGateway) Wipe() (wire.Message, error) {
+	g.invalidate()
+	return g.Gatewayer.Wipe()
+}
+
+// GenerateMnemonic invalidates the device's cached addresses and makes it generate a new seed
+func (g addressCachingGateway) GenerateMnemonic(wordCount uint32, usePassphrase bool) (wire.Message, error) {
+	g.invalidate()
+	return g.Gatewayer.GenerateMnemonic(wordCount, usePassphrase)
+}
+
+// SetMnemonic invalidates the device's cached addresses and sets its mnemonic
+func (g addressCachingGateway) SetMnemonic(mnemonic string) (wire.Message, error) {
+	g.invalidate()
+	return g.Gatewayer.SetMnemonic(mnemonic)
+}
+
+// Recovery invalidates the device's cached addresses and starts a seed recovery
+func (g addressCachingGateway) Recovery(wordCount uint32, usePassphrase, dryRun bool) (wire.Message, error) {
+	// a dry run checks the seed without replacing it
+	if !dryRun {
+		g.invalidate()
+	}
+	return g.Gatewayer.Recovery(wordCount, usePassphrase, dryRun)
+}
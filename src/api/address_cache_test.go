@@ -0,0 +1,277 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+)
+
+func TestAddressCachePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "address-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "addresses.json")
+
+	cache, err := loadAddressCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seed := walletKey{DeviceID: "device"}
+	hidden := walletKey{DeviceID: "device", Fingerprint: sessionFingerprint("address100")}
+	cache.add(seed, 0, newAddressList(0, 4))
+	cache.add(hidden, 0, newAddressList(100, 2))
+	cache.add(walletKey{DeviceID: "other"}, 0, newAddressList(200, 1))
+
+	cache, err = loadAddressCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if addresses, ok := cache.get(seed, 1, 3); !ok || !reflect.DeepEqual(addresses, newAddressList(1, 3)) {
+		t.Fatalf("expected cached addresses, got %v", addresses)
+	}
+	if addresses, ok := cache.get(hidden, 0, 2); !ok || !reflect.DeepEqual(addresses, newAddressList(100, 2)) {
+		t.Fatalf("expected cached hidden wallet addresses, got %v", addresses)
+	}
+	if _, ok := cache.get(hidden, 0, 3); ok {
+		t.Fatal("partially cached range was returned")
+	}
+
+	cache.invalidate("device")
+
+	cache, err = loadAddressCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.get(seed, 0, 1); ok {
+		t.Fatal("invalidated addresses were returned")
+	}
+	if _, ok := cache.get(walletKey{DeviceID: "other"}, 0, 1); !ok {
+		t.Fatal("addresses of another device were invalidated")
+	}
+}
+
+func TestAddressCachingGatewayInvalidates(t *testing.T) {
+	success := respondWith(newWireMessage(t, messages.MessageType_MessageType_Success, &messages.Success{}))
+	features := respondWith(newWireMessage(t, messages.MessageType_MessageType_Features, &messages.Features{
+		DeviceId:    proto.String("device"),
+		Initialized: proto.Bool(false),
+	}))
+
+	cases := []struct {
+		name        string
+		call        func(g Gatewayer) error
+		responses   []mockResponse
+		calls       []mockCall
+		invalidated bool
+	}{
+		{
+			name: "Wipe",
+			call: func(g Gatewayer) error {
+				_, err := g.Wipe()
+				return err
+			},
+			responses:   []mockResponse{features, success},
+			calls:       []mockCall{{Method: "GetFeatures"}, {Method: "Wipe"}},
+			invalidated: true,
+		},
+		{
+			name: "SetMnemonic",
+			call: func(g Gatewayer) error {
+				_, err := g.SetMnemonic("mnemonic")
+				return err
+			},
+			responses:   []mockResponse{features, success},
+			calls:       []mockCall{{Method: "GetFeatures"}, {Method: "SetMnemonic", Args: []interface{}{"mnemonic"}}},
+			invalidated: true,
+		},
+		{
+			name: "GenerateMnemonic",
+			call: func(g Gatewayer) error {
+				_, err := g.GenerateMnemonic(12, false)
+				return err
+			},
+			responses:   []mockResponse{features, success},
+			calls:       []mockCall{{Method: "GetFeatures"}, {Method: "GenerateMnemonic", Args: []interface{}{uint32(12), false}}},
+			invalidated: true,
+		},
+		{
+			name: "Recovery",
+			call: func(g Gatewayer) error {
+				_, err := g.Recovery(12, false, false)
+				return err
+			},
+			responses:   []mockResponse{features, success},
+			calls:       []mockCall{{Method: "GetFeatures"}, {Method: "Recovery", Args: []interface{}{uint32(12), false, false}}},
+			invalidated: true,
+		},
+		{
+			name: "Recovery dry run",
+			call: func(g Gatewayer) error {
+				_, err := g.Recovery(12, false, true)
+				return err
+			},
+			responses: []mockResponse{success},
+			calls:     []mockCall{{Method: "Recovery", Args: []interface{}{uint32(12), false, true}}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			key := walletKey{DeviceID: "device"}
+			cache := newAddressCache()
+			cache.add(key, 0, newAddressList(0, 1))
+
+			gateway := newMockGatewayer(t, tc.calls, tc.responses)
+			if err := tc.call(addressCachingGateway{gateway, cache}); err != nil {
+				t.Fatal(err)
+			}
+			assertGatewayCalls(t, gateway, tc.calls)
+
+			if _, ok := cache.get(key, 0, 1); ok == tc.invalidated {
+				t.Fatalf("expected invalidated=%v", tc.invalidated)
+			}
+		})
+	}
+}
+
+func TestCachedAddresses(t *testing.T) {
+	cache := newAddressCache()
+	cache.add(walletKey{DeviceID: "device"}, 0, newAddressList(0, 4))
+	cache.add(walletKey{DeviceID: "device"}, 10, newAddressList(10, 2))
+	cache.add(walletKey{DeviceID: "device", Fingerprint: sessionFingerprint("address100")}, 0, newAddressList(100, 3))
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "all",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+			},
+			calls:  []mockCall{{Method: "GetFeatures"}},
+			status: http.StatusOK,
+			data: CachedAddressesResponse{
+				DeviceID: "device",
+				Addresses: []CachedAddress{
+					{0, "address0"}, {1, "address1"}, {2, "address2"}, {3, "address3"}, {10, "address10"}, {11, "address11"},
+				},
+			},
+		},
+		{
+			name:   "passphrase session",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", true)),
+				respondWith(newAddressesMessage(t, 100, 1)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+			},
+			status: http.StatusOK,
+			data: CachedAddressesResponse{
+				DeviceID:  "device",
+				Addresses: []CachedAddress{{0, "address100"}, {1, "address101"}, {2, "address102"}},
+			},
+		},
+		{
+			name:   "passphrase requested",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", true)),
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_PassphraseRequest, &messages.PassphraseRequest{})),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+			},
+			status: http.StatusOK,
+			data:   "PassPhraseRequest",
+		},
+		{
+			name:   "unknown device",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "other", false)),
+			},
+			calls:  []mockCall{{Method: "GetFeatures"}},
+			status: http.StatusOK,
+			data: CachedAddressesResponse{
+				DeviceID:  "other",
+				Addresses: []CachedAddress{},
+			},
+		},
+		{
+			name:   "not initialized",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_Features, &messages.Features{
+					Initialized: proto.Bool(false),
+				})),
+			},
+			calls:  []mockCall{{Method: "GetFeatures"}},
+			status: http.StatusConflict,
+		},
+		{
+			name:      "no device",
+			method:    http.MethodGet,
+			responses: []mockResponse{respondErr(errNoDeviceConnected)},
+			calls:     []mockCall{{Method: "GetFeatures"}},
+			status:    http.StatusServiceUnavailable,
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/addresses", func(g Gatewayer) http.Handler {
+		return cachedAddresses(g, cache)
+	}, cases)
+
+	runHTTPTestCases(t, "/api/v1/addresses?start_index=2&address_n=9", func(g Gatewayer) http.Handler {
+		return cachedAddresses(g, cache)
+	}, []httpTestCase{
+		{
+			name:   "range",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+			},
+			calls:  []mockCall{{Method: "GetFeatures"}},
+			status: http.StatusOK,
+			data: CachedAddressesResponse{
+				DeviceID:  "device",
+				Addresses: []CachedAddress{{2, "address2"}, {3, "address3"}, {10, "address10"}},
+			},
+		},
+	})
+
+	for _, tc := range []struct {
+		url    string
+		status int
+	}{
+		{"/api/v1/addresses?start_index=x", http.StatusBadRequest},
+		{"/api/v1/addresses?address_n=-1", http.StatusUnprocessableEntity},
+	} {
+		runHTTPTestCases(t, tc.url, func(g Gatewayer) http.Handler {
+			return cachedAddresses(g, cache)
+		}, []httpTestCase{
+			{
+				name:   tc.url,
+				method: http.MethodGet,
+				status: tc.status,
+			},
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/therealssj/testingdep2/src/qr"
+	"github.com/therealssj/testingdep2/src/uri"
+)
+
+const (
+	// ContentTypePNG is the content type of PNG QR codes
+	ContentTypePNG = "image/png"
+	// ContentTypeSVG is the content type of SVG QR codes
+	ContentTypeSVG = "image/svg+xml"
+
+	defaultQRScale = 8
+	maxQRScale     = 40
+)
+
+// addressQR renders a QR code of a skycoin payment URI for the device address at address_index.
+// The image is a PNG unless format is svg, errors are answered in JSON.
+// URI: /api/v1/address/qr
+// Method: GET
+// Args: address_index [int], format [png|svg], scale [int], amount [coins], hours [int], label, message query parameters
+func addressQR(gateway Gatewayer, cache *addressCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		index, ok := queryIndex(w, r, "address_index")
+		if !ok {
+			return
+		}
+		scale, ok := queryIndex(w, r, "scale")
+		if !ok {
+			return
+		}
+		if scale == 0 {
+			scale = defaultQRScale
+		}
+		if scale > maxQRScale {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, fmt.Sprintf("scale cannot be more than %d", maxQRScale))
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		query := r.URL.Query()
+		format := query.Get("format")
+		if format != "" && format != "png" && format != "svg" {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, "format must be png or svg")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		payment := uri.URI{
+			Label:   query.Get("label"),
+			Message: query.Get("message"),
+		}
+		if amount := query.Get("amount"); amount != "" {
+			coins, err := droplet.FromString(amount)
+			if err != nil {
+				resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, fmt.Sprintf("invalid amount: %v", err))
+				writeHTTPResponse(w, resp)
+				return
+			}
+			payment.Coins = coins
+		}
+		if hours := query.Get("hours"); hours != "" {
+			n, err := strconv.ParseUint(hours, 10, 64)
+			if err != nil {
+				resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, "invalid hours value")
+				writeHTTPResponse(w, resp)
+				return
+			}
+			payment.Hours = n
+		}
+
+		key, msg, err := addressCacheKey(gateway, cache)
+		if err != nil {
+			logger.Error("addressQR failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		addresses, msg, err := deviceAddressesAt(gateway, cache, key, []uint32{uint32(index)})
+		if err != nil {
+			logger.Error("addressQR failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+		payment.Address = addresses[uint32(index)]
+
+		text, err := payment.Encode()
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, fmt.Sprintf("invalid amount: %v", err))
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		code, err := qr.Encode(text, qr.M)
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if format == "svg" {
+			w.Header().Set("Content-Type", ContentTypeSVG)
+			w.Write([]byte(code.SVG(scale)))
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := code.WritePNG(&buf, scale); err != nil {
+			logger.Error("addressQR failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(http.StatusInternalServerError, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypePNG)
+		w.Write(buf.Bytes())
+	}
+}
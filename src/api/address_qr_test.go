@@ -0,0 +1,99 @@
+package api
+
+import (
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+
+	"github.com/therealssj/testingdep2/src/qr"
+)
+
+func TestAddressQR(t *testing.T) {
+	_, addresses := newTestKeys(t, 3)
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "invalid format",
+			method: http.MethodGet,
+			status: http.StatusUnprocessableEntity,
+			err:    "format must be png or svg",
+		},
+	}
+	runHTTPTestCases(t, "/api/v1/address/qr?format=gif", func(g Gatewayer) http.Handler {
+		return addressQR(g, newAddressCache())
+	}, cases)
+
+	runHTTPTestCases(t, "/api/v1/address/qr?amount=1.0000001", func(g Gatewayer) http.Handler {
+		return addressQR(g, newAddressCache())
+	}, []httpTestCase{
+		{
+			name:   "invalid amount",
+			method: http.MethodGet,
+			status: http.StatusUnprocessableEntity,
+		},
+	})
+
+	serve := func(t *testing.T, url string) *httptest.ResponseRecorder {
+		calls := []mockCall{
+			{Method: "GetFeatures"},
+			{Method: "AddressGen", Args: []interface{}{1, 2, false}},
+		}
+		gateway := newMockGatewayer(t, calls, []mockResponse{
+			respondWith(newFeaturesMessage(t, "device", false)),
+			respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, &messages.ResponseSkycoinAddress{
+				Addresses: addresses[2:],
+			})),
+		})
+
+		rr := httptest.NewRecorder()
+		addressQR(gateway, newAddressCache()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+
+		assertGatewayCalls(t, gateway, calls)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+
+	t.Run("svg", func(t *testing.T) {
+		rr := serve(t, "/api/v1/address/qr?address_index=2&format=svg&scale=2&amount=1.5&label=rent%20march")
+
+		code, err := qr.Encode("skycoin:"+addresses[2]+"?amount=1.5&label=rent%20march", qr.M)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != ContentTypeSVG {
+			t.Fatalf("unexpected content type %s", ct)
+		}
+		if rr.Body.String() != code.SVG(2) {
+			t.Fatalf("unexpected svg %s", rr.Body.String())
+		}
+	})
+
+	t.Run("png", func(t *testing.T) {
+		rr := serve(t, "/api/v1/address/qr?address_index=2")
+
+		code, err := qr.Encode("skycoin:"+addresses[2], qr.M)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != ContentTypePNG {
+			t.Fatalf("unexpected content type %s", ct)
+		}
+		img, err := png.Decode(rr.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if side := (code.Size + 2*qr.QuietZone) * defaultQRScale; img.Bounds().Dx() != side {
+			t.Fatalf("expected a side of %d pixels, got %v", side, img.Bounds())
+		}
+	})
+}
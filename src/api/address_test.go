@@ -0,0 +1,523 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/driver"
+)
+
+func TestGenerateAddresses(t *testing.T) {
+	addresses := newWireMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, &messages.ResponseSkycoinAddress{
+		Addresses: []string{"2HcV3JDBuU8HSgetgKPxmNa95XrCgx6VchF"},
+	})
+
+	uninitialized := newWireMessage(t, messages.MessageType_MessageType_Features, &messages.Features{
+		Initialized: proto.Bool(false),
+	})
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "unsupported content type",
+			method:      http.MethodPost,
+			contentType: ContentTypeForm,
+			body:        "address_n=1",
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "invalid json",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        "{",
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "address_n is 0",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 0}`,
+			status:      http.StatusUnprocessableEntity,
+			err:         "address_n cannot be 0",
+		},
+		{
+			name:        "negative address_n",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": -1}`,
+			status:      http.StatusUnprocessableEntity,
+			err:         "address_n cannot be negative",
+		},
+		{
+			name:        "negative start_index",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 1, "start_index": -1}`,
+			status:      http.StatusUnprocessableEntity,
+			err:         "start_index cannot be negative",
+		},
+		{
+			name:        "too many addresses",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 10001}`,
+			status:      http.StatusUnprocessableEntity,
+			err:         "address_n cannot be more than 10000",
+		},
+		{
+			name:        "index overflow",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 2, "start_index": 4294967295}`,
+			status:      http.StatusUnprocessableEntity,
+			err:         "start_index+address_n is past the last address index",
+		},
+		{
+			name:        "device error",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 1}`,
+			responses:   []mockResponse{respondWith(uninitialized), respondErr("usb failure")},
+			calls:       []mockCall{{Method: "GetFeatures"}, {Method: "AddressGen", Args: []interface{}{1, 0, false}}},
+			status:      http.StatusInternalServerError,
+			err:         "usb failure",
+		},
+		{
+			name:        "no device",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 1}`,
+			responses:   []mockResponse{respondErr(errNoDeviceConnected)},
+			calls:       []mockCall{{Method: "GetFeatures"}},
+			status:      http.StatusServiceUnavailable,
+		},
+		{
+			name:        "addresses",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 1, "start_index": 3}`,
+			responses:   []mockResponse{respondWith(uninitialized), respondWith(addresses)},
+			calls:       []mockCall{{Method: "GetFeatures"}, {Method: "AddressGen", Args: []interface{}{1, 3, false}}},
+			status:      http.StatusOK,
+			data:        []string{"2HcV3JDBuU8HSgetgKPxmNa95XrCgx6VchF"},
+		},
+		{
+			name:        "confirmed addresses",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 1, "confirm_address": true}`,
+			responses: []mockResponse{
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_ButtonRequest, &messages.ButtonRequest{})),
+				respondWith(addresses),
+			},
+			calls: []mockCall{
+				{Method: "AddressGen", Args: []interface{}{1, 0, true}},
+				{Method: "ButtonAck"},
+			},
+			status: http.StatusOK,
+			data:   []string{"2HcV3JDBuU8HSgetgKPxmNa95XrCgx6VchF"},
+		},
+		{
+			name:        "cancelled on the device",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 1, "confirm_address": true}`,
+			responses: []mockResponse{
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_ButtonRequest, &messages.ButtonRequest{})),
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_Failure, &messages.Failure{
+					Code:    messages.FailureType_Failure_ActionCancelled.Enum(),
+					Message: proto.String("Action cancelled by user"),
+				})),
+			},
+			calls: []mockCall{
+				{Method: "AddressGen", Args: []interface{}{1, 0, true}},
+				{Method: "ButtonAck"},
+			},
+			status: http.StatusConflict,
+			err:    "Action cancelled by user",
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/generate_addresses", func(g Gatewayer) http.Handler {
+		return generateAddresses(g, newAddressCache(), defaultAddressBatchSize)
+	}, cases)
+}
+
+// newAddressList returns n fake addresses from startIndex
+func newAddressList(startIndex, n int) []string {
+	addresses := make([]string, n)
+	for i := range addresses {
+		addresses[i] = fmt.Sprintf("address%d", startIndex+i)
+	}
+	return addresses
+}
+
+func newAddressesMessage(t *testing.T, startIndex, n int) wire.Message {
+	return newWireMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, &messages.ResponseSkycoinAddress{
+		Addresses: newAddressList(startIndex, n),
+	})
+}
+
+func newFeaturesMessage(t *testing.T, deviceID string, passphraseProtection bool) wire.Message {
+	return newWireMessage(t, messages.MessageType_MessageType_Features, &messages.Features{
+		DeviceId:             proto.String(deviceID),
+		Initialized:          proto.Bool(true),
+		PassphraseProtection: proto.Bool(passphraseProtection),
+	})
+}
+
+func TestGenerateAddressesBatches(t *testing.T) {
+	pinMatrixRequest := newWireMessage(t, messages.MessageType_MessageType_PinMatrixRequest, &messages.PinMatrixRequest{})
+	failure := newWireMessage(t, messages.MessageType_MessageType_Failure, &messages.Failure{
+		Code:    messages.FailureType_Failure_DataError.Enum(),
+		Message: proto.String("Asking for too much addresses"),
+	})
+
+	cases := []httpTestCase{
+		{
+			name:        "split in batches",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 10, "start_index": 2}`,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 2, 4)),
+				respondWith(newAddressesMessage(t, 6, 4)),
+				respondWith(newAddressesMessage(t, 10, 2)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 2, false}},
+				{Method: "AddressGen", Args: []interface{}{4, 6, false}},
+				{Method: "AddressGen", Args: []interface{}{2, 10, false}},
+			},
+			status: http.StatusOK,
+			data:   newAddressList(2, 10),
+		},
+		{
+			name:        "short batch",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 10, "start_index": 2}`,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 2, 3)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 2, false}},
+			},
+			status: http.StatusBadGateway,
+			err:    "device returned 3 addresses, expected 4",
+		},
+		{
+			name:        "PIN requested by the first batch",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 10}`,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(pinMatrixRequest),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 0, false}},
+			},
+			status: http.StatusOK,
+			data:   "PinMatrixRequest",
+		},
+		{
+			name:        "later batch refused",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_n": 6}`,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 0, 4)),
+				respondWith(failure),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 0, false}},
+				{Method: "AddressGen", Args: []interface{}{2, 4, false}},
+			},
+			status: http.StatusConflict,
+			err:    "Asking for too much addresses",
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/generate_addresses", func(g Gatewayer) http.Handler {
+		return generateAddresses(g, newAddressCache(), 4)
+	}, cases)
+}
+
+func TestGenerateAddressesCache(t *testing.T) {
+	cache := newAddressCache()
+
+	cases := []struct {
+		name      string
+		body      string
+		responses []mockResponse
+		calls     []mockCall
+		data      []string
+	}{
+		{
+			name: "derived by the device",
+			body: `{"address_n": 6}`,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 0, 4)),
+				respondWith(newAddressesMessage(t, 4, 2)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 0, false}},
+				{Method: "AddressGen", Args: []interface{}{2, 4, false}},
+			},
+			data: newAddressList(0, 6),
+		},
+		{
+			name: "cached",
+			body: `{"address_n": 4}`,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+			},
+			data: newAddressList(0, 4),
+		},
+		{
+			name: "partially cached",
+			body: `{"address_n": 8}`,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 4, 4)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 4, false}},
+			},
+			data: newAddressList(0, 8),
+		},
+		{
+			name: "another device",
+			body: `{"address_n": 4}`,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "other", false)),
+				respondWith(newAddressesMessage(t, 100, 4)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 0, false}},
+			},
+			data: newAddressList(100, 4),
+		},
+		{
+			name: "passphrase session",
+			body: `{"address_n": 4}`,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", true)),
+				respondWith(newAddressesMessage(t, 200, 1)),
+				respondWith(newAddressesMessage(t, 200, 4)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+				{Method: "AddressGen", Args: []interface{}{4, 0, false}},
+			},
+			data: newAddressList(200, 4),
+		},
+		{
+			name: "same passphrase session",
+			body: `{"address_n": 4}`,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", true)),
+				respondWith(newAddressesMessage(t, 200, 1)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+			},
+			data: newAddressList(200, 4),
+		},
+		{
+			name: "another passphrase session",
+			body: `{"address_n": 4}`,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", true)),
+				respondWith(newAddressesMessage(t, 300, 1)),
+				respondWith(newAddressesMessage(t, 300, 4)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+				{Method: "AddressGen", Args: []interface{}{4, 0, false}},
+			},
+			data: newAddressList(300, 4),
+		},
+	}
+
+	// the cases share the cache and run in order
+	for _, tc := range cases {
+		gateway := newMockGatewayer(t, tc.calls, tc.responses)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/generate_addresses", bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", ContentTypeJSON)
+		rr := httptest.NewRecorder()
+		generateAddresses(gateway, cache, 4).ServeHTTP(rr, req)
+
+		checkHTTPResponse(t, rr, http.StatusOK, "", tc.data)
+		assertGatewayCalls(t, gateway, tc.calls)
+	}
+}
+
+func TestGenerateAddressesStream(t *testing.T) {
+	cases := []struct {
+		name      string
+		responses []mockResponse
+		calls     []mockCall
+		lines     []string
+	}{
+		{
+			name: "batches",
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 0, 4)),
+				respondWith(newAddressesMessage(t, 4, 2)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 0, false}},
+				{Method: "AddressGen", Args: []interface{}{2, 4, false}},
+			},
+			lines: []string{
+				`{"data":{"start_index":0,"addresses":["address0","address1","address2","address3"]}}`,
+				`{"data":{"start_index":4,"addresses":["address4","address5"]}}`,
+			},
+		},
+		{
+			name: "interrupted",
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 0, 4)),
+				respondErr("Device disconnected during action"),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 0, false}},
+				{Method: "AddressGen", Args: []interface{}{2, 4, false}},
+			},
+			lines: []string{
+				`{"data":{"start_index":0,"addresses":["address0","address1","address2","address3"]}}`,
+				`{"error":{"message":"Device disconnected during action","code":503}}`,
+			},
+		},
+		{
+			name: "refused",
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 0, 4)),
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_PassphraseRequest, &messages.PassphraseRequest{})),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 0, false}},
+				{Method: "AddressGen", Args: []interface{}{2, 4, false}},
+			},
+			lines: []string{
+				`{"data":{"start_index":0,"addresses":["address0","address1","address2","address3"]}}`,
+				`{"error":{"message":"recevied unexpected response message type: MessageType_PassphraseRequest","code":500}}`,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := newMockGatewayer(t, tc.calls, tc.responses)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/generate_addresses", bytes.NewBufferString(`{"address_n": 6}`))
+			req.Header.Set("Content-Type", ContentTypeJSON)
+			req.Header.Set("Accept", ContentTypeNDJSON)
+			rr := httptest.NewRecorder()
+			generateAddresses(gateway, newAddressCache(), 4).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rr.Code)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != ContentTypeNDJSON {
+				t.Fatalf("expected content type %s, got %s", ContentTypeNDJSON, ct)
+			}
+			if !rr.Flushed {
+				t.Fatal("stream was not flushed")
+			}
+
+			lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+			if !reflect.DeepEqual(lines, tc.lines) {
+				t.Fatalf("expected lines\n%s\ngot\n%s", strings.Join(tc.lines, "\n"), strings.Join(lines, "\n"))
+			}
+			assertGatewayCalls(t, gateway, tc.calls)
+		})
+	}
+}
+
+func TestGenerateAddressesStreamNotGzipped(t *testing.T) {
+	sim := driver.NewSimulator(driver.SimulatorConfig{Mnemonic: resilienceMnemonic})
+	mux, _ := newServerMux(muxConfig{host: testHost, addressBatchSize: 8}, &deviceWallet.Device{Driver: sim}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/generate_addresses", bytes.NewBufferString(`{"address_n": 50}`))
+	req.Header.Set("Content-Type", ContentTypeJSON)
+	req.Header.Set("Accept", ContentTypeNDJSON)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("streamed response is encoded with %s", rr.Header().Get("Content-Encoding"))
+	}
+	if !rr.Flushed {
+		t.Fatal("stream was not flushed")
+	}
+
+	expected, err := sim.Addresses("", 0, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var addresses []string
+	for _, line := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n") {
+		var resp struct {
+			Data  AddressBatch `json:"data"`
+			Error *HTTPError   `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("invalid line %q: %v", line, err)
+		}
+		if resp.Error != nil {
+			t.Fatalf("unexpected error %v", resp.Error)
+		}
+		if resp.Data.StartIndex != len(addresses) {
+			t.Fatalf("expected batch at %d, got %d", len(addresses), resp.Data.StartIndex)
+		}
+		addresses = append(addresses, resp.Data.Addresses...)
+	}
+
+	if !reflect.DeepEqual(expected, addresses) {
+		t.Fatalf("expected %v, got %v", expected, addresses)
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/base58"
+)
+
+// Reasons an address is invalid, returned in AddressValidateResponse.Code
+const (
+	AddressInvalidBase58   = "invalid_base58"
+	AddressInvalidLength   = "invalid_length"
+	AddressInvalidChecksum = "invalid_checksum"
+	AddressInvalidVersion  = "invalid_version"
+	AddressBitcoin         = "bitcoin_address"
+)
+
+// AddressValidateResponse is data returned by /api/v1/address/validate
+type AddressValidateResponse struct {
+	Address string `json:"address"`
+	Valid   bool   `json:"valid"`
+	// Version is the version byte of an address of the right length
+	Version *uint8 `json:"version,omitempty"`
+	// Code is the reason an invalid address was rejected
+	Code   string `json:"code,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Bitcoin is set if the address is a valid bitcoin address, likely pasted by mistake
+	Bitcoin bool `json:"bitcoin"`
+}
+
+// validateAddress checks a skycoin address without the device. An invalid address is
+// answered with valid false and the reason it was rejected.
+// URI: /api/v1/address/validate
+// Method: GET
+// Args: address [string] query parameter
+func validateAddress() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		address := r.URL.Query().Get("address")
+		if address == "" {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, "address is required")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: checkAddress(address),
+		})
+	}
+}
+
+// checkAddress decodes a skycoin address and reports why it is invalid
+func checkAddress(address string) AddressValidateResponse {
+	resp := AddressValidateResponse{
+		Address: address,
+	}
+
+	b, err := base58.Decode(address)
+	if err != nil {
+		resp.Code = AddressInvalidBase58
+		resp.Reason = err.Error()
+		return resp
+	}
+
+	// key hash, version and checksum
+	if len(b) == 20+1+4 {
+		version := b[20]
+		resp.Version = &version
+	}
+
+	if _, err := cipher.AddressFromBytes(b); err != nil {
+		switch err {
+		case cipher.ErrAddressInvalidLength:
+			resp.Code = AddressInvalidLength
+		case cipher.ErrAddressInvalidChecksum:
+			resp.Code = AddressInvalidChecksum
+		case cipher.ErrAddressInvalidVersion:
+			resp.Code = AddressInvalidVersion
+		}
+		resp.Reason = err.Error()
+
+		if _, err := cipher.DecodeBase58BitcoinAddress(address); err == nil {
+			resp.Bitcoin = true
+			resp.Version = nil
+			resp.Code = AddressBitcoin
+			resp.Reason = "this is a bitcoin address, not a skycoin address"
+		}
+		return resp
+	}
+
+	resp.Valid = true
+	return resp
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+func TestValidateAddress(t *testing.T) {
+	keys, addresses := newTestKeys(t, 1)
+	version := uint8(0)
+	otherVersion := cipher.Address{Version: 1, Key: cipher.MustDecodeBase58Address(addresses[0]).Key}
+	otherVersionByte := uint8(1)
+	bitcoin := cipher.BitcoinAddressFromPubKey(cipher.MustPubKeyFromSecKey(keys[0])).String()
+
+	// replacing the last character keeps the length and breaks the checksum
+	badChecksum := addresses[0][:len(addresses[0])-1] + "1"
+	if addresses[0][len(addresses[0])-1] == '1' {
+		badChecksum = addresses[0][:len(addresses[0])-1] + "2"
+	}
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "no address",
+			method: http.MethodGet,
+			status: http.StatusUnprocessableEntity,
+			err:    "address is required",
+		},
+	}
+	runHTTPTestCases(t, "/api/v1/address/validate", func(g Gatewayer) http.Handler {
+		return validateAddress()
+	}, cases)
+
+	checks := []struct {
+		name     string
+		address  string
+		expected AddressValidateResponse
+	}{
+		{
+			name:     "valid",
+			address:  addresses[0],
+			expected: AddressValidateResponse{Valid: true, Version: &version},
+		},
+		{
+			name:     "invalid base58",
+			address:  "0OIl",
+			expected: AddressValidateResponse{Code: AddressInvalidBase58},
+		},
+		{
+			name:     "invalid length",
+			address:  addresses[0][:20],
+			expected: AddressValidateResponse{Code: AddressInvalidLength},
+		},
+		{
+			name:     "invalid checksum",
+			address:  badChecksum,
+			expected: AddressValidateResponse{Code: AddressInvalidChecksum, Version: &version},
+		},
+		{
+			name:     "invalid version",
+			address:  otherVersion.String(),
+			expected: AddressValidateResponse{Code: AddressInvalidVersion, Version: &otherVersionByte},
+		},
+		{
+			name:     "bitcoin address",
+			address:  bitcoin,
+			expected: AddressValidateResponse{Code: AddressBitcoin, Bitcoin: true},
+		},
+	}
+
+	for _, tc := range checks {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := checkAddress(tc.address)
+			if resp.Address != tc.address || resp.Valid != tc.expected.Valid || resp.Code != tc.expected.Code ||
+				resp.Bitcoin != tc.expected.Bitcoin {
+				t.Fatalf("unexpected response %+v", resp)
+			}
+			if (resp.Version == nil) != (tc.expected.Version == nil) ||
+				(resp.Version != nil && *resp.Version != *tc.expected.Version) {
+				t.Fatalf("expected version %v, got %v", tc.expected.Version, resp.Version)
+			}
+			if !resp.Valid && resp.Reason == "" {
+				t.Fatal("an invalid address must have a reason")
+			}
+		})
+	}
+}
@@ -40,7 +40,7 @@ func applySettings(gateway Gatewayer) http.HandlerFunc {
 		msg, err := gateway.ApplySettings(req.UsePassphrase, req.Label)
 		if err != nil {
 			logger.Error("applySettings failed: %s", err.Error())
-			resp := NewHTTPErrorResponse(http.StatusInternalServerError, err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
 			writeHTTPResponse(w, resp)
 			return
 		}
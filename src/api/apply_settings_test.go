@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+)
+
+func TestApplySettings(t *testing.T) {
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "unsupported content type",
+			method:      http.MethodPost,
+			contentType: ContentTypeForm,
+			body:        "label=foo",
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "invalid json",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"label": 1}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "device error",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"label": "foo"}`,
+			responses:   []mockResponse{respondErr("usb failure")},
+			calls:       []mockCall{{Method: "ApplySettings", Args: []interface{}{false, "foo"}}},
+			status:      http.StatusInternalServerError,
+			err:         "usb failure",
+		},
+		{
+			name:        "PIN required",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"label": "foo", "use_passphrase": true}`,
+			responses: []mockResponse{
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_PinMatrixRequest, &messages.PinMatrixRequest{})),
+			},
+			calls:  []mockCall{{Method: "ApplySettings", Args: []interface{}{true, "foo"}}},
+			status: http.StatusOK,
+			data:   "PinMatrixRequest",
+		},
+		{
+			name:        "settings applied",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"label": "foo"}`,
+			responses: []mockResponse{
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_ButtonRequest, &messages.ButtonRequest{})),
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_Success, &messages.Success{
+					Message: proto.String("Settings applied"),
+				})),
+			},
+			calls: []mockCall{
+				{Method: "ApplySettings", Args: []interface{}{false, "foo"}},
+				{Method: "ButtonAck"},
+			},
+			status: http.StatusOK,
+			data:   "Settings applied",
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/apply_settings", func(g Gatewayer) http.Handler {
+		return applySettings(g)
+	}, cases)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/therealssj/testingdep2/src/audit"
+)
+
+// maxAuditedBodySize is the largest request body accepted by audited endpoints, the body is
+// read in memory to be hashed
+const maxAuditedBodySize = 1 << 20
+
+// auditHandler records every request to a sensitive endpoint in the audit log.
+// Only a hash of the request body is recorded, never the body itself.
+func auditHandler(auditLog *audit.Log, endpoint, device string, handler http.Handler) http.Handler {
+	if auditLog == nil {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAuditedBodySize))
+			r.Body.Close()
+			if err != nil {
+				status := http.StatusBadRequest
+				if _, ok := err.(*http.MaxBytesError); ok {
+					status = http.StatusRequestEntityTooLarge
+				}
+				resp := NewHTTPErrorResponse(status, err.Error())
+				writeHTTPResponse(w, resp)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		handler.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		outcome := audit.OutcomeOK
+		if rec.status >= http.StatusBadRequest {
+			outcome = audit.OutcomeError
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			origin = r.RemoteAddr
+		}
+
+		if err := auditLog.Append(audit.Record{
+			Timestamp:   start,
+			Origin:      origin,
+			Endpoint:    endpoint,
+			Device:      device,
+			Status:      rec.status,
+			Outcome:     outcome,
+			RequestHash: audit.HashRequest(body),
+		}); err != nil {
+			logger.Critical().WithError(err).Errorf("failed to write audit record for %s", endpoint)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/util/logging"
+
+	"github.com/therealssj/testingdep2/src/audit"
+)
+
+func TestAuditHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	auditLog, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+
+	var logs bytes.Buffer
+	logging.AddHook(logging.NewWriteHook(&logs))
+
+	const secret = "cloud flower upset remain green metal below cup stem infant art thank"
+	body := `{"mnemonic": "` + secret + `"}`
+
+	var received string
+	handler := auditHandler(auditLog, "/api/v1/setup_mnemonic", "USB", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received = string(b)
+		writeHTTPResponse(w, NewHTTPErrorResponse(http.StatusConflict, "Device is already initialized"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/setup_mnemonic", strings.NewReader(body))
+	req.Header.Set("Origin", "http://127.0.0.1:8000")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	checkHTTPResponse(t, rr, http.StatusConflict, "", nil)
+	if received != body {
+		t.Fatalf("the handler received %q instead of the request body", received)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"request_hash":"`+audit.HashRequest([]byte(body))+`"`) {
+		t.Fatalf("the record doesn't hold the hash of the body: %s", b)
+	}
+	for _, s := range []string{
+		`"origin":"http://127.0.0.1:8000"`,
+		`"endpoint":"/api/v1/setup_mnemonic"`,
+		`"status":409`,
+		`"outcome":"error"`,
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Fatalf("the record doesn't contain %s: %s", s, b)
+		}
+	}
+
+	// a failing append is logged without the body
+	if err := auditLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/setup_mnemonic", strings.NewReader(body))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(logs.String(), "failed to write audit record") {
+		t.Fatalf("the failed append wasn't logged: %s", logs.String())
+	}
+
+	for name, s := range map[string]string{
+		"audit log": string(b),
+		"logs":      logs.String(),
+	} {
+		if strings.Contains(s, secret) {
+			t.Fatalf("the request body is in the %s", name)
+		}
+	}
+}
+
+func TestAuditHandlerBodyTooLarge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+
+	handler := auditHandler(auditLog, "/api/v1/transaction_sign", "USB", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("the handler was called with a body over the limit")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/transaction_sign", bytes.NewReader(make([]byte, maxAuditedBodySize+1)))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	checkHTTPResponse(t, rr, http.StatusRequestEntityTooLarge, "", nil)
+}
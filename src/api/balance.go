@@ -0,0 +1,168 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/therealssj/testingdep2/src/node"
+)
+
+// Balance is an amount of coins and coin hours
+type Balance struct {
+	Coins string `json:"coins"`
+	Hours uint64 `json:"hours"`
+}
+
+// AddressBalance is the balance of a device address
+type AddressBalance struct {
+	Index     int     `json:"index"`
+	Address   string  `json:"address"`
+	Confirmed Balance `json:"confirmed"`
+	Predicted Balance `json:"predicted"`
+}
+
+// BalanceResponse is data returned by /api/v1/balance
+type BalanceResponse struct {
+	Confirmed Balance          `json:"confirmed"`
+	Predicted Balance          `json:"predicted"`
+	Addresses []AddressBalance `json:"addresses"`
+}
+
+// newBalance formats a node balance
+func newBalance(b node.Balance) (Balance, error) {
+	coins, err := droplet.ToString(b.Coins)
+	if err != nil {
+		return Balance{}, err
+	}
+
+	return Balance{
+		Coins: coins,
+		Hours: b.Hours,
+	}, nil
+}
+
+// balance returns the balance of address_n device addresses from start_index, as seen by the
+// Skycoin node. Addresses that aren't cached are derived. The predicted balance includes
+// unconfirmed transactions.
+// URI: /api/v1/balance
+// Method: GET
+// Args: start_index [int], address_n [int] query parameters
+func balance(gateway Gatewayer, cache *addressCache, batchSize int, client *node.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		startIndex, ok := queryIndex(w, r, "start_index")
+		if !ok {
+			return
+		}
+		addressN, ok := queryIndex(w, r, "address_n")
+		if !ok {
+			return
+		}
+		if addressN == 0 {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, "address_n cannot be 0")
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if addressN > maxDiscoveredAddresses {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, fmt.Sprintf("address_n cannot be more than %d", maxDiscoveredAddresses))
+			writeHTTPResponse(w, resp)
+			return
+		}
+		// address indexes are uint32, the last requested address must have one
+		if uint64(startIndex)+uint64(addressN)-1 > math.MaxUint32 {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, "start_index+address_n is past the last address index")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if client == nil {
+			resp := NewHTTPErrorResponse(http.StatusServiceUnavailable, "no skycoin node is configured")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		var addresses []string
+		key, msg, err := addressCacheKey(gateway, cache)
+		if err == nil && msg == nil {
+			addresses, msg, err = deriveAddresses(gateway, cache, key, batchSize, startIndex, addressN)
+		}
+		if err != nil {
+			logger.Error("balance failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		balances, err := client.Balance(addresses)
+		if err != nil {
+			logger.Error("balance failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(http.StatusBadGateway, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		data, err := newBalanceResponse(startIndex, addresses, balances)
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusBadGateway, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: data,
+		})
+	}
+}
+
+// newBalanceResponse sums the balances of the addresses derived from startIndex
+func newBalanceResponse(startIndex int, addresses []string, balances *node.BalanceResponse) (BalanceResponse, error) {
+	var confirmed, predicted node.Balance
+	resp := BalanceResponse{
+		Addresses: make([]AddressBalance, len(addresses)),
+	}
+
+	for i, a := range addresses {
+		b := balances.Addresses[a]
+		confirmed.Coins += b.Confirmed.Coins
+		confirmed.Hours += b.Confirmed.Hours
+		predicted.Coins += b.Predicted.Coins
+		predicted.Hours += b.Predicted.Hours
+
+		ab := AddressBalance{
+			Index:   startIndex + i,
+			Address: a,
+		}
+
+		var err error
+		if ab.Confirmed, err = newBalance(b.Confirmed); err != nil {
+			return BalanceResponse{}, err
+		}
+		if ab.Predicted, err = newBalance(b.Predicted); err != nil {
+			return BalanceResponse{}, err
+		}
+
+		resp.Addresses[i] = ab
+	}
+
+	var err error
+	if resp.Confirmed, err = newBalance(confirmed); err != nil {
+		return BalanceResponse{}, err
+	}
+	if resp.Predicted, err = newBalance(predicted); err != nil {
+		return BalanceResponse{}, err
+	}
+
+	return resp, nil
+}
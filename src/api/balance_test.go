@@ -0,0 +1,142 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+
+	"github.com/therealssj/testingdep2/src/node"
+)
+
+func TestBalance(t *testing.T) {
+	client := testNode{balances: map[string]node.BalancePair{
+		"address0": {
+			Confirmed: node.Balance{Coins: 1500000, Hours: 10},
+			Predicted: node.Balance{Coins: 1000000, Hours: 8},
+		},
+		"address1": {
+			Confirmed: node.Balance{Coins: 2000000, Hours: 1},
+			Predicted: node.Balance{Coins: 2000000, Hours: 1},
+		},
+	}}.start(t)
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "ok",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 0, 2)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{2, 0, false}},
+			},
+			status: http.StatusOK,
+			data: BalanceResponse{
+				Confirmed: Balance{Coins: "3.500000", Hours: 11},
+				Predicted: Balance{Coins: "3.000000", Hours: 9},
+				Addresses: []AddressBalance{
+					{
+						Index:     0,
+						Address:   "address0",
+						Confirmed: Balance{Coins: "1.500000", Hours: 10},
+						Predicted: Balance{Coins: "1.000000", Hours: 8},
+					},
+					{
+						Index:     1,
+						Address:   "address1",
+						Confirmed: Balance{Coins: "2.000000", Hours: 1},
+						Predicted: Balance{Coins: "2.000000", Hours: 1},
+					},
+				},
+			},
+		},
+		{
+			name:   "pin requested",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_PinMatrixRequest, &messages.PinMatrixRequest{})),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{2, 0, false}},
+			},
+			status: http.StatusOK,
+			data:   "PinMatrixRequest",
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/balance?address_n=2", func(g Gatewayer) http.Handler {
+		return balance(g, newAddressCache(), defaultAddressBatchSize, client)
+	}, cases)
+
+	runHTTPTestCases(t, "/api/v1/balance?start_index=1&address_n=2", func(g Gatewayer) http.Handler {
+		return balance(g, newAddressCache(), defaultAddressBatchSize, client)
+	}, []httpTestCase{
+		{
+			name:   "node error",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 1, 2)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{2, 1, false}},
+			},
+			status: http.StatusBadGateway,
+			err:    "node returned 400: 400 Bad Request - unknown address address2",
+		},
+	})
+
+	runHTTPTestCases(t, "/api/v1/balance", func(g Gatewayer) http.Handler {
+		return balance(g, newAddressCache(), defaultAddressBatchSize, client)
+	}, []httpTestCase{
+		{
+			name:   "no address_n",
+			method: http.MethodGet,
+			status: http.StatusUnprocessableEntity,
+			err:    "address_n cannot be 0",
+		},
+	})
+
+	runHTTPTestCases(t, "/api/v1/balance?address_n=10001", func(g Gatewayer) http.Handler {
+		return balance(g, newAddressCache(), defaultAddressBatchSize, client)
+	}, []httpTestCase{
+		{
+			name:   "too many addresses",
+			method: http.MethodGet,
+			status: http.StatusUnprocessableEntity,
+			err:    "address_n cannot be more than 10000",
+		},
+	})
+
+	runHTTPTestCases(t, "/api/v1/balance?start_index=4294967295&address_n=2", func(g Gatewayer) http.Handler {
+		return balance(g, newAddressCache(), defaultAddressBatchSize, client)
+	}, []httpTestCase{
+		{
+			name:   "index overflow",
+			method: http.MethodGet,
+			status: http.StatusUnprocessableEntity,
+			err:    "start_index+address_n is past the last address index",
+		},
+	})
+
+	runHTTPTestCases(t, "/api/v1/balance?address_n=2", func(g Gatewayer) http.Handler {
+		return balance(g, newAddressCache(), defaultAddressBatchSize, nil)
+	}, []httpTestCase{
+		{
+			name:   "no node",
+			method: http.MethodGet,
+			status: http.StatusServiceUnavailable,
+		},
+	})
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	wh "github.com/skycoin/skycoin/src/util/http"
+
+	"github.com/therealssj/testingdep2/src/bundle"
+	"github.com/therealssj/testingdep2/src/node"
+	"github.com/therealssj/testingdep2/src/policy"
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+// BundleExportRequest is request data for /api/v1/bundle/export
+type BundleExportRequest struct {
+	To []SendDestination `json:"to"`
+	// Addresses are the device addresses from index 0 whose outputs may be spent, the online
+	// machine has no access to the device
+	Addresses []string `json:"addresses"`
+	// ChangeIndex is the index in addresses of the address receiving the change,
+	// the address of the first spent output by default
+	ChangeIndex *uint32           `json:"change_index,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// BundleImportResponse is data returned by /api/v1/bundle/import
+type BundleImportResponse struct {
+	TxID string `json:"txid"`
+	// RawTx is the hex encoded serialized signed transaction
+	RawTx     string `json:"rawtx"`
+	Broadcast bool   `json:"broadcast"`
+}
+
+// bundleExport creates an unsigned offline signing bundle spending the unspent outputs of the
+// given addresses. It runs on the online machine and doesn't use the device.
+// URI: /api/v1/bundle/export
+// Method: POST
+// Args: JSON Body
+func bundleExport(client *node.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != ContentTypeJSON {
+			resp := NewHTTPErrorResponse(http.StatusUnsupportedMediaType, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		var req BundleExportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusBadRequest, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		defer r.Body.Close()
+
+		sendReq := SendRequest{
+			To:       req.To,
+			AddressN: len(req.Addresses),
+		}
+		destinations, err := sendReq.destinations()
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		changeAddress, err := req.changeAddress()
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if client == nil {
+			resp := NewHTTPErrorResponse(http.StatusServiceUnavailable, "no skycoin node is configured")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		unspents, err := spendableOutputs(client, req.Addresses)
+		if err != nil {
+			logger.Error("bundleExport failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(http.StatusBadGateway, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		spend, err := transaction.Create(unspents, destinations, changeAddress)
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		b := newBundle(spend, req.Addresses, req.ChangeIndex, req.Metadata)
+		if err := b.Seal(); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusInternalServerError, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: b,
+		})
+	}
+}
+
+// bundleSign signs an offline signing bundle with the device. The input and change addresses of
+// the bundle are checked against the addresses the device derives at their indices.
+// URI: /api/v1/bundle/sign
+// Method: POST
+// Args: JSON Body, an unsigned bundle
+func bundleSign(gateway Gatewayer, cache *addressCache, engine *policy.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != ContentTypeJSON {
+			resp := NewHTTPErrorResponse(http.StatusUnsupportedMediaType, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		b, err := bundle.Read(r.Body)
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		defer r.Body.Close()
+
+		if b.Signed() {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, bundle.ErrSigned.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		key, msg, err := addressCacheKey(gateway, cache)
+		if err != nil {
+			logger.Error("bundleSign failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		signReq := newBundleSignRequest(b)
+		addresses, msg, err := deviceAddressesAt(gateway, cache, key, signReq.addressIndices())
+		if err != nil {
+			logger.Error("bundleSign failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		if err := verifyBundleAddresses(b, addresses); err != nil {
+			logger.WithError(err).Warn("bundleSign rejected a bundle")
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if _, ok := signAuthorized(w, r, gateway, engine, signReq, b.AddSignatures); !ok {
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: b,
+		})
+	}
+}
+
+// bundleImport finalizes a signed offline signing bundle into a transaction and optionally
+// broadcasts it. It runs on the online machine and doesn't use the device.
+// URI: /api/v1/bundle/import
+// Method: POST
+// Args: JSON Body, a signed bundle, and broadcast [bool] query parameter
+func bundleImport(client *node.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != ContentTypeJSON {
+			resp := NewHTTPErrorResponse(http.StatusUnsupportedMediaType, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		broadcast := r.URL.Query().Get("broadcast") == "true"
+
+		b, err := bundle.Read(r.Body)
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		defer r.Body.Close()
+
+		txn, err := b.Finalize()
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		data := BundleImportResponse{
+			TxID:  txn.Hash().Hex(),
+			RawTx: hex.EncodeToString(txn.Serialize()),
+		}
+
+		if broadcast {
+			if client == nil {
+				resp := NewHTTPErrorResponse(http.StatusServiceUnavailable, "no skycoin node is configured")
+				writeHTTPResponse(w, resp)
+				return
+			}
+
+			if _, err := client.InjectTransaction(data.RawTx); err != nil {
+				logger.Error("bundleImport failed: %s", err.Error())
+				resp := NewHTTPErrorResponse(http.StatusBadGateway, err.Error())
+				writeHTTPResponse(w, resp)
+				return
+			}
+			data.Broadcast = true
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: data,
+		})
+	}
+}
+
+// changeAddress returns the change address of the request, nil if it isn't set
+func (req BundleExportRequest) changeAddress() (*cipher.Address, error) {
+	for i, a := range req.Addresses {
+		if _, err := cipher.DecodeBase58Address(a); err != nil {
+			return nil, fmt.Errorf("address %d: invalid address: %v", i, err)
+		}
+	}
+
+	if req.ChangeIndex == nil {
+		return nil, nil
+	}
+	if int(*req.ChangeIndex) >= len(req.Addresses) {
+		return nil, fmt.Errorf("change_index %d is not the index of an address", *req.ChangeIndex)
+	}
+
+	addr := cipher.MustDecodeBase58Address(req.Addresses[*req.ChangeIndex])
+	return &addr, nil
+}
+
+// newBundle describes the spend as an unsigned bundle, the change output has the index of the
+// address receiving it
+func newBundle(spend *transaction.Spend, addresses []string, changeIndex *uint32, metadata map[string]string) *bundle.Bundle {
+	data := newSendResponse(spend, addresses, changeIndex)
+
+	b := &bundle.Bundle{
+		Version:   bundle.Version,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Metadata:  metadata,
+		Inputs:    make([]bundle.Input, len(spend.Inputs)),
+		Outputs:   make([]bundle.Output, len(data.Outputs)),
+	}
+
+	for i, in := range spend.Inputs {
+		b.Inputs[i] = bundle.Input{
+			Hash:         in.Hash.Hex(),
+			Address:      in.Address.String(),
+			AddressIndex: data.Inputs[i].Index,
+			Coins:        wh.Coins(in.Coins),
+			Hours:        wh.Hours(in.Hours),
+		}
+	}
+
+	for i, o := range data.Outputs {
+		b.Outputs[i] = bundle.Output(o)
+	}
+
+	return b
+}
+
+// newBundleSignRequest describes the inputs and outputs of the bundle for the device
+func newBundleSignRequest(b *bundle.Bundle) TransactionSignRequest {
+	req := TransactionSignRequest{
+		TransactionInputs:  make([]TransactionInput, len(b.Inputs)),
+		TransactionOutputs: make([]TransactionOutput, len(b.Outputs)),
+	}
+
+	for i, in := range b.Inputs {
+		req.TransactionInputs[i] = TransactionInput{
+			Index: in.AddressIndex,
+			Hash:  in.Hash,
+		}
+	}
+
+	for i, o := range b.Outputs {
+		req.TransactionOutputs[i] = TransactionOutput(o)
+	}
+
+	return req
+}
+
+// verifyBundleAddresses checks that the input and change addresses of the bundle are the device
+// addresses at their indices
+func verifyBundleAddresses(b *bundle.Bundle, addresses map[uint32]string) error {
+	for i, in := range b.Inputs {
+		if addresses[in.AddressIndex] != in.Address {
+			return fmt.Errorf("bundle input %d: %s is not the device address at index %d", i, in.Address, in.AddressIndex)
+		}
+	}
+
+	return verifyChangeOutputs(newBundleSignRequest(b).TransactionOutputs, addresses)
+}
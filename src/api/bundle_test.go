@@ -0,0 +1,261 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/skycoin/skycoin/src/cipher"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+
+	"github.com/therealssj/testingdep2/src/bundle"
+	"github.com/therealssj/testingdep2/src/node"
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+// newBundleFixture returns an unsigned bundle spending an output of the device address at index 1,
+// its signature and the keys of the device addresses
+func newBundleFixture(t *testing.T) (*bundle.Bundle, cipher.Sig, []cipher.SecKey) {
+	keys, err := cipher.GenerateDeterministicKeyPairs([]byte("bundle"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change := uint32(1)
+	b := &bundle.Bundle{
+		Version:   bundle.Version,
+		CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Inputs: []bundle.Input{
+			{
+				Hash:         cipher.SumSHA256([]byte("unspent")).Hex(),
+				Address:      cipher.MustAddressFromSecKey(keys[1]).String(),
+				AddressIndex: 1,
+				Coins:        5000000,
+				Hours:        20,
+			},
+		},
+		Outputs: []bundle.Output{
+			{Address: newTestAddresses(t, 1)[0], Coins: 2000000, Hours: 5},
+			{Address: cipher.MustAddressFromSecKey(keys[1]).String(), AddressIndex: &change, Coins: 3000000, Hours: 5},
+		},
+	}
+	if err := b.Seal(); err != nil {
+		t.Fatal(err)
+	}
+
+	txn, err := b.Transaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := cipher.MustSignHash(transaction.SignatureHash(txn.InnerHash, txn.In[0]), keys[1])
+
+	return b, sig, keys
+}
+
+func bundleJSON(t *testing.T, b *bundle.Bundle) string {
+	var buf bytes.Buffer
+	if err := b.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestBundleExport(t *testing.T) {
+	keys, err := cipher.GenerateDeterministicKeyPairs([]byte("bundle"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses := []string{
+		cipher.MustAddressFromSecKey(keys[0]).String(),
+		cipher.MustAddressFromSecKey(keys[1]).String(),
+	}
+	dest := newTestAddresses(t, 1)[0]
+	uxHash := cipher.SumSHA256([]byte("unspent"))
+
+	client := testNode{
+		outputs: []node.UnspentOutput{
+			{
+				Hash:            uxHash.Hex(),
+				Address:         addresses[1],
+				Coins:           "5.000000",
+				CalculatedHours: 20,
+			},
+		},
+	}.start(t)
+
+	body := fmt.Sprintf(`{"to": [{"address": "%s", "coins": "2"}], "addresses": ["%s", "%s"], "metadata": {"description": "rent"}}`,
+		dest, addresses[0], addresses[1])
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/bundle/export", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", ContentTypeJSON)
+	rr := httptest.NewRecorder()
+	bundleExport(client).ServeHTTP(rr, req)
+
+	checkHTTPResponse(t, rr, http.StatusOK, "", nil)
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bundle.Read(bytes.NewReader(resp.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Signed() || b.Metadata["description"] != "rent" {
+		t.Fatalf("unexpected bundle %+v", b)
+	}
+
+	expected, _, _ := newBundleFixture(t)
+	if fmt.Sprint(b.Inputs) != fmt.Sprint(expected.Inputs) || len(b.Outputs) != 2 ||
+		b.Outputs[0] != expected.Outputs[0] || *b.Outputs[1].AddressIndex != 1 {
+		t.Fatalf("unexpected bundle %+v", b)
+	}
+
+	runHTTPTestCases(t, "/api/v1/bundle/export", func(g Gatewayer) http.Handler {
+		return bundleExport(client)
+	}, []httpTestCase{
+		{
+			name:        "invalid change index",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        fmt.Sprintf(`{"to": [{"address": "%s", "coins": "2"}], "addresses": ["%s"], "change_index": 1}`, dest, addresses[0]),
+			status:      http.StatusUnprocessableEntity,
+			err:         "change_index 1 is not the index of an address",
+		},
+	})
+}
+
+func TestBundleSign(t *testing.T) {
+	b, sig, keys := newBundleFixture(t)
+	unsigned := bundleJSON(t, b)
+
+	signed := *b
+	if err := signed.AddSignatures([]string{sig.Hex()}); err != nil {
+		t.Fatal(err)
+	}
+
+	addressAt := func(k cipher.SecKey) mockResponse {
+		return respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, &messages.ResponseSkycoinAddress{
+			Addresses: []string{cipher.MustAddressFromSecKey(k).String()},
+		}))
+	}
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "already signed",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        bundleJSON(t, &signed),
+			status:      http.StatusUnprocessableEntity,
+			err:         bundle.ErrSigned.Error(),
+		},
+		{
+			name:        "input address is not a device address",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        unsigned,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				addressAt(keys[0]),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 1, false}},
+			},
+			status: http.StatusUnprocessableEntity,
+			err:    fmt.Sprintf("bundle input 0: %s is not the device address at index 1", b.Inputs[0].Address),
+		},
+		{
+			name:        "ok",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        unsigned,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				addressAt(keys[1]),
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseTransactionSign, &messages.ResponseTransactionSign{
+					Signatures: []string{sig.Hex()},
+					Finished:   proto.Bool(true),
+				})),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 1, false}},
+				{Method: "TransactionSign", Args: []interface{}{
+					[]*messages.SkycoinTransactionInput{
+						{HashIn: proto.String(b.Inputs[0].Hash), Index: proto.Uint32(1)},
+					},
+					[]*messages.SkycoinTransactionOutput{
+						{Address: proto.String(b.Outputs[0].Address), Coin: proto.Uint64(2000000), Hour: proto.Uint64(5)},
+						{Address: proto.String(b.Outputs[1].Address), AddressIndex: proto.Uint32(1), Coin: proto.Uint64(3000000), Hour: proto.Uint64(5)},
+					},
+				}},
+			},
+			status: http.StatusOK,
+			data:   signed,
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/bundle/sign", func(g Gatewayer) http.Handler {
+		return bundleSign(g, newAddressCache(), nil)
+	}, cases)
+}
+
+func TestBundleImport(t *testing.T) {
+	b, sig, _ := newBundleFixture(t)
+	unsigned := bundleJSON(t, b)
+	if err := b.AddSignatures([]string{sig.Hex()}); err != nil {
+		t.Fatal(err)
+	}
+	txn, err := b.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawTx := hex.EncodeToString(txn.Serialize())
+
+	injected := make(chan string, 1)
+	client := testNode{injected: injected}.start(t)
+
+	cases := []httpTestCase{
+		{
+			name:        "unsigned",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        unsigned,
+			status:      http.StatusUnprocessableEntity,
+			err:         bundle.ErrUnsigned.Error(),
+		},
+		{
+			name:        "ok",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        bundleJSON(t, b),
+			status:      http.StatusOK,
+			data: BundleImportResponse{
+				TxID:      txn.Hash().Hex(),
+				RawTx:     rawTx,
+				Broadcast: true,
+			},
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/bundle/import?broadcast=true", func(g Gatewayer) http.Handler {
+		return bundleImport(client)
+	}, cases)
+
+	if tx := <-injected; tx != rawTx {
+		t.Fatalf("unexpected broadcast transaction %s", tx)
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/therealssj/testingdep2/src/node"
+)
+
+const (
+	// defaultDiscoveryGapLimit is the number of consecutive unused addresses ending a discovery
+	defaultDiscoveryGapLimit = 20
+	// maxDiscoveredAddresses bounds the addresses a discovery derives
+	maxDiscoveredAddresses = 10000
+)
+
+// DiscoverAddressesResponse is data returned by /api/v1/discover_addresses
+type DiscoverAddressesResponse struct {
+	// Used are the addresses with a transaction history
+	Used []CachedAddress `json:"used"`
+	// NextIndex is the index of the first address after the last used one
+	NextIndex int `json:"next_index"`
+}
+
+// discoverAddresses finds the used addresses of the device: it derives addresses in batches and
+// asks the Skycoin node for their transaction history until gap_limit consecutive addresses are unused.
+// URI: /api/v1/discover_addresses
+// Method: GET
+// Args: gap_limit [int] query parameter, the configured gap limit by default
+func discoverAddresses(gateway Gatewayer, cache *addressCache, batchSize, gapLimit int, client *node.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		gap, ok := queryIndex(w, r, "gap_limit")
+		if !ok {
+			return
+		}
+		if gap == 0 {
+			gap = gapLimit
+		}
+		if gap > maxDiscoveredAddresses {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, fmt.Sprintf("gap_limit cannot be more than %d", maxDiscoveredAddresses))
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if client == nil {
+			resp := NewHTTPErrorResponse(http.StatusServiceUnavailable, "no skycoin node is configured")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		key, msg, err := addressCacheKey(gateway, cache)
+		if err != nil {
+			logger.Error("discoverAddresses failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		data := DiscoverAddressesResponse{
+			Used: []CachedAddress{},
+		}
+
+		for start := 0; start-data.NextIndex < gap; start += batchSize {
+			if start >= maxDiscoveredAddresses {
+				resp := NewHTTPErrorResponse(http.StatusBadGateway, fmt.Sprintf("more than %d addresses were derived", maxDiscoveredAddresses))
+				writeHTTPResponse(w, resp)
+				return
+			}
+
+			addresses, msg, err := deriveAddresses(gateway, cache, key, batchSize, start, batchSize)
+			if err != nil {
+				logger.Error("discoverAddresses failed: %s", err.Error())
+				resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+				writeHTTPResponse(w, resp)
+				return
+			}
+			if msg != nil {
+				HandleFirmwareResponseMessages(w, r, gateway, *msg)
+				return
+			}
+
+			used, err := client.UsedAddresses(addresses)
+			if err != nil {
+				logger.Error("discoverAddresses failed: %s", err.Error())
+				resp := NewHTTPErrorResponse(http.StatusBadGateway, err.Error())
+				writeHTTPResponse(w, resp)
+				return
+			}
+
+			for i, a := range addresses {
+				if !used[a] {
+					continue
+				}
+				data.Used = append(data.Used, CachedAddress{
+					Index:   start + i,
+					Address: a,
+				})
+				data.NextIndex = start + i + 1
+			}
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: data,
+		})
+	}
+}
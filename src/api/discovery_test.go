@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDiscoverAddresses(t *testing.T) {
+	client := testNode{used: map[string]bool{
+		"address0": true,
+		"address3": true,
+		"address9": true,
+	}}.start(t)
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "gap after the last used address",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 0, 4)),
+				respondWith(newAddressesMessage(t, 4, 4)),
+				respondWith(newAddressesMessage(t, 8, 4)),
+				respondWith(newAddressesMessage(t, 12, 4)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 0, false}},
+				{Method: "AddressGen", Args: []interface{}{4, 4, false}},
+				{Method: "AddressGen", Args: []interface{}{4, 8, false}},
+				{Method: "AddressGen", Args: []interface{}{4, 12, false}},
+			},
+			status: http.StatusOK,
+			data: DiscoverAddressesResponse{
+				Used:      []CachedAddress{{0, "address0"}, {3, "address3"}, {9, "address9"}},
+				NextIndex: 10,
+			},
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/discover_addresses?gap_limit=5", func(g Gatewayer) http.Handler {
+		return discoverAddresses(g, newAddressCache(), 4, defaultDiscoveryGapLimit, client)
+	}, cases)
+
+	runHTTPTestCases(t, "/api/v1/discover_addresses", func(g Gatewayer) http.Handler {
+		return discoverAddresses(g, newAddressCache(), 4, 2, client)
+	}, []httpTestCase{
+		{
+			name:   "configured gap limit",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newAddressesMessage(t, 0, 4)),
+				respondWith(newAddressesMessage(t, 4, 4)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{4, 0, false}},
+				{Method: "AddressGen", Args: []interface{}{4, 4, false}},
+			},
+			status: http.StatusOK,
+			data: DiscoverAddressesResponse{
+				Used:      []CachedAddress{{0, "address0"}, {3, "address3"}},
+				NextIndex: 4,
+			},
+		},
+		{
+			name:   "no device",
+			method: http.MethodGet,
+			responses: []mockResponse{
+				respondErr(errNoDeviceConnected),
+			},
+			calls:  []mockCall{{Method: "GetFeatures"}},
+			status: http.StatusServiceUnavailable,
+		},
+	})
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/driver"
+)
+
+// errNoDeviceConnected is the message of the error returned by the device wallet driver when no device is found
+const errNoDeviceConnected = "No device connected"
+
+// deviceErrorStatus maps an error talking to a device to an http status code.
+// A missing or lost device is 503, a device answer that can't be parsed is 502
+// and anything else is 500.
+func deviceErrorStatus(err error) int {
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF, driver.ErrFaultClosed:
+		return http.StatusServiceUnavailable
+	case wire.ErrMalformedMessage, driver.ErrMessageTooLarge, driver.ErrUnknownMessageKind, driver.ErrShortPacket:
+		return http.StatusBadGateway
+	}
+
+	switch err.(type) {
+	case driver.InvalidPayloadError, shortAddressesError:
+		return http.StatusBadGateway
+	}
+
+	// the usb package's disconnect error is unexported, it is matched by message
+	switch err.Error() {
+	case driver.ErrDisconnected.Error(), errNoDeviceConnected:
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
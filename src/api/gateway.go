@@ -2,9 +2,13 @@ package api
 
 import (
 	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/driver"
 )
 
 //go:generate mockery -name Gatewayer -case underscore -inpkg -testonly
+//go:generate mv mock_gatewayer_test.go gatewayer_mock_test.go
 
 // Gateway bundles both USB and Emulator device into a single object
 type Gateway struct {
@@ -12,8 +16,11 @@ type Gateway struct {
 	EmulatorDevice *deviceWallet.Device
 }
 
-// NewGateway creates a Gateway
+// NewGateway creates a Gateway, the devices' drivers are instrumented for metrics
 func NewGateway(usb, emu *deviceWallet.Device) *Gateway {
+	instrumentDevice(usb)
+	instrumentDevice(emu)
+
 	return &Gateway{
 		usb,
 		emu,
@@ -24,3 +31,69 @@ func NewGateway(usb, emu *deviceWallet.Device) *Gateway {
 type Gatewayer interface {
 	deviceWallet.Devicer
 }
+
+// validateDeviceMessages makes the device reject oversized, unknown or malformed messages
+// before they are parsed
+func validateDeviceMessages(d *deviceWallet.Device, maxSize uint32) {
+	if d == nil || d.Driver == nil {
+		return
+	}
+
+	if drv, ok := d.Driver.(*driver.ValidatingDriver); ok {
+		if maxSize != 0 {
+			drv.MaxMessageSize = maxSize
+		}
+		return
+	}
+
+	d.Driver = driver.NewValidatingDriver(d.Driver, maxSize)
+}
+
+// recordDeviceTraffic records the device's traffic to rec
+func recordDeviceTraffic(d *deviceWallet.Device, rec *driver.Recorder) {
+	if d == nil || d.Driver == nil {
+		return
+	}
+
+	d.Driver = driver.NewRecordingDriver(d.Driver, rec)
+}
+
+// keepDeviceConnected makes the device keep its connection open across calls. The persistent
+// driver goes below the metrics driver so that failures to reconnect are still counted.
+func keepDeviceConnected(d *deviceWallet.Device, cfg driver.PersistentConfig) *driver.PersistentDriver {
+	if d == nil || d.Driver == nil {
+		return nil
+	}
+
+	if m, ok := d.Driver.(*metricsDriver); ok {
+		p := driver.NewPersistentDriver(m.DeviceDriver, cfg)
+		m.DeviceDriver = p
+		return p
+	}
+
+	p := driver.NewPersistentDriver(d.Driver, cfg)
+	d.Driver = p
+	return p
+}
+
+// persistentDevice is a device whose connection is kept open by a driver.PersistentDriver
+type persistentDevice struct {
+	*deviceWallet.Device
+}
+
+// PinMatrixAck sends the PIN without the delay Device.PinMatrixAck waits for the device to
+// become available again after the previous connection was closed
+func (d persistentDevice) PinMatrixAck(p string) (wire.Message, error) {
+	dev, err := d.Driver.GetDevice()
+	if err != nil {
+		return wire.Message{}, err
+	}
+	defer dev.Close()
+
+	chunks, err := deviceWallet.MessagePinMatrixAck(p)
+	if err != nil {
+		return wire.Message{}, err
+	}
+
+	return d.Driver.SendToDevice(dev, chunks)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+
+	"github.com/therealssj/testingdep2/src/driver"
+)
+
+func TestPersistentConnections(t *testing.T) {
+	sim := driver.NewSimulator(driver.SimulatorConfig{Mnemonic: resilienceMnemonic})
+	usb := &deviceWallet.Device{Driver: sim}
+
+	s, err := create(testHost, Config{PersistentConnections: true}, NewGateway(usb, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.drivers) != 1 {
+		t.Fatalf("expected a persistent driver for the usb device, got %d", len(s.drivers))
+	}
+	defer s.drivers[0].Close()
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/generate_addresses", bytes.NewBufferString(`{"address_n": 2}`))
+		req.Header.Set("Content-Type", ContentTypeJSON)
+		rr := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rr, req)
+
+		checkHTTPResponse(t, rr, http.StatusOK, "", nil)
+	}
+
+	if !s.drivers[0].Connected() {
+		t.Fatal("device connection was not kept open")
+	}
+}
+
+func TestPersistentDevicePinMatrixAck(t *testing.T) {
+	sim := driver.NewSimulator(driver.SimulatorConfig{
+		Mnemonic: resilienceMnemonic,
+		PIN:      "1234",
+	})
+	drv := driver.NewPersistentDriver(sim, driver.PersistentConfig{})
+	defer drv.Close()
+	d := persistentDevice{&deviceWallet.Device{Driver: drv}}
+
+	msg, err := d.AddressGen(1, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Kind != uint16(messages.MessageType_MessageType_PinMatrixRequest) {
+		t.Fatalf("expected PinMatrixRequest, got %s", messages.MessageType(msg.Kind))
+	}
+
+	start := time.Now()
+	msg, err = d.PinMatrixAck("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Kind != uint16(messages.MessageType_MessageType_ResponseSkycoinAddress) {
+		t.Fatalf("expected ResponseSkycoinAddress, got %s", messages.MessageType(msg.Kind))
+	}
+	// Device.PinMatrixAck sleeps for a second before sending the PIN
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("PinMatrixAck took %s", elapsed)
+	}
+}
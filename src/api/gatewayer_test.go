@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+)
+
+// mockResponse is the answer of a MockGatewayer call
+type mockResponse struct {
+	msg wire.Message
+	err error
+}
+
+// mockCall is a call expected by a MockGatewayer
+type mockCall struct {
+	Method string
+	Args   []interface{}
+}
+
+// newMockGatewayer returns a MockGatewayer expecting calls in order, each call is answered with
+// the response at the same position
+func newMockGatewayer(t *testing.T, calls []mockCall, responses []mockResponse) *MockGatewayer {
+	t.Helper()
+
+	if len(calls) != len(responses) {
+		t.Fatalf("%d calls are answered with %d responses", len(calls), len(responses))
+	}
+
+	gateway := &MockGatewayer{}
+	gateway.Test(t)
+	for i, c := range calls {
+		call := gateway.On(c.Method, c.Args...)
+		switch c.Method {
+		case "FirmwareUpload", "SetAutoPressButton":
+			call.Return(responses[i].err)
+		default:
+			call.Return(responses[i].msg, responses[i].err)
+		}
+		call.Once()
+	}
+
+	return gateway
+}
+
+// assertGatewayCalls checks that the gateway received the expected calls in order
+func assertGatewayCalls(t *testing.T, gateway *MockGatewayer, expected []mockCall) {
+	t.Helper()
+
+	gateway.AssertExpectations(t)
+
+	calls := make([]mockCall, len(gateway.Calls))
+	for i, c := range gateway.Calls {
+		calls[i] = mockCall{
+			Method: c.Method,
+			Args:   []interface{}(c.Arguments),
+		}
+		if len(c.Arguments) == 0 {
+			calls[i].Args = nil
+		}
+	}
+	if len(expected) == 0 && len(calls) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(expected, calls) {
+		t.Fatalf("expected calls %v, got %v", expected, calls)
+	}
+}
+
+// newWireMessage encodes pb as a device answer of the given kind
+func newWireMessage(t *testing.T, kind messages.MessageType, pb proto.Message) wire.Message {
+	t.Helper()
+
+	data, err := proto.Marshal(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return wire.Message{
+		Kind: uint16(kind),
+		Data: data,
+	}
+}
+
+func respondWith(msg wire.Message) mockResponse {
+	return mockResponse{msg: msg}
+}
+
+func respondErr(format string, args ...interface{}) mockResponse {
+	return mockResponse{err: fmt.Errorf(format, args...)}
+}
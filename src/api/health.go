@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/therealssj/testingdep1/src/device-wallet/usb"
+)
+
+const (
+	// emulatorAddress is the UDP endpoint the emulator listens on
+	emulatorAddress     = "127.0.0.1:21324"
+	emulatorPingTimeout = 700 * time.Millisecond
+
+	// errMockUSB is reported instead of the usb backends state in mock mode, they aren't initialized
+	errMockUSB = "mock mode, the usb backends are not used"
+)
+
+var (
+	emulatorPing = []byte("PINGPING")
+	emulatorPong = []byte("PONGPONG")
+)
+
+// BuildInfo represents the build info of the daemon
+type BuildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Branch  string `json:"branch"`
+}
+
+// VersionResponse is returned by /api/v1/version
+type VersionResponse struct {
+	BuildInfo
+	GoVersion  string `json:"go_version"`
+	APIVersion string `json:"api_version"`
+}
+
+// USBHealth reports whether the usb backends initialized
+type USBHealth struct {
+	WebUSB      bool   `json:"webusb"`
+	WebUSBError string `json:"webusb_error,omitempty"`
+	HIDAPI      bool   `json:"hidapi"`
+	HIDAPIError string `json:"hidapi_error,omitempty"`
+}
+
+// EmulatorHealth reports whether the emulator answers on its UDP endpoint
+type EmulatorHealth struct {
+	Address   string `json:"address"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HealthResponse is returned by /api/v1/health
+type HealthResponse struct {
+	Version  VersionResponse `json:"version"`
+	Listener string          `json:"listener"`
+	USB      USBHealth       `json:"usb"`
+	Emulator EmulatorHealth  `json:"emulator"`
+}
+
+func newVersionResponse(b BuildInfo) VersionResponse {
+	return VersionResponse{
+		BuildInfo:  b,
+		GoVersion:  runtime.Version(),
+		APIVersion: apiVersion1,
+	}
+}
+
+// version returns the daemon version
+// URI: /api/v1/version
+// Method: GET
+func version(b BuildInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: newVersionResponse(b),
+		})
+	}
+}
+
+// health returns the state of the daemon's device backends
+// URI: /api/v1/health
+// Method: GET
+func health(c muxConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: HealthResponse{
+				Version:  newVersionResponse(c.buildInfo),
+				Listener: c.host,
+				USB:      c.usbHealth,
+				Emulator: checkEmulatorHealth(emulatorAddress),
+			},
+		})
+	}
+}
+
+// checkUSBHealth initializes both usb backends and releases them again. It is called once
+// when the daemon starts, health reports the recorded result.
+func checkUSBHealth() USBHealth {
+	var h USBHealth
+
+	webUSB, err := usb.InitWebUSB()
+	if err != nil {
+		h.WebUSBError = err.Error()
+	} else {
+		h.WebUSB = true
+		webUSB.Close()
+	}
+
+	if _, err := usb.InitHIDAPI(); err != nil {
+		h.HIDAPIError = err.Error()
+	} else {
+		h.HIDAPI = true
+	}
+
+	return h
+}
+
+// checkEmulatorHealth pings the emulator the same way the usb package does when enumerating
+func checkEmulatorHealth(address string) EmulatorHealth {
+	h := EmulatorHealth{
+		Address: address,
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(emulatorPingTimeout)); err != nil {
+		h.Error = err.Error()
+		return h
+	}
+
+	if _, err := conn.Write(emulatorPing); err != nil {
+		h.Error = err.Error()
+		return h
+	}
+
+	// the emulator also sends wire packets on this socket, skip them until the pong arrives
+	buf := make([]byte, 64)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			h.Error = err.Error()
+			return h
+		}
+		if n >= len(emulatorPong) && bytes.Equal(buf[:len(emulatorPong)], emulatorPong) {
+			h.Reachable = true
+			return h
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	b := BuildInfo{
+		Version: "1.2.3",
+		Commit:  "abcdef",
+		Branch:  "master",
+	}
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "version",
+			method: http.MethodGet,
+			status: http.StatusOK,
+			data: VersionResponse{
+				BuildInfo:  b,
+				GoVersion:  runtime.Version(),
+				APIVersion: apiVersion1,
+			},
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/version", func(Gatewayer) http.Handler {
+		return version(b)
+	}, cases)
+}
+
+func TestHealthMethodNotAllowed(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/health", nil)
+	rr := httptest.NewRecorder()
+	health(muxConfig{host: testHost}).ServeHTTP(rr, req)
+
+	checkHTTPResponse(t, rr, http.StatusMethodNotAllowed, "", nil)
+}
+
+func TestCheckEmulatorHealth(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// answer like the emulator, with a wire packet before the pong
+	go func() {
+		buf := make([]byte, 64)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil || string(buf[:n]) != string(emulatorPing) {
+			return
+		}
+		conn.WriteTo(make([]byte, 64), addr)
+		conn.WriteTo(emulatorPong, addr)
+	}()
+
+	h := checkEmulatorHealth(conn.LocalAddr().String())
+	if !h.Reachable {
+		t.Fatalf("emulator not reachable: %s", h.Error)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	usb := USBHealth{
+		WebUSBError: "libusb: init failed",
+		HIDAPI:      true,
+	}
+	b := BuildInfo{
+		Version: "1.2.3",
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	rr := httptest.NewRecorder()
+	health(muxConfig{host: testHost, buildInfo: b, usbHealth: usb}).ServeHTTP(rr, req)
+
+	checkHTTPResponse(t, rr, http.StatusOK, "", nil)
+
+	var resp struct {
+		Data HealthResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// the usb state recorded at startup is reported, the backends aren't initialized again
+	if resp.Data.USB != usb {
+		t.Fatalf("expected usb health %+v, got %+v", usb, resp.Data.USB)
+	}
+	if resp.Data.Version != newVersionResponse(b) {
+		t.Fatalf("expected version %+v, got %+v", newVersionResponse(b), resp.Data.Version)
+	}
+	if resp.Data.Listener != testHost {
+		t.Fatalf("expected listener %s, got %s", testHost, resp.Data.Listener)
+	}
+	if resp.Data.Emulator.Address != emulatorAddress {
+		t.Fatalf("expected emulator address %s, got %s", emulatorAddress, resp.Data.Emulator.Address)
+	}
+}
+
+func TestCreateMockUSBHealth(t *testing.T) {
+	s, err := create(testHost, Config{MockScenarioFile: "../mock/testdata/scenarios.json"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/health", nil)
+	rr := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rr, req)
+
+	checkHTTPResponse(t, rr, http.StatusOK, "", nil)
+
+	var resp struct {
+		Data HealthResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.USB.WebUSB || resp.Data.USB.HIDAPI || resp.Data.USB.WebUSBError != errMockUSB {
+		t.Fatalf("expected the usb backends to be unused in mock mode, got %+v", resp.Data.USB)
+	}
+}
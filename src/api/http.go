@@ -3,10 +3,12 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"mime"
 	"net"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/NYTimes/gziphandler"
@@ -17,6 +19,13 @@ import (
 	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
 	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
 	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/audit"
+	"github.com/therealssj/testingdep2/src/driver"
+	"github.com/therealssj/testingdep2/src/metrics"
+	"github.com/therealssj/testingdep2/src/mock"
+	"github.com/therealssj/testingdep2/src/node"
+	"github.com/therealssj/testingdep2/src/policy"
 )
 
 const (
@@ -24,10 +33,15 @@ const (
 	defaultWriteTimeout = time.Second * 60
 	defaultIdleTimeout  = time.Second * 120
 
+	// defaultAddressBatchSize is the number of addresses requested from the device per call
+	defaultAddressBatchSize = 8
+
 	// ContentTypeJSON json content type header
 	ContentTypeJSON = "application/json"
 	// ContentTypeForm form data content type header
 	ContentTypeForm = "application/x-www-form-urlencoded"
+	// ContentTypeNDJSON newline delimited json content type header, used by streamed responses
+	ContentTypeNDJSON = "application/x-ndjson"
 
 	apiVersion1 = "v1"
 )
@@ -41,7 +55,7 @@ var corsRegex *regexp.Regexp
 
 func init() {
 	var err error
-	corsRegex, err = regexp.Compile(`^https?://localhost|127\.0\.0\.1:\d+$`)
+	corsRegex, err = regexp.Compile(`^https?://(localhost|127\.0\.0\.1)(:\d+)?$`)
 	if err != nil {
 		logger.Panic(err)
 	}
@@ -52,12 +66,24 @@ type muxConfig struct {
 	enableCSRF         bool
 	disableHeaderCheck bool
 	hostWhitelist      []string
+	buildInfo          BuildInfo
+	usbHealth          USBHealth
+	auditLog           *audit.Log
+	mockGateway        *mock.Gateway
+	addressBatchSize   int
+	addressCache       *addressCache
+	policy             *policy.Engine
+	node               *node.Client
+	discoveryGapLimit  int
 }
 
 // Server exposes an HTTP API
 type Server struct {
 	server   *http.Server
 	listener net.Listener
+	auditLog *audit.Log
+	recorder *driver.Recorder
+	drivers  []*driver.PersistentDriver
 	done     chan struct{}
 }
 
@@ -69,6 +95,38 @@ type Config struct {
 	ReadTimeout        time.Duration
 	WriteTimeout       time.Duration
 	IdleTimeout        time.Duration
+	BuildInfo          BuildInfo
+	// MaxMessageSize is the largest message payload accepted from a device, defaults to driver.DefaultMaxMessageSize
+	MaxMessageSize uint32
+	// AuditLogFile is the path of the audit log of sensitive wallet operations, auditing is disabled if empty
+	AuditLogFile string
+	// MockScenarioFile is the path of a mock scenario file. If set, the usb and emulator endpoints
+	// replay its scenarios instead of talking to a device and the gateway may be nil.
+	MockScenarioFile string
+	// CaptureFile is the path of a file all device traffic is recorded to, with secrets redacted.
+	// Captures are replayed with driver.ReplayDriver. Recording is disabled if empty.
+	CaptureFile string
+	// PersistentConnections keeps one connection per device open across requests instead of
+	// reconnecting for every device call
+	PersistentConnections bool
+	// IdleConnectionTimeout closes a persistent connection after this long without use,
+	// defaults to driver.DefaultIdleTimeout
+	IdleConnectionTimeout time.Duration
+	// AddressBatchSize is the largest number of addresses requested from the device in a single
+	// call, larger ranges are split in batches. Defaults to 8.
+	AddressBatchSize int
+	// AddressCacheFile is the path of the file derived addresses are cached in, keyed by device
+	// ID and passphrase session. Addresses are only cached in memory if empty.
+	AddressCacheFile string
+	// PolicyFile is the path of the spending policy transactions must satisfy before they are
+	// signed. No policy is enforced if empty. The coins sent each day are saved next to it.
+	PolicyFile string
+	// NodeURL is the address of the Skycoin node the chain state of device addresses is read
+	// from, such as http://127.0.0.1:6420. Endpoints needing a node fail if empty.
+	NodeURL string
+	// DiscoveryGapLimit is the number of consecutive unused addresses ending an address discovery.
+	// Defaults to 20.
+	DiscoveryGapLimit int
 }
 
 // HTTPResponse represents the http response struct
@@ -128,6 +186,55 @@ func writeHTTPResponse(w http.ResponseWriter, resp HTTPResponse) {
 	}
 }
 
+// acceptsNDJSON reports whether the client asked for a streamed newline delimited json response
+func acceptsNDJSON(r *http.Request) bool {
+	for _, v := range r.Header["Accept"] {
+		for _, t := range strings.Split(v, ",") {
+			if mt, _, err := mime.ParseMediaType(t); err == nil && mt == ContentTypeNDJSON {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ndjsonWriter streams HTTPResponses as newline delimited json, flushing each line
+type ndjsonWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	return &ndjsonWriter{
+		w: w,
+	}
+}
+
+// write writes resp as a single line. The status code of a streamed response is always 200,
+// errors are reported in the error field of a line.
+func (s *ndjsonWriter) write(resp HTTPResponse) {
+	out, err := json.Marshal(resp)
+	if err != nil {
+		logger.WithError(err).Error("json.Marshal failed")
+		return
+	}
+
+	if !s.started {
+		s.w.Header().Set("Content-Type", ContentTypeNDJSON)
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+
+	if _, err := s.w.Write(append(out, '\n')); err != nil {
+		logger.WithError(err).Error("http Write failed")
+		return
+	}
+
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // Serve serves the web interface on the configured host
 func (s *Server) Serve() error {
 	defer close(s.done)
@@ -152,9 +259,30 @@ func (s *Server) Shutdown() {
 		logger.WithError(err).Warning("s.listener.Close() error")
 	}
 	<-s.done
+
+	if s.auditLog != nil {
+		if err := s.auditLog.Close(); err != nil {
+			logger.WithError(err).Warning("s.auditLog.Close() error")
+		}
+	}
+
+	for _, drv := range s.drivers {
+		if err := drv.Close(); err != nil {
+			logger.WithError(err).Warning("Closing device connection failed")
+		}
+	}
+
+	if s.recorder != nil {
+		if err := s.recorder.Err(); err != nil {
+			logger.WithError(err).Warning("Recording device traffic failed")
+		}
+		if err := s.recorder.Close(); err != nil {
+			logger.WithError(err).Warning("s.recorder.Close() error")
+		}
+	}
 }
 
-func create(host string, c Config, gateway *Gateway) *Server {
+func create(host string, c Config, gateway *Gateway) (*Server, error) {
 	if c.ReadTimeout == 0 {
 		c.ReadTimeout = defaultReadTimeout
 	}
@@ -164,15 +292,131 @@ func create(host string, c Config, gateway *Gateway) *Server {
 	if c.IdleTimeout == 0 {
 		c.IdleTimeout = defaultIdleTimeout
 	}
+	if c.AddressBatchSize <= 0 {
+		c.AddressBatchSize = defaultAddressBatchSize
+	}
+
+	var mockGateway *mock.Gateway
+	if c.MockScenarioFile != "" {
+		scenarios, err := mock.LoadScenarios(c.MockScenarioFile)
+		if err != nil {
+			return nil, err
+		}
+		mockGateway, err = mock.NewGateway(scenarios)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("Mock mode enabled, active scenario %q", mockGateway.Active())
+	}
+
+	var engine *policy.Engine
+	if c.PolicyFile != "" {
+		var err error
+		engine, err = policy.Load(c.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("Enforcing the spending policy in %s", c.PolicyFile)
+	}
+
+	var nodeClient *node.Client
+	if c.NodeURL != "" {
+		var err error
+		nodeClient, err = node.NewClient(c.NodeURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the persistent drivers only connect on first use, there is nothing to close if create fails
+	var drivers []*driver.PersistentDriver
+	if c.PersistentConnections && mockGateway == nil {
+		cfg := driver.PersistentConfig{
+			IdleTimeout: c.IdleConnectionTimeout,
+		}
+		for _, d := range []*deviceWallet.Device{gateway.USBDevice, gateway.EmulatorDevice} {
+			if drv := keepDeviceConnected(d, cfg); drv != nil {
+				drivers = append(drivers, drv)
+			}
+		}
+	}
+
+	var recorder *driver.Recorder
+	if c.CaptureFile != "" && mockGateway == nil {
+		var err error
+		recorder, err = driver.OpenCaptureFile(c.CaptureFile)
+		if err != nil {
+			return nil, err
+		}
+		// recording happens below validation so that rejected messages are captured too
+		recordDeviceTraffic(gateway.USBDevice, recorder)
+		recordDeviceTraffic(gateway.EmulatorDevice, recorder)
+		logger.Infof("Recording device traffic to %s", c.CaptureFile)
+	}
+
+	usbHealth := USBHealth{
+		WebUSBError: errMockUSB,
+		HIDAPIError: errMockUSB,
+	}
+	if mockGateway == nil {
+		validateDeviceMessages(gateway.USBDevice, c.MaxMessageSize)
+		validateDeviceMessages(gateway.EmulatorDevice, c.MaxMessageSize)
+		usbHealth = checkUSBHealth()
+	}
+
+	cache := newAddressCache()
+	if c.AddressCacheFile != "" {
+		var err error
+		cache, err = loadAddressCache(c.AddressCacheFile)
+		if err != nil {
+			if recorder != nil {
+				recorder.Close()
+			}
+			return nil, err
+		}
+	}
+
+	var auditLog *audit.Log
+	if c.AuditLogFile != "" {
+		var err error
+		auditLog, err = audit.Open(c.AuditLogFile)
+		if err != nil {
+			if recorder != nil {
+				recorder.Close()
+			}
+			return nil, err
+		}
+	}
 
 	mc := muxConfig{
 		host:               host,
 		enableCSRF:         c.EnableCSRF,
 		disableHeaderCheck: c.DisableHeaderCheck,
 		hostWhitelist:      c.HostWhitelist,
+		buildInfo:          c.BuildInfo,
+		usbHealth:          usbHealth,
+		auditLog:           auditLog,
+		mockGateway:        mockGateway,
+		addressBatchSize:   c.AddressBatchSize,
+		addressCache:       cache,
+		policy:             engine,
+		node:               nodeClient,
+		discoveryGapLimit:  c.DiscoveryGapLimit,
 	}
 
-	srvMux := newServerMux(mc, gateway.USBDevice, gateway.EmulatorDevice)
+	var usbGateway, emulatorGateway Gatewayer
+	if mockGateway != nil {
+		usbGateway = mockGateway
+		emulatorGateway = mockGateway
+	} else if c.PersistentConnections {
+		usbGateway = persistentDevice{gateway.USBDevice}
+		emulatorGateway = persistentDevice{gateway.EmulatorDevice}
+	} else {
+		usbGateway = gateway.USBDevice
+		emulatorGateway = gateway.EmulatorDevice
+	}
+
+	srvMux, _ := newServerMux(mc, usbGateway, emulatorGateway)
 
 	srv := &http.Server{
 		Handler:      srvMux,
@@ -182,9 +426,12 @@ func create(host string, c Config, gateway *Gateway) *Server {
 	}
 
 	return &Server{
-		server: srv,
-		done:   make(chan struct{}),
-	}
+		server:   srv,
+		auditLog: auditLog,
+		recorder: recorder,
+		drivers:  drivers,
+		done:     make(chan struct{}),
+	}, nil
 }
 
 // Create create a new http server
@@ -198,15 +445,21 @@ func Create(host string, c Config, gateway *Gateway) (*Server, error) {
 	// we need to get the assigned address to know the full hostname
 	host = listener.Addr().String()
 
-	s := create(host, c, gateway)
+	s, err := create(host, c, gateway)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
 
 	s.listener = listener
 
 	return s, nil
 }
 
-func newServerMux(c muxConfig, usbGateway, emulatorGateway Gatewayer) *http.ServeMux {
+// newServerMux creates the API router and returns it along with the list of registered endpoints
+func newServerMux(c muxConfig, usbGateway, emulatorGateway Gatewayer) (*http.ServeMux, []string) {
 	mux := http.NewServeMux()
+	var endpoints []string
 
 	allowedOrigins := []string{
 		fmt.Sprintf("http://%s", c.host),
@@ -242,16 +495,18 @@ func newServerMux(c muxConfig, usbGateway, emulatorGateway Gatewayer) *http.Serv
 	})
 
 	webHandlerWithOptionals := func(endpoint string, handlerFunc http.Handler, checkCSRF, checkHeaders bool) {
-		handler := wh.ElapsedHandler(logger, handlerFunc)
+		handler := elapsedHandler(handlerFunc)
 
 		handler = corsHandler.Handler(handler)
 
-		handler = gziphandler.GzipHandler(handler)
+		handler = gzipHandler(handler)
+		handler = metricsHandler(endpoint, handler)
 		mux.Handle(endpoint, handler)
+		endpoints = append(endpoints, endpoint)
 	}
 
 	webHandler := func(endpoint string, handler http.Handler) {
-		handler = wh.ElapsedHandler(logger, handler)
+		handler = elapsedHandler(handler)
 		webHandlerWithOptionals(endpoint, handler, c.enableCSRF, !c.disableHeaderCheck)
 	}
 
@@ -259,15 +514,94 @@ func newServerMux(c muxConfig, usbGateway, emulatorGateway Gatewayer) *http.Serv
 		webHandler("/api/"+apiVersion1+endpoint, handler)
 	}
 
+	// auditedHandlerV1 registers a sensitive endpoint whose requests are recorded in the audit log
+	auditedHandlerV1 := func(endpoint, device string, handler http.Handler) {
+		webHandlerV1(endpoint, auditHandler(c.auditLog, "/api/"+apiVersion1+endpoint, device, handler))
+	}
+
+	batchSize := c.addressBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultAddressBatchSize
+	}
+
+	gapLimit := c.discoveryGapLimit
+	if gapLimit <= 0 {
+		gapLimit = defaultDiscoveryGapLimit
+	}
+
+	// the cache is shared by both devices, it is keyed by device ID
+	cache := c.addressCache
+	if cache == nil {
+		cache = newAddressCache()
+	}
+	usbGateway = addressCachingGateway{usbGateway, cache}
+	emulatorGateway = addressCachingGateway{emulatorGateway, cache}
+
+	// prometheus metrics
+	webHandler("/metrics", metrics.Handler())
+
 	// hw wallet endpoints
-	webHandlerV1("/generate_addresses", generateAddresses(usbGateway))
-	webHandlerV1("/apply_settings", applySettings(usbGateway))
+	webHandlerV1("/generate_addresses", generateAddresses(usbGateway, cache, batchSize))
+	webHandlerV1("/addresses", cachedAddresses(usbGateway, cache))
+	webHandlerV1("/balance", balance(usbGateway, cache, batchSize, c.node))
+	webHandlerV1("/discover_addresses", discoverAddresses(usbGateway, cache, batchSize, gapLimit, c.node))
+	webHandlerV1("/address/qr", addressQR(usbGateway, cache))
+	auditedHandlerV1("/apply_settings", deviceWallet.DeviceTypeUSB.String(), applySettings(usbGateway))
+	auditedHandlerV1("/transaction_sign", deviceWallet.DeviceTypeUSB.String(), transactionSign(usbGateway, cache, c.policy))
+	auditedHandlerV1("/send", deviceWallet.DeviceTypeUSB.String(), send(usbGateway, cache, batchSize, c.policy, c.node))
+	auditedHandlerV1("/raw_transaction_sign", deviceWallet.DeviceTypeUSB.String(), rawTransactionSign(usbGateway, cache, c.policy))
+	auditedHandlerV1("/bundle/sign", deviceWallet.DeviceTypeUSB.String(), bundleSign(usbGateway, cache, c.policy))
+	auditedHandlerV1("/sign_message", deviceWallet.DeviceTypeUSB.String(), signMessage(usbGateway, cache))
 
 	// emulator endpoints
-	webHandlerV1("/emulator/generate_addresses", generateAddresses(emulatorGateway))
-	webHandlerV1("/emulator/apply_settings", applySettings(emulatorGateway))
+	webHandlerV1("/emulator/generate_addresses", generateAddresses(emulatorGateway, cache, batchSize))
+	webHandlerV1("/emulator/addresses", cachedAddresses(emulatorGateway, cache))
+	webHandlerV1("/emulator/balance", balance(emulatorGateway, cache, batchSize, c.node))
+	webHandlerV1("/emulator/discover_addresses", discoverAddresses(emulatorGateway, cache, batchSize, gapLimit, c.node))
+	webHandlerV1("/emulator/address/qr", addressQR(emulatorGateway, cache))
+	auditedHandlerV1("/emulator/apply_settings", deviceWallet.DeviceTypeEmulator.String(), applySettings(emulatorGateway))
+	auditedHandlerV1("/emulator/transaction_sign", deviceWallet.DeviceTypeEmulator.String(), transactionSign(emulatorGateway, cache, c.policy))
+	auditedHandlerV1("/emulator/send", deviceWallet.DeviceTypeEmulator.String(), send(emulatorGateway, cache, batchSize, c.policy, c.node))
+	auditedHandlerV1("/emulator/raw_transaction_sign", deviceWallet.DeviceTypeEmulator.String(), rawTransactionSign(emulatorGateway, cache, c.policy))
+	auditedHandlerV1("/emulator/bundle/sign", deviceWallet.DeviceTypeEmulator.String(), bundleSign(emulatorGateway, cache, c.policy))
+	auditedHandlerV1("/emulator/sign_message", deviceWallet.DeviceTypeEmulator.String(), signMessage(emulatorGateway, cache))
+
+	// offline signing endpoints of the online machine, they don't use the device
+	webHandlerV1("/bundle/export", bundleExport(c.node))
+	webHandlerV1("/bundle/import", bundleImport(c.node))
+
+	// device-free endpoints
+	webHandlerV1("/verify_message", verifyMessage())
+	webHandlerV1("/address/validate", validateAddress())
+	webHandlerV1("/payment_uri", parsePaymentURI())
+	webHandlerV1("/transaction_preview", transactionPreview())
+
+	// daemon endpoints
+	webHandlerV1("/version", version(c.buildInfo))
+	webHandlerV1("/health", health(c))
+
+	// mock mode endpoints
+	if c.mockGateway != nil {
+		webHandlerV1("/mock/scenarios", mockScenarios(c.mockGateway))
+		webHandlerV1("/mock/scenario", setMockScenario(c.mockGateway))
+	}
+
+	// api documentation
+	webHandlerV1("/openapi.json", openAPISpec(newOpenAPIDocument(c.host, c.mockGateway != nil)))
 
-	return mux
+	return mux, endpoints
+}
+
+// gzipHandler compresses responses, except streamed ones which gziphandler would buffer
+func gzipHandler(handler http.Handler) http.Handler {
+	gzipped := gziphandler.GzipHandler(handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if acceptsNDJSON(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		gzipped.ServeHTTP(w, r)
+	})
 }
 
 func parseBoolFlag(v string) (bool, error) {
@@ -294,16 +628,19 @@ func HandleFirmwareResponseMessages(w http.ResponseWriter, r *http.Request, gate
 			Data: "WordRequest",
 		})
 	case uint16(messages.MessageType_MessageType_ButtonRequest):
+		start := time.Now()
 		msg, err := gateway.ButtonAck()
+		observeButtonAck(start, msg, err)
 		if err != nil {
 			logger.Error(err.Error())
-			resp := NewHTTPErrorResponse(http.StatusUnauthorized, err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
 			writeHTTPResponse(w, resp)
 			return
 		}
 
 		HandleFirmwareResponseMessages(w, r, gateway, msg)
 	case uint16(messages.MessageType_MessageType_Failure):
+		recordFirmwareFailure(msg)
 		failureMsg, err := deviceWallet.DecodeFailMsg(msg)
 		if err != nil {
 			resp := NewHTTPErrorResponse(http.StatusInternalServerError, err.Error())
@@ -0,0 +1,369 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+)
+
+const testHost = "127.0.0.1:9510"
+
+// httpTestCase is a request to a handler and the response it is expected to write
+type httpTestCase struct {
+	name        string
+	method      string
+	contentType string
+	body        string
+	responses   []mockResponse
+	calls       []mockCall
+	status      int
+	err         string
+	// data is compared with the JSON decoded data field of the response
+	data interface{}
+}
+
+// runHTTPTestCases serves every case with the handler returned by newHandler
+func runHTTPTestCases(t *testing.T, url string, newHandler func(Gatewayer) http.Handler, cases []httpTestCase) {
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := newMockGatewayer(t, tc.calls, tc.responses)
+
+			var body io.Reader
+			if tc.body != "" {
+				body = bytes.NewBufferString(tc.body)
+			}
+			req := httptest.NewRequest(tc.method, url, body)
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+
+			rr := httptest.NewRecorder()
+			newHandler(gateway).ServeHTTP(rr, req)
+
+			checkHTTPResponse(t, rr, tc.status, tc.err, tc.data)
+			assertGatewayCalls(t, gateway, tc.calls)
+		})
+	}
+}
+
+// checkHTTPResponse checks the status code, the error message and the data of an HTTPResponse
+func checkHTTPResponse(t *testing.T, rr *httptest.ResponseRecorder, status int, errMsg string, data interface{}) {
+	t.Helper()
+
+	if rr.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, rr.Code, rr.Body.String())
+	}
+
+	var resp ReceivedHTTPResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", rr.Body.String(), err)
+	}
+
+	if status != http.StatusOK {
+		if resp.Error == nil {
+			t.Fatalf("expected an error, got %s", rr.Body.String())
+		}
+		if resp.Error.Code != status {
+			t.Fatalf("error code %d does not match status %d", resp.Error.Code, status)
+		}
+		if errMsg != "" && resp.Error.Message != errMsg {
+			t.Fatalf("expected error %q, got %q", errMsg, resp.Error.Message)
+		}
+		return
+	}
+
+	if resp.Error != nil {
+		t.Fatalf("unexpected error %v", resp.Error)
+	}
+
+	if data != nil {
+		got := reflect.New(reflect.TypeOf(data))
+		if err := json.Unmarshal(resp.Data, got.Interface()); err != nil {
+			t.Fatalf("invalid data %s: %v", resp.Data, err)
+		}
+		if !reflect.DeepEqual(data, got.Elem().Interface()) {
+			t.Fatalf("expected data %v, got %v", data, got.Elem().Interface())
+		}
+	}
+}
+
+func TestHandleFirmwareResponseMessages(t *testing.T) {
+	success := newWireMessage(t, messages.MessageType_MessageType_Success, &messages.Success{
+		Message: proto.String("Settings applied"),
+	})
+	buttonRequest := newWireMessage(t, messages.MessageType_MessageType_ButtonRequest, &messages.ButtonRequest{})
+
+	cases := []struct {
+		name      string
+		msg       wire.Message
+		responses []mockResponse
+		calls     []mockCall
+		status    int
+		err       string
+		data      interface{}
+	}{
+		{
+			name:   "PinMatrixRequest",
+			msg:    newWireMessage(t, messages.MessageType_MessageType_PinMatrixRequest, &messages.PinMatrixRequest{}),
+			status: http.StatusOK,
+			data:   "PinMatrixRequest",
+		},
+		{
+			name:   "PassphraseRequest",
+			msg:    newWireMessage(t, messages.MessageType_MessageType_PassphraseRequest, &messages.PassphraseRequest{}),
+			status: http.StatusOK,
+			data:   "PassPhraseRequest",
+		},
+		{
+			name:   "WordRequest",
+			msg:    newWireMessage(t, messages.MessageType_MessageType_WordRequest, &messages.WordRequest{}),
+			status: http.StatusOK,
+			data:   "WordRequest",
+		},
+		{
+			name:      "ButtonRequest then Success",
+			msg:       buttonRequest,
+			responses: []mockResponse{respondWith(success)},
+			calls:     []mockCall{{Method: "ButtonAck"}},
+			status:    http.StatusOK,
+			data:      "Settings applied",
+		},
+		{
+			name:      "ButtonRequest chain",
+			msg:       buttonRequest,
+			responses: []mockResponse{respondWith(buttonRequest), respondWith(buttonRequest), respondWith(success)},
+			calls:     []mockCall{{Method: "ButtonAck"}, {Method: "ButtonAck"}, {Method: "ButtonAck"}},
+			status:    http.StatusOK,
+			data:      "Settings applied",
+		},
+		{
+			name:      "ButtonRequest then PinMatrixRequest",
+			msg:       buttonRequest,
+			responses: []mockResponse{respondWith(newWireMessage(t, messages.MessageType_MessageType_PinMatrixRequest, &messages.PinMatrixRequest{}))},
+			calls:     []mockCall{{Method: "ButtonAck"}},
+			status:    http.StatusOK,
+			data:      "PinMatrixRequest",
+		},
+		{
+			name:      "ButtonAck error",
+			msg:       buttonRequest,
+			responses: []mockResponse{respondErr("usb failure")},
+			calls:     []mockCall{{Method: "ButtonAck"}},
+			status:    http.StatusInternalServerError,
+			err:       "usb failure",
+		},
+		{
+			name:      "ButtonAck disconnect",
+			msg:       buttonRequest,
+			responses: []mockResponse{respondErr("Device disconnected during action")},
+			calls:     []mockCall{{Method: "ButtonAck"}},
+			status:    http.StatusServiceUnavailable,
+		},
+		{
+			name: "Failure",
+			msg: newWireMessage(t, messages.MessageType_MessageType_Failure, &messages.Failure{
+				Code:    messages.FailureType_Failure_ActionCancelled.Enum(),
+				Message: proto.String("Action cancelled by user"),
+			}),
+			status: http.StatusConflict,
+			err:    "Action cancelled by user",
+		},
+		{
+			name: "malformed Failure",
+			msg: wire.Message{
+				Kind: uint16(messages.MessageType_MessageType_Failure),
+				Data: []byte{0xff},
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "Success",
+			msg:    success,
+			status: http.StatusOK,
+			data:   "Settings applied",
+		},
+		{
+			name: "malformed Success",
+			msg: wire.Message{
+				Kind: uint16(messages.MessageType_MessageType_Success),
+				Data: []byte{0xff},
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "ResponseSkycoinAddress",
+			msg: newWireMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, &messages.ResponseSkycoinAddress{
+				Addresses: []string{"2HcV3JDBuU8HSgetgKPxmNa95XrCgx6VchF", "zC8GAQGQBfwk7vtTxVoRG7iMperHNuyYPs"},
+			}),
+			status: http.StatusOK,
+			data:   []string{"2HcV3JDBuU8HSgetgKPxmNa95XrCgx6VchF", "zC8GAQGQBfwk7vtTxVoRG7iMperHNuyYPs"},
+		},
+		{
+			name: "malformed ResponseSkycoinAddress",
+			msg: wire.Message{
+				Kind: uint16(messages.MessageType_MessageType_ResponseSkycoinAddress),
+				Data: []byte{0xff},
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name: "Features",
+			msg: newWireMessage(t, messages.MessageType_MessageType_Features, &messages.Features{
+				Label:       proto.String("my wallet"),
+				Initialized: proto.Bool(true),
+			}),
+			status: http.StatusOK,
+			data: map[string]interface{}{
+				"label":       "my wallet",
+				"initialized": true,
+			},
+		},
+		{
+			name: "ResponseSkycoinSignMessage",
+			msg: newWireMessage(t, messages.MessageType_MessageType_ResponseSkycoinSignMessage, &messages.ResponseSkycoinSignMessage{
+				SignedMessage: proto.String("signature"),
+			}),
+			status: http.StatusOK,
+			data:   "signature",
+		},
+		{
+			name: "ResponseTransactionSign",
+			msg: newWireMessage(t, messages.MessageType_MessageType_ResponseTransactionSign, &messages.ResponseTransactionSign{
+				Signatures: []string{"sig0", "sig1"},
+			}),
+			status: http.StatusOK,
+			data:   []string{"sig0", "sig1"},
+		},
+		{
+			name:   "unexpected kind",
+			msg:    newWireMessage(t, messages.MessageType_MessageType_EntropyRequest, &messages.EntropyRequest{}),
+			status: http.StatusInternalServerError,
+			err:    "recevied unexpected response message type: MessageType_EntropyRequest",
+		},
+		{
+			name:   "unknown kind",
+			msg:    wire.Message{Kind: 0xffff},
+			status: http.StatusInternalServerError,
+			err:    "recevied unexpected response message type: 65535",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := newMockGatewayer(t, tc.calls, tc.responses)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/generate_addresses", nil)
+			rr := httptest.NewRecorder()
+			HandleFirmwareResponseMessages(rr, req, gateway, tc.msg)
+
+			checkHTTPResponse(t, rr, tc.status, tc.err, tc.data)
+			assertGatewayCalls(t, gateway, tc.calls)
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	mux, _ := newServerMux(muxConfig{
+		host:          testHost,
+		hostWhitelist: []string{"wallet.local:8080"},
+	}, nil, nil)
+
+	cases := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"http://" + testHost, true},
+		{"http://127.0.0.1:8000", true},
+		{"http://localhost", true},
+		{"http://localhost:4200", true},
+		{"https://localhost:4200", true},
+		{"https://wallet.skycoin.net", true},
+		{"https://staging.wallet.skycoin.net", true},
+		{"http://wallet.local:8080", true},
+		{"http://wallet.skycoin.net", false},
+		{"https://evil.com", false},
+		{"http://localhost.evil.com", false},
+		{"http://evil127.0.0.1:8000", false},
+		{"http://wallet.local:8081", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "/api/v1/version", nil)
+			req.Header.Set("Origin", tc.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			allowOrigin := rr.Header().Get("Access-Control-Allow-Origin")
+			if tc.allowed && allowOrigin != tc.origin {
+				t.Fatalf("origin %s is not allowed, Access-Control-Allow-Origin is %q", tc.origin, allowOrigin)
+			}
+			if !tc.allowed && allowOrigin != "" {
+				t.Fatalf("origin %s is allowed", tc.origin)
+			}
+		})
+	}
+}
+
+func TestGzip(t *testing.T) {
+	mux, _ := newServerMux(muxConfig{host: testHost}, nil, nil)
+
+	cases := []struct {
+		name           string
+		url            string
+		acceptEncoding string
+		gzipped        bool
+	}{
+		{"large response", "/api/v1/openapi.json", "gzip", true},
+		{"large response without gzip support", "/api/v1/openapi.json", "", false},
+		// gziphandler leaves responses below its minimum size uncompressed
+		{"small response", "/api/v1/version", "gzip", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rr.Code, rr.Body.String())
+			}
+
+			gzipped := rr.Header().Get("Content-Encoding") == "gzip"
+			if gzipped != tc.gzipped {
+				t.Fatalf("expected gzipped=%v, Content-Encoding is %q", tc.gzipped, rr.Header().Get("Content-Encoding"))
+			}
+
+			body := rr.Body.Bytes()
+			if gzipped {
+				zr, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, err = ioutil.ReadAll(zr)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if !json.Valid(body) {
+				t.Fatalf("response is not valid json: %q", body)
+			}
+		})
+	}
+}
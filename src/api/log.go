@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// elapsedHandler logs the status and duration of every request like wh.ElapsedHandler.
+// Unlike it, the wrapped ResponseWriter implements http.Flusher so that streamed responses
+// reach the client as they are written.
+func elapsedHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lrw := &loggingResponseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+		start := time.Now()
+		handler.ServeHTTP(lrw, r)
+
+		logMethod := logger.Infof
+		if lrw.statusCode >= 400 {
+			logMethod = logger.WithField("body", strings.TrimSpace(lrw.response.String())).Errorf
+		}
+		logMethod("%d %s %s %s", lrw.statusCode, r.Method, r.URL.Path, time.Since(start))
+	})
+}
+
+// loggingResponseWriter records the status code and, for errors, the body of a response
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	response   bytes.Buffer
+}
+
+func (lrw *loggingResponseWriter) WriteHeader(code int) {
+	lrw.statusCode = code
+	lrw.ResponseWriter.WriteHeader(code)
+}
+
+func (lrw *loggingResponseWriter) Write(buff []byte) (int, error) {
+	n, err := lrw.ResponseWriter.Write(buff)
+	if lrw.statusCode >= 400 {
+		lrw.response.Write(buff)
+	}
+	return n, err
+}
+
+// Flush flushes the underlying ResponseWriter if it supports it
+func (lrw *loggingResponseWriter) Flush() {
+	if f, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/message"
+)
+
+// SignMessageRequest is request data for /api/v1/sign_message
+type SignMessageRequest struct {
+	AddressIndex uint32 `json:"address_index"`
+	Message      string `json:"message"`
+}
+
+// SignMessageResponse is the data of a /api/v1/sign_message response
+type SignMessageResponse struct {
+	Address   string `json:"address"`
+	Signature string `json:"signature"`
+	// Armored is the signed message in the armored format accepted by /api/v1/verify_message
+	Armored string `json:"armored"`
+}
+
+// VerifyMessageRequest is request data for /api/v1/verify_message, either the armored
+// message or the message, address and signature must be set
+type VerifyMessageRequest struct {
+	Message   string `json:"message,omitempty"`
+	Address   string `json:"address,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Armored   string `json:"armored,omitempty"`
+}
+
+// VerifyMessageResponse is the data of a /api/v1/verify_message response
+type VerifyMessageResponse struct {
+	Valid   bool   `json:"valid"`
+	Address string `json:"address"`
+	Message string `json:"message"`
+	// Signer is the address recovered from the signature
+	Signer string `json:"signer,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// signMessage signs a message with the device address at address_index.
+// The signature is verified against the address before it is returned.
+// URI: /api/v1/sign_message
+// Method: POST
+// Args: JSON Body
+func signMessage(gateway Gatewayer, cache *addressCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != ContentTypeJSON {
+			resp := NewHTTPErrorResponse(http.StatusUnsupportedMediaType, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		var req SignMessageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusBadRequest, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		defer r.Body.Close()
+
+		if req.Message == "" {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, "message is required")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		key, msg, err := addressCacheKey(gateway, cache)
+		if err != nil {
+			logger.Error("signMessage failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		addresses, msg, err := deviceAddressesAt(gateway, cache, key, []uint32{req.AddressIndex})
+		if err != nil {
+			logger.Error("signMessage failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		m, err := signDeviceMessage(gateway, int(req.AddressIndex), req.Message)
+		if err != nil {
+			logger.Error("signMessage failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if m.Kind != uint16(messages.MessageType_MessageType_ResponseSkycoinSignMessage) {
+			HandleFirmwareResponseMessages(w, r, gateway, m)
+			return
+		}
+
+		signed := message.Signed{
+			Message: req.Message,
+			Address: addresses[req.AddressIndex],
+		}
+		signed.Signature, err = deviceWallet.DecodeResponseSkycoinSignMessage(m)
+		if err == nil {
+			_, err = signed.Verify()
+		}
+		if err != nil {
+			logger.Error("signMessage failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(http.StatusBadGateway, fmt.Sprintf("device returned an invalid signature: %v", err))
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: SignMessageResponse{
+				Address:   signed.Address,
+				Signature: signed.Signature,
+				Armored:   signed.Armor(),
+			},
+		})
+	}
+}
+
+// signDeviceMessage asks the device to sign a message, acknowledging its button requests
+func signDeviceMessage(gateway Gatewayer, addressIndex int, msg string) (wire.Message, error) {
+	m, err := gateway.SignMessage(addressIndex, msg)
+	for err == nil && m.Kind == uint16(messages.MessageType_MessageType_ButtonRequest) {
+		start := time.Now()
+		m, err = gateway.ButtonAck()
+		observeButtonAck(start, m, err)
+	}
+	return m, err
+}
+
+// verifyMessage verifies a signed message without the device, recovering the public key from
+// the signature. A well formed message whose signature doesn't match is answered with valid false.
+// URI: /api/v1/verify_message
+// Method: POST
+// Args: JSON Body
+func verifyMessage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != ContentTypeJSON {
+			resp := NewHTTPErrorResponse(http.StatusUnsupportedMediaType, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		var req VerifyMessageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusBadRequest, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		defer r.Body.Close()
+
+		signed, err := req.signed()
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		resp := VerifyMessageResponse{
+			Address: signed.Address,
+			Message: signed.Message,
+		}
+		signer, err := signed.Verify()
+		if signer != (cipher.Address{}) {
+			resp.Signer = signer.String()
+		}
+		if err != nil {
+			resp.Reason = err.Error()
+		} else {
+			resp.Valid = true
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: resp,
+		})
+	}
+}
+
+// signed validates the request and returns its signed message
+func (req VerifyMessageRequest) signed() (message.Signed, error) {
+	signed := message.Signed{
+		Message:   req.Message,
+		Address:   req.Address,
+		Signature: req.Signature,
+	}
+
+	if req.Armored != "" {
+		if req.Message != "" || req.Address != "" || req.Signature != "" {
+			return message.Signed{}, fmt.Errorf("armored cannot be combined with message, address or signature")
+		}
+
+		var err error
+		if signed, err = message.Dearmor(req.Armored); err != nil {
+			return message.Signed{}, err
+		}
+	} else if req.Address == "" || req.Signature == "" {
+		return message.Signed{}, fmt.Errorf("armored or address and signature are required")
+	}
+
+	if _, err := cipher.DecodeBase58Address(signed.Address); err != nil {
+		return message.Signed{}, fmt.Errorf("invalid address: %v", err)
+	}
+	if _, err := message.ParseSignature(signed.Signature); err != nil {
+		return message.Signed{}, err
+	}
+
+	return signed, nil
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/base58"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+
+	"github.com/therealssj/testingdep2/src/message"
+)
+
+// newSignedMessage signs a message with the key at index 1 of newTestKeys
+func newSignedMessage(t *testing.T, text string) (message.Signed, []string) {
+	keys, addresses := newTestKeys(t, 2)
+	sig := cipher.MustSignHash(message.Hash(text), keys[1])
+	return message.Signed{
+		Message:   text,
+		Address:   addresses[1],
+		Signature: base58.Encode(sig[:]),
+	}, addresses
+}
+
+func TestSignMessage(t *testing.T) {
+	signed, addresses := newSignedMessage(t, "hello")
+
+	deviceResponses := []mockResponse{
+		respondWith(newFeaturesMessage(t, "device", false)),
+		respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, &messages.ResponseSkycoinAddress{
+			Addresses: addresses[1:],
+		})),
+	}
+	deviceCalls := []mockCall{
+		{Method: "GetFeatures"},
+		{Method: "AddressGen", Args: []interface{}{1, 1, false}},
+		{Method: "SignMessage", Args: []interface{}{1, "hello"}},
+	}
+	signature := func(s string) mockResponse {
+		return respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseSkycoinSignMessage, &messages.ResponseSkycoinSignMessage{
+			SignedMessage: proto.String(s),
+		}))
+	}
+	other, _ := newSignedMessage(t, "other")
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "no message",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_index": 1}`,
+			status:      http.StatusUnprocessableEntity,
+			err:         "message is required",
+		},
+		{
+			name:        "ok",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_index": 1, "message": "hello"}`,
+			responses: append(deviceResponses,
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_ButtonRequest, &messages.ButtonRequest{})),
+				signature(signed.Signature),
+			),
+			calls:  append(deviceCalls, mockCall{Method: "ButtonAck"}),
+			status: http.StatusOK,
+			data: SignMessageResponse{
+				Address:   addresses[1],
+				Signature: signed.Signature,
+				Armored:   signed.Armor(),
+			},
+		},
+		{
+			name:        "signature of another message",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"address_index": 1, "message": "hello"}`,
+			responses:   append(deviceResponses, signature(other.Signature)),
+			calls:       deviceCalls,
+			status:      http.StatusBadGateway,
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/sign_message", func(g Gatewayer) http.Handler {
+		return signMessage(g, newAddressCache())
+	}, cases)
+}
+
+func TestVerifyMessage(t *testing.T) {
+	signed, addresses := newSignedMessage(t, "hello\n-dashed")
+	sig, err := message.ParseSignature(signed.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := func(s message.Signed) string {
+		return fmt.Sprintf(`{"message": %q, "address": %q, "signature": %q}`, s.Message, s.Address, s.Signature)
+	}
+	tampered := signed
+	tampered.Message = "hello"
+	wrongAddress := signed
+	wrongAddress.Address = addresses[0]
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "nothing to verify",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"message": "hello"}`,
+			status:      http.StatusUnprocessableEntity,
+			err:         "armored or address and signature are required",
+		},
+		{
+			name:        "not armored",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"armored": "hello"}`,
+			status:      http.StatusUnprocessableEntity,
+			err:         message.ErrNotArmored.Error(),
+		},
+		{
+			name:        "invalid address",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        fmt.Sprintf(`{"message": "hello", "address": "address", "signature": %q}`, signed.Signature),
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "valid",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(signed),
+			status:      http.StatusOK,
+			data: VerifyMessageResponse{
+				Valid:   true,
+				Address: signed.Address,
+				Message: signed.Message,
+				Signer:  signed.Address,
+			},
+		},
+		{
+			name:        "valid hex signature",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        fmt.Sprintf(`{"message": %q, "address": %q, "signature": %q}`, signed.Message, signed.Address, sig.Hex()),
+			status:      http.StatusOK,
+			data: VerifyMessageResponse{
+				Valid:   true,
+				Address: signed.Address,
+				Message: signed.Message,
+				Signer:  signed.Address,
+			},
+		},
+		{
+			name:        "valid armored",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        fmt.Sprintf(`{"armored": %q}`, signed.Armor()),
+			status:      http.StatusOK,
+			data: VerifyMessageResponse{
+				Valid:   true,
+				Address: signed.Address,
+				Message: signed.Message,
+				Signer:  signed.Address,
+			},
+		},
+		{
+			name:        "signed by another address",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(wrongAddress),
+			status:      http.StatusOK,
+			data: VerifyMessageResponse{
+				Address: addresses[0],
+				Message: signed.Message,
+				Signer:  addresses[1],
+				Reason:  fmt.Sprintf("message was signed by %s, not %s", addresses[1], addresses[0]),
+			},
+		},
+		{
+			name:        "tampered message",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(tampered),
+			status:      http.StatusOK,
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/verify_message", func(g Gatewayer) http.Handler {
+		return verifyMessage()
+	}, cases)
+}
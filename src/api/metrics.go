@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/metrics"
+)
+
+const metricsNamespace = "hwd"
+
+var (
+	apiRequests = metrics.NewCounterVec(
+		metricsNamespace+"_api_requests_total",
+		"Number of API requests by endpoint and status code.",
+		"endpoint", "status")
+
+	apiRequestDuration = metrics.NewHistogramVec(
+		metricsNamespace+"_api_request_duration_seconds",
+		"API request latency by endpoint and status code.",
+		metrics.DefBuckets,
+		"endpoint", "status")
+
+	deviceRoundTripDuration = metrics.NewHistogramVec(
+		metricsNamespace+"_device_roundtrip_seconds",
+		"Latency between sending a message to the device and reading its answer, by device type and sent message kind.",
+		metrics.DefBuckets,
+		"device_type", "kind")
+
+	deviceConnectFailures = metrics.NewCounterVec(
+		metricsNamespace+"_device_connect_failures_total",
+		"Number of failed attempts to open a device connection, by device type.",
+		"device_type")
+
+	buttonRequestWait = metrics.NewHistogramVec(
+		metricsNamespace+"_button_request_wait_seconds",
+		"Time spent waiting for the user to confirm a ButtonRequest, by the kind of the message that followed.",
+		metrics.InteractionBuckets,
+		"outcome")
+
+	firmwareFailures = metrics.NewCounterVec(
+		metricsNamespace+"_firmware_failures_total",
+		"Number of Failure messages returned by the firmware, by failure type.",
+		"type")
+)
+
+// statusRecorder records the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher so streaming handlers keep working
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// metricsHandler counts requests and observes their latency
+func metricsHandler(endpoint string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		handler.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		status := strconv.Itoa(rec.status)
+		apiRequests.Inc(endpoint, status)
+		apiRequestDuration.Observe(time.Since(start).Seconds(), endpoint, status)
+	})
+}
+
+// metricsDriver wraps a DeviceDriver and records device round-trip latency and connect failures
+type metricsDriver struct {
+	deviceWallet.DeviceDriver
+}
+
+func newMetricsDriver(drv deviceWallet.DeviceDriver) deviceWallet.DeviceDriver {
+	return &metricsDriver{drv}
+}
+
+// SendToDevice sends msg to device and records how long the device took to answer
+func (drv *metricsDriver) SendToDevice(dev io.ReadWriteCloser, chunks [][64]byte) (wire.Message, error) {
+	start := time.Now()
+	msg, err := drv.DeviceDriver.SendToDevice(dev, chunks)
+	deviceRoundTripDuration.Observe(time.Since(start).Seconds(), drv.DeviceType().String(), chunksKind(chunks))
+	return msg, err
+}
+
+// GetDevice returns a device instance and counts connection failures
+func (drv *metricsDriver) GetDevice() (io.ReadWriteCloser, error) {
+	dev, err := drv.DeviceDriver.GetDevice()
+	if err != nil {
+		deviceConnectFailures.Inc(drv.DeviceType().String())
+	}
+	return dev, err
+}
+
+// chunksKind returns the message kind encoded in the header of the first chunk
+func chunksKind(chunks [][64]byte) string {
+	if len(chunks) == 0 {
+		return "none"
+	}
+	return messages.MessageType(binary.BigEndian.Uint16(chunks[0][3:5])).String()
+}
+
+// instrumentDevice wraps the device's driver with metricsDriver
+func instrumentDevice(d *deviceWallet.Device) {
+	if d == nil || d.Driver == nil {
+		return
+	}
+	if _, ok := d.Driver.(*metricsDriver); ok {
+		return
+	}
+	d.Driver = newMetricsDriver(d.Driver)
+}
+
+// observeButtonAck records how long the user took to act on a ButtonRequest
+func observeButtonAck(start time.Time, msg wire.Message, err error) {
+	outcome := "error"
+	if err == nil {
+		outcome = messages.MessageType(msg.Kind).String()
+	}
+	buttonRequestWait.Observe(time.Since(start).Seconds(), outcome)
+}
+
+// recordFirmwareFailure counts a Failure message by its failure type
+func recordFirmwareFailure(msg wire.Message) {
+	failure := &messages.Failure{}
+	if err := proto.Unmarshal(msg.Data, failure); err != nil || failure.Code == nil {
+		firmwareFailures.Inc("unknown")
+		return
+	}
+	firmwareFailures.Inc(failure.GetCode().String())
+}
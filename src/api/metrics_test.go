@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+
+	"github.com/therealssj/testingdep2/src/driver"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	endpoint := "/api/v1/test_metrics_handler"
+	handler := metricsHandler(endpoint, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusTeapot)
+			return
+		}
+		// handlers which only write the body answer 200
+		w.Write([]byte("ok"))
+	}))
+
+	for _, method := range []string{http.MethodGet, http.MethodGet, http.MethodPost} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, endpoint, nil))
+	}
+
+	if v := apiRequests.Value(endpoint, "200"); v != 2 {
+		t.Fatalf("expected 2 requests with status 200, got %v", v)
+	}
+	if v := apiRequests.Value(endpoint, "418"); v != 1 {
+		t.Fatalf("expected 1 request with status 418, got %v", v)
+	}
+	if n := apiRequestDuration.Count(endpoint, "200"); n != 2 {
+		t.Fatalf("expected 2 latency observations with status 200, got %d", n)
+	}
+}
+
+func TestInstrumentDevice(t *testing.T) {
+	// the simulator refuses more than one address per request with a Failure
+	sim := driver.NewSimulator(driver.SimulatorConfig{
+		Mnemonic:     resilienceMnemonic,
+		MaxAddresses: 1,
+	})
+	gateway := NewGateway(nil, &deviceWallet.Device{Driver: sim})
+
+	// instrumenting twice doesn't wrap the driver twice
+	instrumentDevice(gateway.EmulatorDevice)
+	if _, ok := gateway.EmulatorDevice.Driver.(*metricsDriver).DeviceDriver.(*driver.Simulator); !ok {
+		t.Fatal("device driver is wrapped more than once")
+	}
+
+	mux, _ := newServerMux(muxConfig{
+		host:             testHost,
+		addressBatchSize: defaultAddressBatchSize,
+		addressCache:     newAddressCache(),
+	}, nil, gateway.EmulatorDevice)
+
+	endpoint := "/api/v1/emulator/generate_addresses"
+	deviceType := deviceWallet.DeviceTypeEmulator.String()
+	addressKind := messages.MessageType_MessageType_SkycoinAddress.String()
+	failureType := messages.FailureType_Failure_DataError.String()
+
+	requests := apiRequests.Value(endpoint, "409")
+	roundTrips := deviceRoundTripDuration.Count(deviceType, addressKind)
+	failures := firmwareFailures.Value(failureType)
+
+	req := httptest.NewRequest(http.MethodPost, endpoint, bytes.NewBufferString(`{"address_n": 2}`))
+	req.Header.Set("Content-Type", ContentTypeJSON)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	checkHTTPResponse(t, rr, http.StatusConflict, "Asking for too much addresses", nil)
+
+	if v := apiRequests.Value(endpoint, "409"); v != requests+1 {
+		t.Fatalf("expected %v requests with status 409, got %v", requests+1, v)
+	}
+	if n := deviceRoundTripDuration.Count(deviceType, addressKind); n != roundTrips+1 {
+		t.Fatalf("expected %d round trips, got %d", roundTrips+1, n)
+	}
+	if v := firmwareFailures.Value(failureType); v != failures+1 {
+		t.Fatalf("expected %v %s failures, got %v", failures+1, failureType, v)
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/therealssj/testingdep2/src/mock"
+)
+
+// MockScenarioRequest is request data for /api/v1/mock/scenario
+type MockScenarioRequest struct {
+	Name string `json:"name"`
+}
+
+// MockScenarioResponse is returned by the mock scenario endpoints
+type MockScenarioResponse struct {
+	Active    string   `json:"active"`
+	Scenarios []string `json:"scenarios"`
+}
+
+func newMockScenarioResponse(g *mock.Gateway) MockScenarioResponse {
+	return MockScenarioResponse{
+		Active:    g.Active(),
+		Scenarios: g.Scenarios(),
+	}
+}
+
+// mockScenarios lists the mock scenarios
+// URI: /api/v1/mock/scenarios
+// Method: GET
+func mockScenarios(g *mock.Gateway) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: newMockScenarioResponse(g),
+		})
+	}
+}
+
+// setMockScenario switches the active mock scenario
+// URI: /api/v1/mock/scenario
+// Method: POST
+// Args: JSON Body
+func setMockScenario(g *mock.Gateway) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != ContentTypeJSON {
+			resp := NewHTTPErrorResponse(http.StatusUnsupportedMediaType, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		var req MockScenarioRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusBadRequest, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		defer r.Body.Close()
+
+		if req.Name == "" {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, "name is required")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if err := g.SetActive(req.Name); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusNotFound, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		logger.Infof("Mock scenario switched to %q", req.Name)
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: newMockScenarioResponse(g),
+		})
+	}
+}
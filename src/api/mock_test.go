@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/therealssj/testingdep2/src/mock"
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+func TestMockScenarioEndpoints(t *testing.T) {
+	scenarios, err := mock.LoadScenarios("../mock/testdata/scenarios.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := mock.NewGateway(scenarios)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := g.Scenarios()
+
+	runHTTPTestCases(t, "/api/v1/mock/scenarios", func(Gatewayer) http.Handler {
+		return mockScenarios(g)
+	}, []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "list",
+			method: http.MethodGet,
+			status: http.StatusOK,
+			data: MockScenarioResponse{
+				Active:    "happy_path",
+				Scenarios: names,
+			},
+		},
+	})
+
+	runHTTPTestCases(t, "/api/v1/mock/scenario", func(Gatewayer) http.Handler {
+		return setMockScenario(g)
+	}, []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "unsupported content type",
+			method:      http.MethodPost,
+			contentType: ContentTypeForm,
+			body:        "name=user_cancels",
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "name required",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{}`,
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "unknown scenario",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"name": "missing"}`,
+			status:      http.StatusNotFound,
+		},
+		{
+			name:        "switch",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"name": "user_cancels"}`,
+			status:      http.StatusOK,
+			data: MockScenarioResponse{
+				Active:    "user_cancels",
+				Scenarios: names,
+			},
+		},
+	})
+}
+
+func TestMockHappyPathTransactionSign(t *testing.T) {
+	s, err := create(testHost, Config{MockScenarioFile: "../mock/testdata/scenarios.json"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := cipher.MustGenerateDeterministicKeyPairs([]byte(mock.Seed), 2)
+	_, addresses := newTestKeys(t, 1)
+	changeAddress := cipher.MustAddressFromSecKey(keys[1])
+	input := cipher.SumSHA256([]byte("input"))
+
+	body := fmt.Sprintf(`{
+		"transaction_inputs": [{"index": 0, "hash": %q}],
+		"transaction_outputs": [
+			{"address": %q, "coins": "1.5", "hours": "2"},
+			{"address_index": 1, "address": %q, "coins": "0.5", "hours": "1"}
+		]
+	}`, input.Hex(), addresses[0], changeAddress)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/transaction_sign", bytes.NewBufferString(body))
+	req.Host = testHost
+	req.Header.Set("Content-Type", ContentTypeJSON)
+	rr := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rr, req)
+
+	checkHTTPResponse(t, rr, http.StatusOK, "", nil)
+
+	var resp struct {
+		Data []string `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 {
+		t.Fatalf("expected 1 signature, got %v", resp.Data)
+	}
+
+	innerHash := transaction.HashInner([]cipher.SHA256{input}, []transaction.Output{
+		{Address: cipher.MustDecodeBase58Address(addresses[0]), Coins: 1500000, Hours: 2},
+		{Address: changeAddress, Coins: 500000, Hours: 1},
+	})
+	if err := cipher.VerifyAddressSignedHash(cipher.MustAddressFromSecKey(keys[0]), cipher.MustSigFromHex(resp.Data[0]), transaction.SignatureHash(innerHash, input)); err != nil {
+		t.Fatalf("the signature isn't made by the mock key of the input: %v", err)
+	}
+}
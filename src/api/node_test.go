@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/therealssj/testingdep2/src/node"
+)
+
+// testNode is a stand-in Skycoin node, it rejects addresses it doesn't know
+type testNode struct {
+	balances map[string]node.BalancePair
+	// used are the addresses with a transaction history
+	used map[string]bool
+	// outputs are the unspent outputs
+	outputs []node.UnspentOutput
+	// injected receives the broadcast transactions if set
+	injected chan string
+}
+
+// start serves the node and returns a client of it
+func (n testNode) start(t *testing.T) *node.Client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/balance", func(w http.ResponseWriter, r *http.Request) {
+		resp := node.BalanceResponse{
+			Addresses: make(map[string]node.BalancePair),
+		}
+		for _, a := range strings.Split(r.URL.Query().Get("addrs"), ",") {
+			b, ok := n.balances[a]
+			if !ok {
+				http.Error(w, "400 Bad Request - unknown address "+a, http.StatusBadRequest)
+				return
+			}
+			resp.Addresses[a] = b
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/api/v1/transactions", func(w http.ResponseWriter, r *http.Request) {
+		txns := []node.TransactionResult{}
+		for _, a := range strings.Split(r.URL.Query().Get("addrs"), ",") {
+			if n.used[a] {
+				txns = append(txns, node.TransactionResult{
+					Status: node.TransactionStatus{Confirmed: true},
+					Transaction: node.Transaction{
+						TxID:    "txid-" + a,
+						Outputs: []node.TransactionOutput{{Address: a}},
+					},
+				})
+			}
+		}
+
+		json.NewEncoder(w).Encode(txns)
+	})
+	mux.HandleFunc("/api/v1/outputs", func(w http.ResponseWriter, r *http.Request) {
+		addrs := make(map[string]bool)
+		for _, a := range strings.Split(r.URL.Query().Get("addrs"), ",") {
+			addrs[a] = true
+		}
+
+		resp := node.OutputsResponse{
+			HeadOutputs: []node.UnspentOutput{},
+		}
+		for _, o := range n.outputs {
+			if addrs[o.Address] {
+				resp.HeadOutputs = append(resp.HeadOutputs, o)
+			}
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/api/v1/injectTransaction", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RawTx string `json:"rawtx"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || n.injected == nil {
+			http.Error(w, "400 Bad Request - invalid transaction", http.StatusBadRequest)
+			return
+		}
+
+		n.injected <- req.RawTx
+		json.NewEncoder(w).Encode("txid")
+	})
+
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	c, err := node.NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
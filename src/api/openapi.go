@@ -0,0 +1,514 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/therealssj/testingdep2/src/bundle"
+	"github.com/therealssj/testingdep2/src/metrics"
+)
+
+const openAPIVersion = "3.0.2"
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// endpointDoc describes a single API endpoint for the OpenAPI document
+type endpointDoc struct {
+	Method  string
+	Summary string
+	// Request is a value of the JSON request body type, nil if the endpoint takes no body
+	Request interface{}
+	// Response is a value of the type returned in HTTPResponse.Data
+	Response interface{}
+	// Device is set if the endpoint forwards the request to a device and
+	// may answer with an intermediate firmware request (PIN, passphrase, word)
+	Device bool
+	// Emulator is set if the endpoint is also served under /emulator
+	Emulator bool
+	// Root is set if the endpoint is served at its path rather than under /api/v1
+	Root bool
+	// ContentType is set for endpoints that don't answer with a JSON HTTPResponse
+	ContentType string
+	// Mock is set if the endpoint is only served in mock mode
+	Mock bool
+	// Stream is a value of the data type of the lines streamed to clients accepting ContentTypeNDJSON,
+	// nil if the endpoint doesn't stream
+	Stream interface{}
+}
+
+// endpointDocs documents every endpoint, keyed by its path relative to /api/v1 unless Root is set.
+// Every endpoint registered in newServerMux must have an entry here.
+var endpointDocs = map[string]endpointDoc{
+	"/generate_addresses": {
+		Method:   http.MethodPost,
+		Summary:  "Generate addresses for the hardware wallet",
+		Request:  GenerateAddressesRequest{},
+		Response: []string{},
+		Device:   true,
+		Emulator: true,
+		Stream:   AddressBatch{},
+	},
+	"/addresses": {
+		Method:   http.MethodGet,
+		Summary:  "Addresses of the device found in the address cache, none are derived",
+		Response: CachedAddressesResponse{},
+		Device:   true,
+		Emulator: true,
+	},
+	"/balance": {
+		Method:   http.MethodGet,
+		Summary:  "Balance of device addresses as seen by the configured Skycoin node",
+		Response: BalanceResponse{},
+		Device:   true,
+		Emulator: true,
+	},
+	"/discover_addresses": {
+		Method:   http.MethodGet,
+		Summary:  "Find the used device addresses by their transaction history, up to a gap of unused addresses",
+		Response: DiscoverAddressesResponse{},
+		Device:   true,
+		Emulator: true,
+	},
+	"/address/qr": {
+		Method:      http.MethodGet,
+		Summary:     "QR code of a skycoin payment URI for a device address, as a PNG image or as SVG with format=svg",
+		Device:      true,
+		Emulator:    true,
+		ContentType: ContentTypePNG,
+	},
+	"/address/validate": {
+		Method:   http.MethodGet,
+		Summary:  "Validate a skycoin address without the device, reporting version and checksum errors and bitcoin addresses",
+		Response: AddressValidateResponse{},
+	},
+	"/apply_settings": {
+		Method:   http.MethodPost,
+		Summary:  "Apply device settings",
+		Request:  ApplySettingsRequest{},
+		Response: "",
+		Device:   true,
+		Emulator: true,
+	},
+	"/transaction_sign": {
+		Method:   http.MethodPost,
+		Summary:  "Sign a transaction with the device, change outputs are checked against the device addresses, the spending policy is enforced and the signatures are verified",
+		Request:  TransactionSignRequest{},
+		Response: []string{},
+		Device:   true,
+		Emulator: true,
+	},
+	"/transaction_preview": {
+		Method:   http.MethodPost,
+		Summary:  "Dry run of /transaction_sign without the device: the outputs as the device displays them, change, totals and warnings",
+		Request:  TransactionSignRequest{},
+		Response: TransactionPreviewResponse{},
+	},
+	"/send": {
+		Method:   http.MethodPost,
+		Summary:  "Send coins from the device addresses: select unspent outputs, sign with the device and optionally broadcast",
+		Request:  SendRequest{},
+		Response: SendResponse{},
+		Device:   true,
+		Emulator: true,
+	},
+	"/raw_transaction_sign": {
+		Method:   http.MethodPost,
+		Summary:  "Sign a serialized unsigned transaction with the device and return it signed, the signatures are verified against the input addresses",
+		Request:  RawTransactionSignRequest{},
+		Response: RawTransactionSignResponse{},
+		Device:   true,
+		Emulator: true,
+	},
+	"/bundle/export": {
+		Method:   http.MethodPost,
+		Summary:  "Create an unsigned offline signing bundle spending the outputs of the given addresses",
+		Request:  BundleExportRequest{},
+		Response: bundle.Bundle{},
+	},
+	"/bundle/sign": {
+		Method:   http.MethodPost,
+		Summary:  "Sign an offline signing bundle with the device, its input and change addresses are checked against the device",
+		Request:  bundle.Bundle{},
+		Response: bundle.Bundle{},
+		Device:   true,
+		Emulator: true,
+	},
+	"/bundle/import": {
+		Method:   http.MethodPost,
+		Summary:  "Finalize a signed offline signing bundle into a transaction and broadcast it if broadcast=true",
+		Request:  bundle.Bundle{},
+		Response: BundleImportResponse{},
+	},
+	"/payment_uri": {
+		Method:   http.MethodPost,
+		Summary:  "Parse a skycoin: payment URI into a prepared send request and a preview of the payment",
+		Request:  PaymentURIRequest{},
+		Response: PaymentURIResponse{},
+	},
+	"/sign_message": {
+		Method:   http.MethodPost,
+		Summary:  "Sign a message with the device address at address_index, the signature is also returned in the armored format",
+		Request:  SignMessageRequest{},
+		Response: SignMessageResponse{},
+		Device:   true,
+		Emulator: true,
+	},
+	"/verify_message": {
+		Method:   http.MethodPost,
+		Summary:  "Verify a signed or armored message without the device",
+		Request:  VerifyMessageRequest{},
+		Response: VerifyMessageResponse{},
+	},
+	"/version": {
+		Method:   http.MethodGet,
+		Summary:  "Daemon version, git commit, Go version and API version",
+		Response: VersionResponse{},
+	},
+	"/health": {
+		Method:   http.MethodGet,
+		Summary:  "State of the usb backends when the daemon started and of the emulator endpoint",
+		Response: HealthResponse{},
+	},
+	"/metrics": {
+		Method:      http.MethodGet,
+		Summary:     "Prometheus metrics",
+		Root:        true,
+		ContentType: metrics.ContentType,
+	},
+	"/mock/scenarios": {
+		Method:   http.MethodGet,
+		Summary:  "List the mock scenarios and the active one, only served in mock mode",
+		Response: MockScenarioResponse{},
+		Mock:     true,
+	},
+	"/mock/scenario": {
+		Method:   http.MethodPost,
+		Summary:  "Switch the active mock scenario, only served in mock mode",
+		Request:  MockScenarioRequest{},
+		Response: MockScenarioResponse{},
+		Mock:     true,
+	},
+	"/openapi.json": {
+		Method:  http.MethodGet,
+		Summary: "OpenAPI specification of the daemon API",
+	},
+}
+
+// OpenAPIDocument is an OpenAPI 3 document
+type OpenAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Servers    []OpenAPIServer            `json:"servers,omitempty"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components OpenAPIComponents          `json:"components"`
+}
+
+// OpenAPIInfo is the document metadata
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIServer is a server the API is reachable at
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// OpenAPIPathItem maps lowercase http methods to operations
+type OpenAPIPathItem map[string]OpenAPIOperation
+
+// OpenAPIOperation describes a single API operation on a path
+type OpenAPIOperation struct {
+	Summary     string                     `json:"summary,omitempty"`
+	OperationID string                     `json:"operationId,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIRequestBody describes an operation's request body
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse describes an operation's response
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType holds the schema of a request or response body
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIComponents holds reusable schemas
+type OpenAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas"`
+}
+
+// OpenAPISchema is a subset of the OpenAPI schema object
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	OneOf                []*OpenAPISchema          `json:"oneOf,omitempty"`
+}
+
+// newOpenAPIDocument builds the OpenAPI document from endpointDocs, mock mode endpoints are only included if mock is set
+func newOpenAPIDocument(host string, mock bool) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: OpenAPIInfo{
+			Title:   "Skycoin hardware wallet daemon API",
+			Version: apiVersion1,
+		},
+		Paths: make(map[string]OpenAPIPathItem),
+		Components: OpenAPIComponents{
+			Schemas: make(map[string]*OpenAPISchema),
+		},
+	}
+
+	if host != "" {
+		doc.Servers = []OpenAPIServer{{URL: "http://" + host}}
+	}
+
+	doc.Components.Schemas["HTTPError"] = doc.schemaOf(reflect.TypeOf(HTTPError{}))
+	doc.Components.Schemas["HTTPResponse"] = doc.schemaOf(reflect.TypeOf(HTTPResponse{}))
+
+	paths := make([]string, 0, len(endpointDocs))
+	for p := range endpointDocs {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		e := endpointDocs[p]
+		if e.Mock && !mock {
+			continue
+		}
+		if e.Root {
+			doc.addPath(p, e)
+			continue
+		}
+		doc.addPath("/api/"+apiVersion1+p, e)
+		if e.Emulator {
+			doc.addPath("/api/"+apiVersion1+"/emulator"+p, e)
+		}
+	}
+
+	return doc
+}
+
+func (doc *OpenAPIDocument) addPath(path string, e endpointDoc) {
+	ok := OpenAPIResponse{
+		Description: "OK",
+		Content:     jsonContent(doc.responseSchema(e)),
+	}
+	if e.ContentType != "" {
+		ok.Content = map[string]OpenAPIMediaType{
+			e.ContentType: {Schema: &OpenAPISchema{Type: "string"}},
+		}
+	}
+	if e.Stream != nil {
+		ok.Content[ContentTypeNDJSON] = OpenAPIMediaType{
+			Schema: doc.envelopeSchema(doc.schemaOf(reflect.TypeOf(e.Stream))),
+		}
+	}
+
+	op := OpenAPIOperation{
+		Summary:     e.Summary,
+		OperationID: operationID(e.Method, path),
+		Responses: map[string]OpenAPIResponse{
+			"200": ok,
+			"default": {
+				Description: "Error, see the error field of the response",
+				Content:     jsonContent(&OpenAPISchema{Ref: "#/components/schemas/HTTPResponse"}),
+			},
+		},
+	}
+
+	if e.Request != nil {
+		op.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content:  jsonContent(doc.schemaOf(reflect.TypeOf(e.Request))),
+		}
+	}
+
+	doc.Paths[path] = OpenAPIPathItem{
+		strings.ToLower(e.Method): op,
+	}
+}
+
+// responseSchema returns the HTTPResponse envelope schema with the data field set to the endpoint's response type
+func (doc *OpenAPIDocument) responseSchema(e endpointDoc) *OpenAPISchema {
+	if e.Response == nil {
+		return &OpenAPISchema{Type: "object"}
+	}
+
+	data := doc.schemaOf(reflect.TypeOf(e.Response))
+	if e.Device {
+		data = &OpenAPISchema{
+			OneOf: []*OpenAPISchema{
+				data,
+				{
+					Type: "string",
+					Enum: []string{"PinMatrixRequest", "PassPhraseRequest", "WordRequest"},
+				},
+			},
+		}
+	}
+
+	return doc.envelopeSchema(data)
+}
+
+// envelopeSchema returns the HTTPResponse envelope schema with the given data field
+func (doc *OpenAPIDocument) envelopeSchema(data *OpenAPISchema) *OpenAPISchema {
+	return &OpenAPISchema{
+		Type: "object",
+		Properties: map[string]*OpenAPISchema{
+			"data":  data,
+			"error": {Ref: "#/components/schemas/HTTPError"},
+		},
+	}
+}
+
+// schemaOf derives a schema from a go type, registering named structs as components
+func (doc *OpenAPIDocument) schemaOf(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	}
+
+	// types with their own JSON encoding, such as coin amounts, are encoded as strings
+	if t.Kind() != reflect.Struct && t.Kind() != reflect.Slice && t.Implements(jsonMarshalerType) {
+		return &OpenAPISchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &OpenAPISchema{Type: "number"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: doc.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: doc.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return doc.structSchema(t)
+		}
+		if _, ok := doc.Components.Schemas[t.Name()]; !ok {
+			// reserve the name first so that recursive types terminate
+			doc.Components.Schemas[t.Name()] = nil
+			doc.Components.Schemas[t.Name()] = doc.structSchema(t)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + t.Name()}
+	default:
+		// interface{} and json.RawMessage accept any value
+		return &OpenAPISchema{}
+	}
+}
+
+func (doc *OpenAPIDocument) structSchema(t reflect.Type) *OpenAPISchema {
+	s := &OpenAPISchema{
+		Type:       "object",
+		Properties: make(map[string]*OpenAPISchema),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		// embedded structs without a json name are flattened, as encoding/json does
+		if f.Anonymous && f.Tag.Get("json") == "" && f.Type.Kind() == reflect.Struct {
+			for k, v := range doc.structSchema(f.Type).Properties {
+				s.Properties[k] = v
+			}
+			continue
+		}
+
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+
+		s.Properties[name] = doc.schemaOf(f.Type)
+	}
+
+	return s
+}
+
+func jsonContent(s *OpenAPISchema) map[string]OpenAPIMediaType {
+	return map[string]OpenAPIMediaType{
+		ContentTypeJSON: {Schema: s},
+	}
+}
+
+// operationID builds a unique operation id such as "postEmulatorGenerateAddresses"
+func operationID(method, path string) string {
+	path = strings.TrimPrefix(path, "/api/"+apiVersion1)
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '_' || r == '.'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// openAPISpec returns the OpenAPI specification of the API
+// URI: /api/v1/openapi.json
+// Method: GET
+func openAPISpec(doc *OpenAPIDocument) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		out, err := json.MarshalIndent(doc, "", "    ")
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusInternalServerError, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		if _, err := w.Write(out); err != nil {
+			logger.WithError(err).Error("http Write failed")
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/therealssj/testingdep2/src/mock"
+)
+
+func TestOpenAPIDocumentsEveryEndpoint(t *testing.T) {
+	scenarios, err := mock.LoadScenarios("../mock/testdata/scenarios.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockGateway, err := mock.NewGateway(scenarios)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("device", func(t *testing.T) {
+		testOpenAPIDocumentsEveryEndpoint(t, muxConfig{host: "127.0.0.1:9510"})
+	})
+	t.Run("mock", func(t *testing.T) {
+		testOpenAPIDocumentsEveryEndpoint(t, muxConfig{host: "127.0.0.1:9510", mockGateway: mockGateway})
+	})
+}
+
+func testOpenAPIDocumentsEveryEndpoint(t *testing.T, c muxConfig) {
+	mux, endpoints := newServerMux(c, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("openapi.json returned status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var doc OpenAPIDocument
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("openapi.json is not valid json: %v", err)
+	}
+
+	if doc.OpenAPI != openAPIVersion {
+		t.Fatalf("openapi version is %q, expected %q", doc.OpenAPI, openAPIVersion)
+	}
+
+	registered := make(map[string]struct{}, len(endpoints))
+	for _, e := range endpoints {
+		registered[e] = struct{}{}
+		if _, ok := doc.Paths[e]; !ok {
+			t.Errorf("endpoint %s is registered but missing from the OpenAPI document, add it to endpointDocs", e)
+		}
+	}
+
+	for p := range doc.Paths {
+		if _, ok := registered[p]; !ok {
+			t.Errorf("path %s is in the OpenAPI document but is not registered", p)
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	doc := newOpenAPIDocument("", false)
+
+	for _, name := range []string{"HTTPError", "HTTPResponse", "GenerateAddressesRequest", "ApplySettingsRequest"} {
+		if doc.Components.Schemas[name] == nil {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+
+	s := doc.Components.Schemas["GenerateAddressesRequest"]
+	for _, p := range []string{"address_n", "start_index", "confirm_address"} {
+		if _, ok := s.Properties[p]; !ok {
+			t.Errorf("GenerateAddressesRequest schema is missing property %s", p)
+		}
+	}
+}
+
+func TestOpenAPIMethodNotAllowed(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	openAPISpec(newOpenAPIDocument("", false)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+	wh "github.com/skycoin/skycoin/src/util/http"
+
+	"github.com/therealssj/testingdep2/src/uri"
+)
+
+// PaymentURIRequest is request data for /api/v1/payment_uri
+type PaymentURIRequest struct {
+	URI string `json:"uri"`
+	// AddressN is copied to the prepared send request
+	AddressN int `json:"address_n,omitempty"`
+}
+
+// PaymentURIResponse is data returned by /api/v1/payment_uri
+type PaymentURIResponse struct {
+	Address string   `json:"address"`
+	Coins   wh.Coins `json:"coins"`
+	// Hours is set if the URI requests an amount of coin hours
+	Hours   *wh.Hours `json:"hours,omitempty"`
+	Label   string    `json:"label,omitempty"`
+	Message string    `json:"message,omitempty"`
+	// Send is a /api/v1/send request paying the URI, it is missing if the URI has no amount
+	Send *SendRequest `json:"send,omitempty"`
+	// Preview describes the payment for the user
+	Preview string `json:"preview"`
+}
+
+// parsePaymentURI parses a skycoin: payment URI and prepares the send request paying it.
+// It doesn't use the device.
+// URI: /api/v1/payment_uri
+// Method: POST
+// Args: JSON Body
+func parsePaymentURI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != ContentTypeJSON {
+			resp := NewHTTPErrorResponse(http.StatusUnsupportedMediaType, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		var req PaymentURIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusBadRequest, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		defer r.Body.Close()
+
+		if req.AddressN < 0 {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, "address_n cannot be negative")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		u, err := uri.Parse(req.URI)
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: newPaymentURIResponse(u, req.AddressN),
+		})
+	}
+}
+
+func newPaymentURIResponse(u uri.URI, addressN int) PaymentURIResponse {
+	resp := PaymentURIResponse{
+		Address: u.Address,
+		Coins:   wh.Coins(u.Coins),
+		Label:   u.Label,
+		Message: u.Message,
+	}
+	if u.Hours != 0 {
+		hours := wh.Hours(u.Hours)
+		resp.Hours = &hours
+	}
+
+	if u.Coins != 0 {
+		resp.Send = &SendRequest{
+			To: []SendDestination{
+				{
+					Address: u.Address,
+					Coins:   resp.Coins,
+					Hours:   resp.Hours,
+				},
+			},
+			AddressN: addressN,
+		}
+	}
+
+	resp.Preview = paymentPreview(u)
+	return resp
+}
+
+// paymentPreview describes a payment in a few lines of text
+func paymentPreview(u uri.URI) string {
+	var lines []string
+	if u.Coins == 0 {
+		lines = append(lines, fmt.Sprintf("Pay an amount of your choice to %s", u.Address))
+	} else {
+		// Parse rejects amounts droplet can't format
+		coins, _ := droplet.ToString(u.Coins)
+		lines = append(lines, fmt.Sprintf("Pay %s SKY to %s", coins, u.Address))
+	}
+
+	if u.Hours != 0 {
+		lines = append(lines, fmt.Sprintf("Coin hours: %d", u.Hours))
+	} else {
+		lines = append(lines, "Coin hours: a share of the hours left after the fee")
+	}
+
+	if u.Label != "" {
+		lines = append(lines, "Label: "+u.Label)
+	}
+	if u.Message != "" {
+		lines = append(lines, "Message: "+u.Message)
+	}
+
+	return strings.Join(lines, "\n")
+}
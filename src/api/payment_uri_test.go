@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	wh "github.com/skycoin/skycoin/src/util/http"
+)
+
+func TestParsePaymentURI(t *testing.T) {
+	address := newTestAddresses(t, 1)[0]
+	hours := wh.Hours(10)
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "other scheme",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        fmt.Sprintf(`{"uri": "bitcoin:%s"}`, address),
+			status:      http.StatusUnprocessableEntity,
+			err:         "not a skycoin: URI",
+		},
+		{
+			name:        "overflowing amount",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        fmt.Sprintf(`{"uri": "skycoin:%s?amount=99999999999999"}`, address),
+			status:      http.StatusUnprocessableEntity,
+			err:         "invalid amount: Droplet string conversion failed: Value is too large",
+		},
+		{
+			name:        "payment",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        fmt.Sprintf(`{"uri": "skycoin:%s?amount=12.5&hours=10&label=rent&message=march%%202026", "address_n": 5}`, address),
+			status:      http.StatusOK,
+			data: PaymentURIResponse{
+				Address: address,
+				Coins:   12500000,
+				Hours:   &hours,
+				Label:   "rent",
+				Message: "march 2026",
+				Send: &SendRequest{
+					To:       []SendDestination{{Address: address, Coins: 12500000, Hours: &hours}},
+					AddressN: 5,
+				},
+				Preview: fmt.Sprintf("Pay 12.500000 SKY to %s\nCoin hours: 10\nLabel: rent\nMessage: march 2026", address),
+			},
+		},
+		{
+			name:        "no amount",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        fmt.Sprintf(`{"uri": "skycoin:%s"}`, address),
+			status:      http.StatusOK,
+			data: PaymentURIResponse{
+				Address: address,
+				Preview: fmt.Sprintf("Pay an amount of your choice to %s\nCoin hours: a share of the hours left after the fee", address),
+			},
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/payment_uri", func(g Gatewayer) http.Handler {
+		return parsePaymentURI()
+	}, cases)
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	wh "github.com/skycoin/skycoin/src/util/http"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/policy"
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+// RawTransactionSignRequest is request data for /api/v1/raw_transaction_sign
+type RawTransactionSignRequest struct {
+	// RawTx is the hex encoded serialized unsigned transaction
+	RawTx string `json:"raw_tx"`
+	// InputIndices are the indices of the device addresses owning the inputs, in the same order
+	InputIndices []uint32 `json:"input_indices"`
+	// ChangeIndex is the index of a device address, the outputs sent to it are change
+	ChangeIndex *uint32 `json:"change_index,omitempty"`
+}
+
+// RawTransactionSignResponse is data returned by /api/v1/raw_transaction_sign
+type RawTransactionSignResponse struct {
+	TxID string `json:"txid"`
+	// RawTx is the hex encoded serialized signed transaction
+	RawTx string `json:"raw_tx"`
+}
+
+// rawTransactionSign signs a serialized unsigned transaction with the device. Its inputs and
+// outputs are sent to the device, the returned signatures are verified against the addresses
+// the device derives at input_indices and inserted in the transaction.
+// URI: /api/v1/raw_transaction_sign
+// Method: POST
+// Args: JSON Body
+func rawTransactionSign(gateway Gatewayer, cache *addressCache, engine *policy.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != ContentTypeJSON {
+			resp := NewHTTPErrorResponse(http.StatusUnsupportedMediaType, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		var req RawTransactionSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusBadRequest, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		defer r.Body.Close()
+
+		txn, err := req.transaction()
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		key, msg, err := addressCacheKey(gateway, cache)
+		if err != nil {
+			logger.Error("rawTransactionSign failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		addresses, msg, err := deviceAddressesAt(gateway, cache, key, req.addressIndices())
+		if err != nil {
+			logger.Error("rawTransactionSign failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		signReq := newRawTransactionSignRequest(txn, req, addresses)
+		if _, ok := signAuthorized(w, r, gateway, engine, signReq, func(signatures []string) error {
+			return insertSignatures(txn, signatures, signReq.TransactionInputs, addresses)
+		}); !ok {
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: RawTransactionSignResponse{
+				TxID:  txn.Hash().Hex(),
+				RawTx: hex.EncodeToString(txn.Serialize()),
+			},
+		})
+	}
+}
+
+// transaction decodes and validates the unsigned transaction of the request
+func (req RawTransactionSignRequest) transaction() (*transaction.Transaction, error) {
+	b, err := hex.DecodeString(req.RawTx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid raw_tx: %v", err)
+	}
+
+	txn, err := transaction.Deserialize(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid raw_tx: %v", err)
+	}
+
+	if txn.InnerHash != transaction.HashInner(txn.In, txn.Out) {
+		return nil, fmt.Errorf("invalid raw_tx: inner hash does not match the inputs and outputs")
+	}
+	if len(txn.In) > transaction.MaxInputs {
+		return nil, transaction.ErrTooManyInputs
+	}
+	if len(txn.Out) > transaction.MaxOutputs {
+		return nil, transaction.ErrTooManyOutputs
+	}
+	if len(req.InputIndices) != len(txn.In) {
+		return nil, fmt.Errorf("input_indices has %d indices for %d inputs", len(req.InputIndices), len(txn.In))
+	}
+
+	// unsigned transactions have no signatures or a null signature per input
+	for _, sig := range txn.Sigs {
+		if sig != (cipher.Sig{}) {
+			return nil, fmt.Errorf("raw_tx is already signed")
+		}
+	}
+
+	return txn, nil
+}
+
+// addressIndices returns the indices of the device addresses the request refers to
+func (req RawTransactionSignRequest) addressIndices() []uint32 {
+	indices := req.InputIndices
+	if req.ChangeIndex != nil {
+		indices = append(indices[:len(indices):len(indices)], *req.ChangeIndex)
+	}
+	return indices
+}
+
+// newRawTransactionSignRequest describes the transaction inputs and outputs, the outputs sent to the
+// change address have its index
+func newRawTransactionSignRequest(txn *transaction.Transaction, req RawTransactionSignRequest, addresses map[uint32]string) TransactionSignRequest {
+	signReq := TransactionSignRequest{
+		TransactionInputs:  make([]TransactionInput, len(txn.In)),
+		TransactionOutputs: make([]TransactionOutput, len(txn.Out)),
+	}
+
+	for i, in := range txn.In {
+		signReq.TransactionInputs[i] = TransactionInput{
+			Index: req.InputIndices[i],
+			Hash:  in.Hex(),
+		}
+	}
+
+	for i, o := range txn.Out {
+		signReq.TransactionOutputs[i] = TransactionOutput{
+			Address: o.Address.String(),
+			Coins:   wh.Coins(o.Coins),
+			Hours:   wh.Hours(o.Hours),
+		}
+		if req.ChangeIndex != nil && addresses[*req.ChangeIndex] == o.Address.String() {
+			signReq.TransactionOutputs[i].AddressIndex = req.ChangeIndex
+		}
+	}
+
+	return signReq
+}
+
+// deviceAddressesAt derives the device addresses at the given indices, the cached addresses
+// aren't derived again. If the device answers with anything else than addresses, the answer
+// is returned instead.
+func deviceAddressesAt(gateway Gatewayer, cache *addressCache, key walletKey, indices []uint32) (map[uint32]string, *wire.Message, error) {
+	addresses := make(map[uint32]string, len(indices))
+	for _, index := range indices {
+		if _, ok := addresses[index]; ok {
+			continue
+		}
+
+		batch, msg, err := generateAddressBatch(gateway, cache, key, int(index), 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if batch == nil {
+			return nil, &msg, nil
+		}
+		addresses[index] = batch[0]
+	}
+
+	return addresses, nil, nil
+}
+
+// insertSignatures verifies the signatures of the device and inserts them in the transaction
+func insertSignatures(txn *transaction.Transaction, signatures []string, inputs []TransactionInput, addresses map[uint32]string) error {
+	sigs, err := verifySignatures(txn, inputs, signatures, addresses)
+	if err != nil {
+		return err
+	}
+
+	txn.Sigs = sigs
+	txn.UpdateHeader()
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/skycoin/skycoin/src/cipher"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+func TestRawTransactionSign(t *testing.T) {
+	keys, err := cipher.GenerateDeterministicKeyPairs([]byte("raw transaction sign"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses := make([]cipher.Address, len(keys))
+	for i, k := range keys {
+		addresses[i] = cipher.MustAddressFromSecKey(k)
+	}
+	dest := cipher.MustDecodeBase58Address(newTestAddresses(t, 1)[0])
+	uxHash := cipher.SumSHA256([]byte("unspent"))
+
+	unsigned := transaction.Transaction{
+		Sigs: []cipher.Sig{{}},
+		In:   []cipher.SHA256{uxHash},
+		Out: []transaction.Output{
+			{Address: dest, Coins: 1000000, Hours: 2},
+			{Address: addresses[2], Coins: 500000, Hours: 1},
+		},
+	}
+	unsigned.UpdateHeader()
+	rawTx := hex.EncodeToString(unsigned.Serialize())
+
+	signed := unsigned
+	sig := cipher.MustSignHash(transaction.SignatureHash(unsigned.InnerHash, uxHash), keys[1])
+	signed.Sigs = []cipher.Sig{sig}
+
+	alreadySigned := signed
+	alreadySigned.UpdateHeader()
+
+	signResponse := func(sig cipher.Sig) mockResponse {
+		return respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseTransactionSign, &messages.ResponseTransactionSign{
+			Signatures: []string{sig.Hex()},
+			Finished:   proto.Bool(true),
+		}))
+	}
+	addressAt := func(i int) mockResponse {
+		return respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, &messages.ResponseSkycoinAddress{
+			Addresses: []string{addresses[i].String()},
+		}))
+	}
+	deviceCalls := []mockCall{
+		{Method: "GetFeatures"},
+		{Method: "AddressGen", Args: []interface{}{1, 1, false}},
+		{Method: "AddressGen", Args: []interface{}{1, 2, false}},
+		{Method: "TransactionSign", Args: []interface{}{
+			[]*messages.SkycoinTransactionInput{
+				{HashIn: proto.String(uxHash.Hex()), Index: proto.Uint32(1)},
+			},
+			[]*messages.SkycoinTransactionOutput{
+				{Address: proto.String(dest.String()), Coin: proto.Uint64(1000000), Hour: proto.Uint64(2)},
+				{Address: proto.String(addresses[2].String()), AddressIndex: proto.Uint32(2), Coin: proto.Uint64(500000), Hour: proto.Uint64(1)},
+			},
+		}},
+	}
+	body := func(rawTx string) string {
+		return fmt.Sprintf(`{"raw_tx": "%s", "input_indices": [1], "change_index": 2}`, rawTx)
+	}
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "invalid raw transaction",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(rawTx[:len(rawTx)-2]),
+			status:      http.StatusUnprocessableEntity,
+			err:         "invalid raw_tx: " + transaction.ErrTruncated.Error(),
+		},
+		{
+			name:        "already signed",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(hex.EncodeToString(alreadySigned.Serialize())),
+			status:      http.StatusUnprocessableEntity,
+			err:         "raw_tx is already signed",
+		},
+		{
+			name:        "missing input indices",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        fmt.Sprintf(`{"raw_tx": "%s"}`, rawTx),
+			status:      http.StatusUnprocessableEntity,
+			err:         "input_indices has 0 indices for 1 inputs",
+		},
+		{
+			name:        "ok",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(rawTx),
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				addressAt(1),
+				addressAt(2),
+				signResponse(sig),
+			},
+			calls:  deviceCalls,
+			status: http.StatusOK,
+			data: RawTransactionSignResponse{
+				TxID:  signed.Hash().Hex(),
+				RawTx: hex.EncodeToString(signed.Serialize()),
+			},
+		},
+		{
+			name:        "signature of another address",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(rawTx),
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				addressAt(1),
+				addressAt(2),
+				signResponse(cipher.MustSignHash(transaction.SignatureHash(unsigned.InnerHash, uxHash), keys[0])),
+			},
+			calls:  deviceCalls,
+			status: http.StatusBadGateway,
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/raw_transaction_sign", func(g Gatewayer) http.Handler {
+		return rawTransactionSign(g, newAddressCache(), nil)
+	}, cases)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+
+	"github.com/therealssj/testingdep2/src/driver"
+)
+
+const resilienceMnemonic = "cloud flower upset remain green metal below cup stem infant art thank"
+
+// TestFlakyDeviceStatusCodes runs generate_addresses against a simulated device with injected faults
+// and checks that every request completes with the expected status code without leaking goroutines
+func TestFlakyDeviceStatusCodes(t *testing.T) {
+	cases := []struct {
+		name    string
+		faults  driver.FaultConfig
+		confirm bool
+		status  int
+	}{
+		{
+			name:   "healthy device",
+			status: http.StatusOK,
+		},
+		{
+			name:   "slow device",
+			faults: driver.FaultConfig{ReadDelay: 20 * time.Millisecond},
+			status: http.StatusOK,
+		},
+		{
+			name:   "no device",
+			faults: driver.FaultConfig{ConnectError: errors.New(errNoDeviceConnected)},
+			status: http.StatusServiceUnavailable,
+		},
+		{
+			name:   "unplugged mid message",
+			faults: driver.FaultConfig{DisconnectAfterReads: 1},
+			status: http.StatusServiceUnavailable,
+		},
+		{
+			name:    "unplugged while waiting for the button",
+			faults:  driver.FaultConfig{DisconnectAfterReads: 1},
+			confirm: true,
+			status:  http.StatusServiceUnavailable,
+		},
+		{
+			name:   "connection closed",
+			faults: driver.FaultConfig{CloseAfterBytes: driver.PacketLen},
+			status: http.StatusServiceUnavailable,
+		},
+		{
+			name:   "corrupt answer",
+			faults: driver.FaultConfig{CorruptReadEvery: 1, CorruptOffset: 2},
+			status: http.StatusBadGateway,
+		},
+		{
+			name:   "lost request",
+			faults: driver.FaultConfig{DropWriteEvery: 1},
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	goroutines := runtime.NumGoroutine()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := driver.NewSimulator(driver.SimulatorConfig{Mnemonic: resilienceMnemonic})
+			dev := &deviceWallet.Device{
+				Driver: driver.NewValidatingDriver(driver.NewFaultDriver(sim, tc.faults), 0),
+			}
+
+			body := `{"address_n": 5, "start_index": 0, "confirm_address": false}`
+			if tc.confirm {
+				body = `{"address_n": 1, "start_index": 0, "confirm_address": true}`
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/generate_addresses", strings.NewReader(body))
+			req.Header.Set("Content-Type", ContentTypeJSON)
+			rr := httptest.NewRecorder()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				generateAddresses(dev, newAddressCache(), defaultAddressBatchSize).ServeHTTP(rr, req)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("request did not complete")
+			}
+
+			if rr.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	// give finished goroutines a moment to exit before counting
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Fatalf("%d goroutines leaked", n-goroutines)
+	}
+}
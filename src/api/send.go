@@ -0,0 +1,334 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/util/droplet"
+	wh "github.com/skycoin/skycoin/src/util/http"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/node"
+	"github.com/therealssj/testingdep2/src/policy"
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+// SendRequest is request data for /api/v1/send
+type SendRequest struct {
+	To []SendDestination `json:"to"`
+	// AddressN is the number of device addresses, from index 0, whose outputs may be spent
+	AddressN int `json:"address_n"`
+	// ChangeIndex is the index of the device address receiving the change,
+	// the address of the first spent output by default
+	ChangeIndex *uint32 `json:"change_index,omitempty"`
+	// Broadcast makes the node broadcast the signed transaction
+	Broadcast bool `json:"broadcast"`
+}
+
+// SendDestination is an output of a transaction created by /api/v1/send
+type SendDestination struct {
+	Address string   `json:"address"`
+	Coins   wh.Coins `json:"coins"`
+	// Hours are the coin hours sent, if missing the destination receives a share of the
+	// hours left after the fee proportional to its coins
+	Hours *wh.Hours `json:"hours,omitempty"`
+}
+
+// SendResponse is data returned by /api/v1/send
+type SendResponse struct {
+	TxID string `json:"txid"`
+	// RawTx is the hex encoded serialized signed transaction
+	RawTx   string              `json:"rawtx"`
+	Inputs  []TransactionInput  `json:"inputs"`
+	Outputs []TransactionOutput `json:"outputs"`
+	// Fee is the number of coin hours burned
+	Fee       uint64 `json:"fee"`
+	Broadcast bool   `json:"broadcast"`
+}
+
+// send creates a transaction sending coins from the device addresses, signs it with the device
+// and optionally broadcasts it. The unspent outputs of the first address_n device addresses are
+// fetched from the Skycoin node, the outputs holding the most coins are spent first. The change
+// is sent back to a device address.
+// URI: /api/v1/send
+// Method: POST
+// Args: JSON Body
+func send(gateway Gatewayer, cache *addressCache, batchSize int, engine *policy.Engine, client *node.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != ContentTypeJSON {
+			resp := NewHTTPErrorResponse(http.StatusUnsupportedMediaType, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		var req SendRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusBadRequest, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		defer r.Body.Close()
+
+		destinations, err := req.destinations()
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if client == nil {
+			resp := NewHTTPErrorResponse(http.StatusServiceUnavailable, "no skycoin node is configured")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		addresses, changeAddress, msg, err := req.deviceAddresses(gateway, cache, batchSize)
+		if err != nil {
+			logger.Error("send failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		unspents, err := spendableOutputs(client, addresses)
+		if err != nil {
+			logger.Error("send failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(http.StatusBadGateway, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		spend, err := transaction.Create(unspents, destinations, changeAddress)
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		data := newSendResponse(spend, addresses, req.ChangeIndex)
+		var txn *transaction.Transaction
+		if _, ok := signAuthorized(w, r, gateway, engine, TransactionSignRequest{
+			TransactionInputs:  data.Inputs,
+			TransactionOutputs: data.Outputs,
+		}, func(signatures []string) error {
+			var err error
+			txn, err = signedTransaction(spend, signatures, data.Inputs, addresses)
+			return err
+		}); !ok {
+			return
+		}
+
+		data.TxID = txn.Hash().Hex()
+		data.RawTx = hex.EncodeToString(txn.Serialize())
+
+		if req.Broadcast {
+			if _, err := client.InjectTransaction(data.RawTx); err != nil {
+				logger.Error("send failed: %s", err.Error())
+				resp := NewHTTPErrorResponse(http.StatusBadGateway, err.Error())
+				writeHTTPResponse(w, resp)
+				return
+			}
+			data.Broadcast = true
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: data,
+		})
+	}
+}
+
+// destinations validates the destinations of the request
+func (req SendRequest) destinations() ([]transaction.Destination, error) {
+	if req.AddressN <= 0 {
+		return nil, fmt.Errorf("address_n must be positive")
+	}
+	if req.AddressN > maxDiscoveredAddresses {
+		return nil, fmt.Errorf("address_n cannot be more than %d", maxDiscoveredAddresses)
+	}
+	if len(req.To) == 0 {
+		return nil, fmt.Errorf("to cannot be empty")
+	}
+
+	destinations := make([]transaction.Destination, len(req.To))
+	for i, to := range req.To {
+		addr, err := cipher.DecodeBase58Address(to.Address)
+		if err != nil {
+			return nil, fmt.Errorf("destination %d: invalid address: %v", i, err)
+		}
+
+		destinations[i] = transaction.Destination{
+			Address: addr,
+			Coins:   to.Coins.Value(),
+		}
+		if to.Hours != nil {
+			hours := to.Hours.Value()
+			destinations[i].Hours = &hours
+		}
+	}
+
+	return destinations, nil
+}
+
+// deviceAddresses derives the addresses whose outputs may be spent and the change address if
+// it is set. If the device answers with anything else than addresses, the answer is returned instead.
+func (req SendRequest) deviceAddresses(gateway Gatewayer, cache *addressCache, batchSize int) ([]string, *cipher.Address, *wire.Message, error) {
+	key, msg, err := addressCacheKey(gateway, cache)
+	if err != nil || msg != nil {
+		return nil, nil, msg, err
+	}
+
+	addresses, msg, err := deriveAddresses(gateway, cache, key, batchSize, 0, req.AddressN)
+	if err != nil || msg != nil {
+		return nil, nil, msg, err
+	}
+
+	if req.ChangeIndex == nil {
+		return addresses, nil, nil, nil
+	}
+
+	change, msg, err := deriveAddresses(gateway, cache, key, batchSize, int(*req.ChangeIndex), 1)
+	if err != nil || msg != nil {
+		return nil, nil, msg, err
+	}
+
+	changeAddress, err := cipher.DecodeBase58Address(change[0])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return addresses, &changeAddress, nil, nil
+}
+
+// spendableOutputs returns the outputs of the addresses the node reports as spendable
+func spendableOutputs(client *node.Client, addresses []string) ([]transaction.UnspentOutput, error) {
+	outputs, err := client.Outputs(addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make(map[string]bool, len(addresses))
+	for _, a := range addresses {
+		owned[a] = true
+	}
+
+	var unspents []transaction.UnspentOutput
+	for _, o := range outputs.Spendable() {
+		// only the outputs of device addresses can be signed
+		if !owned[o.Address] {
+			continue
+		}
+
+		hash, err := cipher.SHA256FromHex(o.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("node returned an invalid output hash: %v", err)
+		}
+		addr, err := cipher.DecodeBase58Address(o.Address)
+		if err != nil {
+			return nil, fmt.Errorf("node returned an invalid output address: %v", err)
+		}
+		coins, err := droplet.FromString(o.Coins)
+		if err != nil {
+			return nil, fmt.Errorf("node returned invalid output coins: %v", err)
+		}
+
+		unspents = append(unspents, transaction.UnspentOutput{
+			Hash:    hash,
+			Address: addr,
+			Coins:   coins,
+			Hours:   o.CalculatedHours,
+		})
+	}
+
+	return unspents, nil
+}
+
+// newSendResponse describes the transaction inputs and outputs, the change output has the
+// index of the device address receiving it
+func newSendResponse(spend *transaction.Spend, addresses []string, changeIndex *uint32) SendResponse {
+	indices := make(map[string]uint32, len(addresses))
+	for i, a := range addresses {
+		indices[a] = uint32(i)
+	}
+
+	data := SendResponse{
+		Inputs:  make([]TransactionInput, len(spend.Inputs)),
+		Outputs: make([]TransactionOutput, len(spend.Outputs)),
+		Fee:     spend.Fee,
+	}
+
+	for i, in := range spend.Inputs {
+		data.Inputs[i] = TransactionInput{
+			Index: indices[in.Address.String()],
+			Hash:  in.Hash.Hex(),
+		}
+	}
+
+	for i, o := range spend.Outputs {
+		data.Outputs[i] = TransactionOutput{
+			Address: o.Address.String(),
+			Coins:   wh.Coins(o.Coins),
+			Hours:   wh.Hours(o.Hours),
+		}
+	}
+
+	if spend.Change != -1 {
+		if changeIndex == nil {
+			// the change goes to the address of the first input
+			index := data.Inputs[0].Index
+			changeIndex = &index
+		}
+		data.Outputs[spend.Change].AddressIndex = changeIndex
+	}
+
+	return data
+}
+
+// signTransaction asks the device to sign the transaction, acknowledging button requests
+func signTransaction(gateway Gatewayer, inputs []*messages.SkycoinTransactionInput, outputs []*messages.SkycoinTransactionOutput) (wire.Message, error) {
+	msg, err := gateway.TransactionSign(inputs, outputs)
+	for err == nil && msg.Kind == uint16(messages.MessageType_MessageType_ButtonRequest) {
+		start := time.Now()
+		msg, err = gateway.ButtonAck()
+		observeButtonAck(start, msg, err)
+	}
+	return msg, err
+}
+
+// signedTransaction assembles the spend and the signatures of its inputs, verifying that each
+// signature was made by the device address owning its input
+func signedTransaction(spend *transaction.Spend, signatures []string, inputs []TransactionInput, addresses []string) (*transaction.Transaction, error) {
+	txn := &transaction.Transaction{
+		In:  make([]cipher.SHA256, len(spend.Inputs)),
+		Out: spend.Outputs,
+	}
+	for i, in := range spend.Inputs {
+		txn.In[i] = in.Hash
+	}
+	txn.UpdateHeader()
+
+	owners := make(map[uint32]string, len(inputs))
+	for _, in := range inputs {
+		owners[in.Index] = addresses[in.Index]
+	}
+
+	if err := insertSignatures(txn, signatures, inputs, owners); err != nil {
+		return nil, err
+	}
+
+	return txn, nil
+}
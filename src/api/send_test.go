@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/skycoin/skycoin/src/cipher"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+
+	"github.com/therealssj/testingdep2/src/node"
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+func TestSend(t *testing.T) {
+	keys, err := cipher.GenerateDeterministicKeyPairs([]byte("send"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	own := []string{
+		cipher.MustAddressFromSecKey(keys[0]).String(),
+		cipher.MustAddressFromSecKey(keys[1]).String(),
+	}
+	dest := newTestAddresses(t, 1)[0]
+	uxHash := cipher.SumSHA256([]byte("unspent"))
+
+	// 20 hours, 10 are burned and half of the rest is shared
+	txn := transaction.Transaction{
+		In: []cipher.SHA256{uxHash},
+		Out: []transaction.Output{
+			{Address: cipher.MustDecodeBase58Address(dest), Coins: 2000000, Hours: 5},
+			{Address: cipher.MustDecodeBase58Address(own[1]), Coins: 3000000, Hours: 5},
+		},
+	}
+	sig := cipher.MustSignHash(transaction.SignatureHash(transaction.HashInner(txn.In, txn.Out), uxHash), keys[1])
+	txn.Sigs = []cipher.Sig{sig}
+	txn.UpdateHeader()
+
+	injected := make(chan string, 1)
+	client := testNode{
+		outputs: []node.UnspentOutput{
+			{
+				Hash:            uxHash.Hex(),
+				Address:         own[1],
+				Coins:           "5.000000",
+				Hours:           1,
+				CalculatedHours: 20,
+			},
+			{
+				Hash:            cipher.SumSHA256([]byte("foreign")).Hex(),
+				Address:         dest,
+				Coins:           "100.000000",
+				CalculatedHours: 100,
+			},
+		},
+		injected: injected,
+	}.start(t)
+
+	body := func(to string) string {
+		return fmt.Sprintf(`{"to": [{"address": "%s", "coins": "%s"}], "address_n": 2, "broadcast": true}`, dest, to)
+	}
+	deviceCalls := []mockCall{
+		{Method: "GetFeatures"},
+		{Method: "AddressGen", Args: []interface{}{2, 0, false}},
+	}
+	deviceResponses := []mockResponse{
+		respondWith(newFeaturesMessage(t, "device", false)),
+		respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, &messages.ResponseSkycoinAddress{
+			Addresses: own,
+		})),
+	}
+
+	signCall := mockCall{Method: "TransactionSign", Args: []interface{}{
+		[]*messages.SkycoinTransactionInput{
+			{HashIn: proto.String(uxHash.Hex()), Index: proto.Uint32(1)},
+		},
+		[]*messages.SkycoinTransactionOutput{
+			{Address: proto.String(dest), Coin: proto.Uint64(2000000), Hour: proto.Uint64(5)},
+			{Address: proto.String(own[1]), AddressIndex: proto.Uint32(1), Coin: proto.Uint64(3000000), Hour: proto.Uint64(5)},
+		},
+	}}
+
+	changeIndex := uint32(1)
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "invalid destination",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        `{"to": [{"address": "address0", "coins": "1"}], "address_n": 1}`,
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "no address_n",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        fmt.Sprintf(`{"to": [{"address": "%s", "coins": "1"}]}`, dest),
+			status:      http.StatusUnprocessableEntity,
+			err:         "address_n must be positive",
+		},
+		{
+			name:        "insufficient balance",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body("6"),
+			responses:   deviceResponses,
+			calls:       deviceCalls,
+			status:      http.StatusUnprocessableEntity,
+			err:         transaction.ErrInsufficientBalance.Error(),
+		},
+		{
+			name:        "ok",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body("2"),
+			responses: append(deviceResponses,
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_ButtonRequest, &messages.ButtonRequest{})),
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseTransactionSign, &messages.ResponseTransactionSign{
+					Signatures: []string{sig.Hex()},
+					Finished:   proto.Bool(true),
+				})),
+			),
+			calls: append(deviceCalls,
+				signCall,
+				mockCall{Method: "ButtonAck"},
+			),
+			status: http.StatusOK,
+			data: SendResponse{
+				TxID:   txn.Hash().Hex(),
+				RawTx:  hex.EncodeToString(txn.Serialize()),
+				Inputs: []TransactionInput{{Index: 1, Hash: uxHash.Hex()}},
+				Outputs: []TransactionOutput{
+					{Address: dest, Coins: 2000000, Hours: 5},
+					{Address: own[1], AddressIndex: &changeIndex, Coins: 3000000, Hours: 5},
+				},
+				Fee:       10,
+				Broadcast: true,
+			},
+		},
+		{
+			name:        "signature of another address",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body("2"),
+			responses: append(deviceResponses,
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseTransactionSign, &messages.ResponseTransactionSign{
+					Signatures: []string{cipher.MustSignHash(transaction.SignatureHash(txn.InnerHash, uxHash), keys[0]).Hex()},
+					Finished:   proto.Bool(true),
+				})),
+			),
+			calls:  append(deviceCalls, signCall),
+			status: http.StatusBadGateway,
+			err:    fmt.Sprintf("device signed input 0 with %s instead of %s, its address at index 1", own[0], own[1]),
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/send", func(g Gatewayer) http.Handler {
+		return send(g, newAddressCache(), defaultAddressBatchSize, nil, client)
+	}, cases)
+
+	if rawTx := <-injected; rawTx != hex.EncodeToString(txn.Serialize()) {
+		t.Fatalf("unexpected broadcast transaction %s", rawTx)
+	}
+
+	runHTTPTestCases(t, "/api/v1/send", func(g Gatewayer) http.Handler {
+		return send(g, newAddressCache(), defaultAddressBatchSize, nil, nil)
+	}, []httpTestCase{
+		{
+			name:        "no node",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body("2"),
+			status:      http.StatusServiceUnavailable,
+		},
+	})
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+// TransactionPreviewResponse is data returned by /api/v1/transaction_preview
+type TransactionPreviewResponse struct {
+	Outputs []OutputPreview `json:"outputs"`
+	// SentCoins and SentHours are the totals of the outputs that aren't change
+	SentCoins string `json:"sent_coins"`
+	SentHours uint64 `json:"sent_hours"`
+	// ChangeCoins and ChangeHours are the totals of the change outputs
+	ChangeCoins string `json:"change_coins"`
+	ChangeHours uint64 `json:"change_hours"`
+	// Warnings are problems the device or the network may reject the transaction for
+	Warnings []string `json:"warnings"`
+}
+
+// OutputPreview is an output as the device displays it
+type OutputPreview struct {
+	Address string `json:"address"`
+	// Coins is the decimal number of coins with the 6 decimals of a droplet
+	Coins string `json:"coins"`
+	Hours uint64 `json:"hours"`
+	// Change is set for outputs with an address_index, the device checks their address
+	// and doesn't ask the user to confirm them
+	Change       bool    `json:"change"`
+	AddressIndex *uint32 `json:"address_index,omitempty"`
+}
+
+// transactionPreview is a dry run of /api/v1/transaction_sign: it validates the request and returns
+// the outputs the device asks the user to confirm, the change outputs, totals and warnings.
+// It doesn't use the device.
+// URI: /api/v1/transaction_preview
+// Method: POST
+// Args: JSON Body, a transaction_sign request
+func transactionPreview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != ContentTypeJSON {
+			resp := NewHTTPErrorResponse(http.StatusUnsupportedMediaType, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		var req TransactionSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusBadRequest, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		defer r.Body.Close()
+
+		if _, _, err := req.deviceMessages(); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		preview, err := req.preview()
+		if err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: preview,
+		})
+	}
+}
+
+// preview returns the preview of a validated request
+func (req TransactionSignRequest) preview() (*TransactionPreviewResponse, error) {
+	preview := &TransactionPreviewResponse{
+		Outputs:  make([]OutputPreview, len(req.TransactionOutputs)),
+		Warnings: []string{},
+	}
+
+	var sentCoins, changeCoins uint64
+	sentTo := make(map[string]int)
+	for i, o := range req.TransactionOutputs {
+		coins, err := droplet.ToString(o.Coins.Value())
+		if err != nil {
+			return nil, fmt.Errorf("transaction output %d: %v", i, err)
+		}
+
+		preview.Outputs[i] = OutputPreview{
+			Address:      o.Address,
+			Coins:        coins,
+			Hours:        o.Hours.Value(),
+			Change:       o.AddressIndex != nil,
+			AddressIndex: o.AddressIndex,
+		}
+
+		if err := transaction.CheckCoins(o.Coins.Value()); err != nil {
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("output %d: %v, the network rejects the transaction", i, err))
+		}
+
+		total, hours := &sentCoins, &preview.SentHours
+		if o.AddressIndex != nil {
+			total, hours = &changeCoins, &preview.ChangeHours
+		} else if j, ok := sentTo[o.Address]; ok {
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("outputs %d and %d send to the same address %s", j, i, o.Address))
+		} else {
+			sentTo[o.Address] = i
+		}
+
+		if *total+o.Coins.Value() < *total || *hours+o.Hours.Value() < *hours {
+			return nil, transaction.ErrOverflow
+		}
+		*total += o.Coins.Value()
+		*hours += o.Hours.Value()
+	}
+
+	var err error
+	if preview.SentCoins, err = droplet.ToString(sentCoins); err != nil {
+		return nil, err
+	}
+	if preview.ChangeCoins, err = droplet.ToString(changeCoins); err != nil {
+		return nil, err
+	}
+
+	if len(req.TransactionInputs) > transaction.MaxInputs {
+		preview.Warnings = append(preview.Warnings, fmt.Sprintf("the transaction has %d inputs, the device signs at most %d", len(req.TransactionInputs), transaction.MaxInputs))
+	}
+	if len(req.TransactionOutputs) > transaction.MaxOutputs {
+		preview.Warnings = append(preview.Warnings, fmt.Sprintf("the transaction has %d outputs, the device signs at most %d", len(req.TransactionOutputs), transaction.MaxOutputs))
+	}
+	if len(sentTo) == 0 {
+		preview.Warnings = append(preview.Warnings, "every output is change, the transaction only moves coins between device addresses")
+	}
+
+	return preview, nil
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+func TestTransactionPreview(t *testing.T) {
+	addresses := newTestAddresses(t, 2)
+	hash := cipher.SumSHA256([]byte("unspent")).Hex()
+	change := uint32(3)
+
+	body := func(outputs string) string {
+		return fmt.Sprintf(`{"transaction_inputs": [{"index": 0, "hash": "%s"}], "transaction_outputs": [%s]}`, hash, outputs)
+	}
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:        "invalid address",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(`{"address": "address", "coins": "1", "hours": "1"}`),
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "overflow",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body: body(fmt.Sprintf(`{"address": "%s", "coins": "1", "hours": "18446744073709551615"}, {"address": "%s", "coins": "1", "hours": "1"}`,
+				addresses[0], addresses[1])),
+			status: http.StatusUnprocessableEntity,
+			err:    "coins or hours overflow",
+		},
+		{
+			name:        "ok",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body: body(fmt.Sprintf(`{"address": "%s", "coins": "2.5", "hours": "4"}, {"address": "%s", "coins": "0.5", "hours": "1"}, {"address": "%s", "address_index": 3, "coins": "7", "hours": "5"}`,
+				addresses[0], addresses[1], addresses[1])),
+			status: http.StatusOK,
+			data: TransactionPreviewResponse{
+				Outputs: []OutputPreview{
+					{Address: addresses[0], Coins: "2.500000", Hours: 4},
+					{Address: addresses[1], Coins: "0.500000", Hours: 1},
+					{Address: addresses[1], Coins: "7.000000", Hours: 5, Change: true, AddressIndex: &change},
+				},
+				SentCoins:   "3.000000",
+				SentHours:   5,
+				ChangeCoins: "7.000000",
+				ChangeHours: 5,
+				Warnings:    []string{},
+			},
+		},
+		{
+			name:        "warnings",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body: body(fmt.Sprintf(`{"address": "%s", "coins": "1.0005", "hours": "0"}, {"address": "%s", "coins": "1", "hours": "0"}`,
+				addresses[0], addresses[0])),
+			status: http.StatusOK,
+			data: TransactionPreviewResponse{
+				Outputs: []OutputPreview{
+					{Address: addresses[0], Coins: "1.000500"},
+					{Address: addresses[0], Coins: "1.000000"},
+				},
+				SentCoins:   "2.000500",
+				ChangeCoins: "0.000000",
+				Warnings: []string{
+					"output 0: destination coins have more than 3 decimal places, the network rejects the transaction",
+					fmt.Sprintf("outputs 0 and 1 send to the same address %s", addresses[0]),
+				},
+			},
+		},
+		{
+			name:        "only change",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(fmt.Sprintf(`{"address": "%s", "address_index": 3, "coins": "1", "hours": "1"}`, addresses[1])),
+			status:      http.StatusOK,
+			data: TransactionPreviewResponse{
+				Outputs: []OutputPreview{
+					{Address: addresses[1], Coins: "1.000000", Hours: 1, Change: true, AddressIndex: &change},
+				},
+				SentCoins:   "0.000000",
+				ChangeCoins: "1.000000",
+				ChangeHours: 1,
+				Warnings:    []string{"every output is change, the transaction only moves coins between device addresses"},
+			},
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/transaction_preview", func(g Gatewayer) http.Handler {
+		return transactionPreview()
+	}, cases)
+}
@@ -0,0 +1,358 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	wh "github.com/skycoin/skycoin/src/util/http"
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+
+	"github.com/therealssj/testingdep2/src/policy"
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+// TransactionSignRequest is request data for /api/v1/transaction_sign
+type TransactionSignRequest struct {
+	TransactionInputs  []TransactionInput  `json:"transaction_inputs"`
+	TransactionOutputs []TransactionOutput `json:"transaction_outputs"`
+}
+
+// TransactionInput is an input of a transaction to sign
+type TransactionInput struct {
+	// Index is the index of the device address owning the input
+	Index uint32 `json:"index"`
+	Hash  string `json:"hash"`
+}
+
+// TransactionOutput is an output of a transaction to sign
+type TransactionOutput struct {
+	// AddressIndex is set for change outputs, it is the index of the device address receiving the change
+	AddressIndex *uint32  `json:"address_index,omitempty"`
+	Address      string   `json:"address"`
+	Coins        wh.Coins `json:"coins"`
+	Hours        wh.Hours `json:"hours"`
+}
+
+// changeAddressError is returned when a change output's address is not the device's address at its index
+type changeAddressError struct {
+	output       int
+	addressIndex uint32
+	address      string
+}
+
+func (e changeAddressError) Error() string {
+	return fmt.Sprintf("transaction output %d: %s is not the device address at index %d", e.output, e.address, e.addressIndex)
+}
+
+// transactionSign signs a transaction with the device.
+// Change outputs are checked against the addresses the device derives at their address_index,
+// so that change can't be routed to an address the device doesn't own. The returned signatures
+// are verified against the input hashes and the device addresses owning the inputs.
+// If a spending policy is set, the transaction must satisfy it before it is sent to the device.
+// URI: /api/v1/transaction_sign
+// Method: POST
+// Args: JSON Body
+func transactionSign(gateway Gatewayer, cache *addressCache, engine *policy.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			resp := NewHTTPErrorResponse(http.StatusMethodNotAllowed, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != ContentTypeJSON {
+			resp := NewHTTPErrorResponse(http.StatusUnsupportedMediaType, "")
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		var req TransactionSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusBadRequest, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		defer r.Body.Close()
+
+		// the request is validated before the device is asked for its addresses
+		if _, _, err := req.deviceMessages(); err != nil {
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		key, msg, err := addressCacheKey(gateway, cache)
+		if err != nil {
+			logger.Error("transactionSign failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		addresses, msg, err := deviceAddressesAt(gateway, cache, key, req.addressIndices())
+		if err != nil {
+			logger.Error("transactionSign failed: %s", err.Error())
+			resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+		if msg != nil {
+			HandleFirmwareResponseMessages(w, r, gateway, *msg)
+			return
+		}
+
+		if err := verifyChangeOutputs(req.TransactionOutputs, addresses); err != nil {
+			logger.WithError(err).Warn("transactionSign rejected a change output")
+			resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+			writeHTTPResponse(w, resp)
+			return
+		}
+
+		signatures, ok := signAuthorized(w, r, gateway, engine, req, func(signatures []string) error {
+			_, err := verifySignatures(req.transaction(), req.TransactionInputs, signatures, addresses)
+			return err
+		})
+		if !ok {
+			return
+		}
+
+		writeHTTPResponse(w, HTTPResponse{
+			Data: signatures,
+		})
+	}
+}
+
+// deviceMessages validates the request and converts it to the device's transaction messages
+func (req TransactionSignRequest) deviceMessages() ([]*messages.SkycoinTransactionInput, []*messages.SkycoinTransactionOutput, error) {
+	if len(req.TransactionInputs) == 0 {
+		return nil, nil, fmt.Errorf("transaction_inputs cannot be empty")
+	}
+	if len(req.TransactionOutputs) == 0 {
+		return nil, nil, fmt.Errorf("transaction_outputs cannot be empty")
+	}
+
+	inputs := make([]*messages.SkycoinTransactionInput, len(req.TransactionInputs))
+	for i, in := range req.TransactionInputs {
+		if _, err := cipher.SHA256FromHex(in.Hash); err != nil {
+			return nil, nil, fmt.Errorf("transaction input %d: invalid hash: %v", i, err)
+		}
+
+		inputs[i] = &messages.SkycoinTransactionInput{
+			HashIn: newStrPtr(in.Hash),
+			Index:  newUint32Ptr(in.Index),
+		}
+	}
+
+	outputs := make([]*messages.SkycoinTransactionOutput, len(req.TransactionOutputs))
+	for i, out := range req.TransactionOutputs {
+		if _, err := cipher.DecodeBase58Address(out.Address); err != nil {
+			return nil, nil, fmt.Errorf("transaction output %d: invalid address: %v", i, err)
+		}
+
+		coins := out.Coins.Value()
+		hours := out.Hours.Value()
+		outputs[i] = &messages.SkycoinTransactionOutput{
+			Address:      newStrPtr(out.Address),
+			AddressIndex: out.AddressIndex,
+			Coin:         &coins,
+			Hour:         &hours,
+		}
+	}
+
+	return inputs, outputs, nil
+}
+
+// transaction returns the unsigned transaction of a validated request
+func (req TransactionSignRequest) transaction() *transaction.Transaction {
+	txn := &transaction.Transaction{
+		In:  make([]cipher.SHA256, len(req.TransactionInputs)),
+		Out: make([]transaction.Output, len(req.TransactionOutputs)),
+	}
+
+	for i, in := range req.TransactionInputs {
+		txn.In[i] = cipher.MustSHA256FromHex(in.Hash)
+	}
+
+	for i, o := range req.TransactionOutputs {
+		txn.Out[i] = transaction.Output{
+			Address: cipher.MustDecodeBase58Address(o.Address),
+			Coins:   o.Coins.Value(),
+			Hours:   o.Hours.Value(),
+		}
+	}
+
+	txn.UpdateHeader()
+
+	return txn
+}
+
+// addressIndices returns the indices of the device addresses owning the inputs and receiving the change
+func (req TransactionSignRequest) addressIndices() []uint32 {
+	var indices []uint32
+	for _, in := range req.TransactionInputs {
+		indices = append(indices, in.Index)
+	}
+	for _, o := range req.TransactionOutputs {
+		if o.AddressIndex != nil {
+			indices = append(indices, *o.AddressIndex)
+		}
+	}
+	return indices
+}
+
+// verifyChangeOutputs checks that the address of every change output is the device's address at its address_index
+func verifyChangeOutputs(outputs []TransactionOutput, addresses map[uint32]string) error {
+	for i, o := range outputs {
+		if o.AddressIndex != nil && addresses[*o.AddressIndex] != o.Address {
+			return changeAddressError{
+				output:       i,
+				addressIndex: *o.AddressIndex,
+				address:      o.Address,
+			}
+		}
+	}
+
+	return nil
+}
+
+// verifySignatures checks each signature returned by the device against the hash of its input and
+// the device address owning the input, so that an inconsistent answer of the device never reaches
+// the client
+func verifySignatures(txn *transaction.Transaction, inputs []TransactionInput, signatures []string, addresses map[uint32]string) ([]cipher.Sig, error) {
+	if len(signatures) != len(txn.In) {
+		return nil, fmt.Errorf("device returned %d signatures for %d inputs", len(signatures), len(txn.In))
+	}
+
+	sigs := make([]cipher.Sig, len(signatures))
+	for i, s := range signatures {
+		sig, err := cipher.SigFromHex(s)
+		if err != nil {
+			return nil, fmt.Errorf("device returned an invalid signature for input %d: %v", i, err)
+		}
+
+		index := inputs[i].Index
+		addr, err := cipher.DecodeBase58Address(addresses[index])
+		if err != nil {
+			return nil, fmt.Errorf("device returned an invalid address at index %d: %v", index, err)
+		}
+
+		hash := transaction.SignatureHash(txn.InnerHash, txn.In[i])
+		pubKey, err := cipher.PubKeyFromSig(sig, hash)
+		if err != nil {
+			return nil, fmt.Errorf("device returned an invalid signature for input %d: %v", i, err)
+		}
+		if signer := cipher.AddressFromPubKey(pubKey); signer != addr {
+			return nil, fmt.Errorf("device signed input %d with %s instead of %s, its address at index %d", i, signer, addr, index)
+		}
+		if err := cipher.VerifyAddressSignedHash(addr, sig, hash); err != nil {
+			return nil, fmt.Errorf("device returned an invalid signature for input %d: %v", i, err)
+		}
+
+		sigs[i] = sig
+	}
+
+	return sigs, nil
+}
+
+// signAuthorized asks the device to sign the transaction of req once it satisfies the spending
+// policy, and checks the signatures with verify. The authorization is revoked if the transaction
+// isn't signed or verify rejects the signatures. It returns false after writing the response when
+// the transaction isn't signed, including the firmware messages requiring user action.
+func signAuthorized(w http.ResponseWriter, r *http.Request, gateway Gatewayer, engine *policy.Engine, req TransactionSignRequest, verify func(signatures []string) error) ([]string, bool) {
+	inputs, outputs, err := req.deviceMessages()
+	if err != nil {
+		resp := NewHTTPErrorResponse(http.StatusUnprocessableEntity, err.Error())
+		writeHTTPResponse(w, resp)
+		return nil, false
+	}
+
+	auth, err := authorizeTransaction(gateway, engine, req.TransactionOutputs)
+	if err != nil {
+		if _, ok := err.(policy.Violation); ok {
+			resp := NewHTTPErrorResponse(http.StatusForbidden, err.Error())
+			writeHTTPResponse(w, resp)
+			return nil, false
+		}
+
+		logger.Error("signAuthorized failed: %s", err.Error())
+		resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+		writeHTTPResponse(w, resp)
+		return nil, false
+	}
+
+	m, err := signTransaction(gateway, inputs, outputs)
+	if auth != nil && (err != nil || m.Kind != uint16(messages.MessageType_MessageType_ResponseTransactionSign)) {
+		// the transaction wasn't signed, the client sends it again once the device is unlocked
+		auth.Revoke()
+	}
+	if err != nil {
+		logger.Error("signAuthorized failed: %s", err.Error())
+		resp := NewHTTPErrorResponse(deviceErrorStatus(err), err.Error())
+		writeHTTPResponse(w, resp)
+		return nil, false
+	}
+	if m.Kind != uint16(messages.MessageType_MessageType_ResponseTransactionSign) {
+		HandleFirmwareResponseMessages(w, r, gateway, m)
+		return nil, false
+	}
+
+	signatures, err := deviceWallet.DecodeResponseTransactionSign(m)
+	if err == nil {
+		err = verify(signatures)
+	}
+	if err != nil {
+		if auth != nil {
+			// the signatures are unusable, the transaction can't be broadcast
+			auth.Revoke()
+		}
+		logger.Error("signAuthorized failed: %s", err.Error())
+		resp := NewHTTPErrorResponse(http.StatusBadGateway, err.Error())
+		writeHTTPResponse(w, resp)
+		return nil, false
+	}
+
+	return signatures, true
+}
+
+// authorizeTransaction evaluates the transaction outputs against the spending policy of the
+// device and logs the decision. It returns nil if no policy is set.
+func authorizeTransaction(gateway Gatewayer, engine *policy.Engine, outputs []TransactionOutput) (*policy.Authorization, error) {
+	if engine == nil {
+		return nil, nil
+	}
+
+	features, err := deviceFeatures(gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	policyOutputs := make([]policy.Output, len(outputs))
+	for i, o := range outputs {
+		policyOutputs[i] = policy.Output{
+			Address: o.Address,
+			Coins:   o.Coins.Value(),
+			Hours:   o.Hours.Value(),
+			Change:  o.AddressIndex != nil,
+		}
+	}
+
+	deviceID := features.GetDeviceId()
+	auth, err := engine.Authorize(deviceID, policyOutputs)
+	if err != nil {
+		if v, ok := err.(policy.Violation); ok {
+			logger.Warnf("Spending policy rejected a transaction of device %q, rule %s: %s", deviceID, v.Rule, v.Reason)
+		}
+		return nil, err
+	}
+
+	logger.Infof("Spending policy approved a transaction of device %q sending %d droplets", deviceID, auth.Coins())
+
+	return auth, nil
+}
@@ -0,0 +1,395 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/skycoin/skycoin/src/cipher"
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/policy"
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+// newTestAddresses returns n valid skycoin addresses
+func newTestAddresses(t *testing.T, n int) []string {
+	_, addresses := newTestKeys(t, n)
+	return addresses
+}
+
+// newTestKeys returns n secret keys and their addresses
+func newTestKeys(t *testing.T, n int) ([]cipher.SecKey, []string) {
+	keys, err := cipher.GenerateDeterministicKeyPairs([]byte("transaction sign"), n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addresses := make([]string, n)
+	for i, k := range keys {
+		addresses[i] = cipher.MustAddressFromSecKey(k).String()
+	}
+	return keys, addresses
+}
+
+// newSignaturesMessage returns the device's answer signing the input with key
+func newSignaturesMessage(t *testing.T, key cipher.SecKey, input cipher.SHA256, outputs ...transaction.Output) wire.Message {
+	innerHash := transaction.HashInner([]cipher.SHA256{input}, outputs)
+	sig := cipher.MustSignHash(transaction.SignatureHash(innerHash, input), key)
+	return newWireMessage(t, messages.MessageType_MessageType_ResponseTransactionSign, &messages.ResponseTransactionSign{
+		Signatures: []string{sig.Hex()},
+		Finished:   proto.Bool(true),
+	})
+}
+
+// signaturesOf returns the signatures of a ResponseTransactionSign message
+func signaturesOf(t *testing.T, msg wire.Message) []string {
+	signatures, err := deviceWallet.DecodeResponseTransactionSign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signatures
+}
+
+func TestTransactionSign(t *testing.T) {
+	keys, addresses := newTestKeys(t, 3)
+	input := cipher.SumSHA256([]byte("input"))
+	hash := input.Hex()
+
+	paymentOutput := transaction.Output{Address: cipher.MustDecodeBase58Address(addresses[0]), Coins: 1500000, Hours: 2}
+	changeOutput := transaction.Output{Address: cipher.MustDecodeBase58Address(addresses[2]), Coins: 500000, Hours: 1}
+	paymentSignatures := newSignaturesMessage(t, keys[0], input, paymentOutput)
+	changeSignatures := newSignaturesMessage(t, keys[0], input, paymentOutput, changeOutput)
+
+	addressAt := func(i int) mockResponse {
+		return respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, &messages.ResponseSkycoinAddress{
+			Addresses: addresses[i : i+1],
+		}))
+	}
+
+	inputs := []*messages.SkycoinTransactionInput{
+		{
+			HashIn: proto.String(hash),
+			Index:  proto.Uint32(0),
+		},
+	}
+	signCall := func(outputs ...*messages.SkycoinTransactionOutput) mockCall {
+		return mockCall{Method: "TransactionSign", Args: []interface{}{inputs, outputs}}
+	}
+	payment := &messages.SkycoinTransactionOutput{
+		Address: proto.String(addresses[0]),
+		Coin:    proto.Uint64(1500000),
+		Hour:    proto.Uint64(2),
+	}
+	change := &messages.SkycoinTransactionOutput{
+		Address:      proto.String(addresses[2]),
+		AddressIndex: proto.Uint32(2),
+		Coin:         proto.Uint64(500000),
+		Hour:         proto.Uint64(1),
+	}
+
+	body := func(outputs string) string {
+		return fmt.Sprintf(`{"transaction_inputs": [{"index": 0, "hash": "%s"}], "transaction_outputs": [%s]}`, hash, outputs)
+	}
+	paymentJSON := fmt.Sprintf(`{"address": "%s", "coins": "1.5", "hours": "2"}`, addresses[0])
+	changeJSON := func(address string) string {
+		return fmt.Sprintf(`{"address": "%s", "address_index": 2, "coins": "0.5", "hours": "1"}`, address)
+	}
+
+	cases := []httpTestCase{
+		{
+			name:   "method not allowed",
+			method: http.MethodGet,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "unsupported media type",
+			method: http.MethodPost,
+			body:   body(paymentJSON),
+			status: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "invalid coins",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(fmt.Sprintf(`{"address": "%s", "coins": "1.0000001", "hours": "2"}`, addresses[0])),
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "no inputs",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        fmt.Sprintf(`{"transaction_outputs": [%s]}`, paymentJSON),
+			status:      http.StatusUnprocessableEntity,
+			err:         "transaction_inputs cannot be empty",
+		},
+		{
+			name:        "invalid address",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(`{"address": "address0", "coins": "1", "hours": "2"}`),
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "no change",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(paymentJSON),
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				addressAt(0),
+				respondWith(paymentSignatures),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+				signCall(payment),
+			},
+			status: http.StatusOK,
+			data:   signaturesOf(t, paymentSignatures),
+		},
+		{
+			name:        "signature of another address",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(paymentJSON),
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				addressAt(0),
+				respondWith(newSignaturesMessage(t, keys[1], input, paymentOutput)),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+				signCall(payment),
+			},
+			status: http.StatusBadGateway,
+			err:    fmt.Sprintf("device signed input 0 with %s instead of %s, its address at index 0", addresses[1], addresses[0]),
+		},
+		{
+			name:        "signature of another transaction",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(paymentJSON),
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				addressAt(0),
+				respondWith(changeSignatures),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+				signCall(payment),
+			},
+			status: http.StatusBadGateway,
+		},
+		{
+			name:        "malformed signature",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(paymentJSON),
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				addressAt(0),
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_ResponseTransactionSign, &messages.ResponseTransactionSign{
+					Signatures: []string{"signature"},
+				})),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+				signCall(payment),
+			},
+			status: http.StatusBadGateway,
+		},
+		{
+			name:        "change verified",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(paymentJSON + "," + changeJSON(addresses[2])),
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				addressAt(0),
+				addressAt(2),
+				respondWith(changeSignatures),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+				{Method: "AddressGen", Args: []interface{}{1, 2, false}},
+				signCall(payment, change),
+			},
+			status: http.StatusOK,
+			data:   signaturesOf(t, changeSignatures),
+		},
+		{
+			name:        "change address of another index",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(paymentJSON + "," + changeJSON(addresses[1])),
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				addressAt(0),
+				addressAt(2),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+				{Method: "AddressGen", Args: []interface{}{1, 2, false}},
+			},
+			status: http.StatusUnprocessableEntity,
+			err:    fmt.Sprintf("transaction output 1: %s is not the device address at index 2", addresses[1]),
+		},
+		{
+			name:        "pin requested",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(changeJSON(addresses[2])),
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_PinMatrixRequest, &messages.PinMatrixRequest{})),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				{Method: "AddressGen", Args: []interface{}{1, 0, false}},
+			},
+			status: http.StatusOK,
+			data:   "PinMatrixRequest",
+		},
+		{
+			name:        "no device",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(changeJSON(addresses[2])),
+			responses:   []mockResponse{respondErr(errNoDeviceConnected)},
+			calls:       []mockCall{{Method: "GetFeatures"}},
+			status:      http.StatusServiceUnavailable,
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/transaction_sign", func(g Gatewayer) http.Handler {
+		return transactionSign(g, newAddressCache(), nil)
+	}, cases)
+
+	// cached input and change addresses are not derived again
+	cache := newAddressCache()
+	cache.add(walletKey{DeviceID: "device"}, 0, addresses)
+
+	runHTTPTestCases(t, "/api/v1/transaction_sign", func(g Gatewayer) http.Handler {
+		return transactionSign(g, cache, nil)
+	}, []httpTestCase{
+		{
+			name:        "cached change",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(paymentJSON + "," + changeJSON(addresses[2])),
+			responses: []mockResponse{
+				respondWith(newFeaturesMessage(t, "device", false)),
+				respondWith(changeSignatures),
+			},
+			calls: []mockCall{
+				{Method: "GetFeatures"},
+				signCall(payment, change),
+			},
+			status: http.StatusOK,
+			data:   signaturesOf(t, changeSignatures),
+		},
+	})
+}
+
+func TestTransactionSignPolicy(t *testing.T) {
+	keys, addresses := newTestKeys(t, 2)
+	input := cipher.SumSHA256([]byte("input"))
+	hash := input.Hex()
+	signatures := newSignaturesMessage(t, keys[0], input, transaction.Output{
+		Address: cipher.MustDecodeBase58Address(addresses[0]),
+		Coins:   1500000,
+		Hours:   2,
+	})
+
+	// the address owning the input is cached, the features are read to find it and to apply the policy of the device
+	cache := newAddressCache()
+	cache.add(walletKey{DeviceID: "device"}, 0, addresses[:1])
+	features := respondWith(newFeaturesMessage(t, "device", false))
+
+	body := func(address string) string {
+		return fmt.Sprintf(`{"transaction_inputs": [{"index": 0, "hash": "%s"}], "transaction_outputs": [{"address": "%s", "coins": "1.5", "hours": "2"}]}`, hash, address)
+	}
+	signCall := mockCall{
+		Method: "TransactionSign",
+		Args: []interface{}{
+			[]*messages.SkycoinTransactionInput{
+				{HashIn: proto.String(hash), Index: proto.Uint32(0)},
+			},
+			[]*messages.SkycoinTransactionOutput{
+				{Address: proto.String(addresses[0]), Coin: proto.Uint64(1500000), Hour: proto.Uint64(2)},
+			},
+		},
+	}
+
+	engine := policy.NewEngine(policy.Policy{
+		Default: policy.Rules{
+			DailyCoinLimit:      1500000,
+			AllowedDestinations: []string{addresses[0]},
+		},
+	})
+
+	cases := []httpTestCase{
+		{
+			name:        "destination not allowed",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(addresses[1]),
+			responses:   []mockResponse{features, features},
+			calls:       []mockCall{{Method: "GetFeatures"}, {Method: "GetFeatures"}},
+			status:      http.StatusForbidden,
+			err:         fmt.Sprintf("policy violation: output 0: %s is not an allowed destination", addresses[1]),
+		},
+		{
+			name:        "cancelled on the device",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(addresses[0]),
+			responses: []mockResponse{
+				features,
+				features,
+				respondWith(newWireMessage(t, messages.MessageType_MessageType_Failure, &messages.Failure{
+					Code:    messages.FailureType_Failure_ActionCancelled.Enum(),
+					Message: proto.String("Action cancelled by user"),
+				})),
+			},
+			calls:  []mockCall{{Method: "GetFeatures"}, {Method: "GetFeatures"}, signCall},
+			status: http.StatusConflict,
+		},
+		{
+			name:        "signed",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(addresses[0]),
+			responses: []mockResponse{
+				features,
+				features,
+				respondWith(signatures),
+			},
+			calls:  []mockCall{{Method: "GetFeatures"}, {Method: "GetFeatures"}, signCall},
+			status: http.StatusOK,
+			data:   signaturesOf(t, signatures),
+		},
+		{
+			name:        "daily limit reached",
+			method:      http.MethodPost,
+			contentType: ContentTypeJSON,
+			body:        body(addresses[0]),
+			responses:   []mockResponse{features, features},
+			calls:       []mockCall{{Method: "GetFeatures"}, {Method: "GetFeatures"}},
+			status:      http.StatusForbidden,
+		},
+	}
+
+	runHTTPTestCases(t, "/api/v1/transaction_sign", func(g Gatewayer) http.Handler {
+		return transactionSign(g, cache, engine)
+	}, cases)
+}
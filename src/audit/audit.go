@@ -0,0 +1,205 @@
+/*
+Package audit implements an append-only, hash-chained log of sensitive wallet operations.
+
+Each record is written as a single JSON line. The hash of a record covers all of its
+fields, including the hash of the previous record, so modifying, reordering or removing
+records breaks the chain and is detected by Verify.
+
+Removing the last records leaves a valid, shorter chain. Truncation is only detected by
+comparing the head hash and record count returned by VerifyFile with a copy kept outside the log.
+*/
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// OutcomeOK is recorded for operations that completed without error
+	OutcomeOK = "ok"
+	// OutcomeError is recorded for operations that failed
+	OutcomeError = "error"
+)
+
+// GenesisHash is the previous hash of the first record in a log
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// Record is a single audit log entry. It never contains secrets, the request body is only stored as a hash.
+type Record struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Origin      string    `json:"origin"`
+	Endpoint    string    `json:"endpoint"`
+	Device      string    `json:"device"`
+	Status      int       `json:"status"`
+	Outcome     string    `json:"outcome"`
+	RequestHash string    `json:"request_hash"`
+	PrevHash    string    `json:"prev_hash"`
+	Hash        string    `json:"hash"`
+}
+
+// computeHash returns the hash of the record with its Hash field cleared
+func (r Record) computeHash() (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// HashRequest returns the hex encoded sha256 of a request body
+func HashRequest(body []byte) string {
+	h := sha256.Sum256(body)
+	return hex.EncodeToString(h[:])
+}
+
+// Log appends records to an audit log file
+type Log struct {
+	lock     sync.Mutex
+	f        *os.File
+	lastHash string
+}
+
+// Open opens or creates the audit log at path. The existing chain is verified so that
+// new records are never appended to a log that has been tampered with.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	lastHash, _, err := verify(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("audit log %s failed verification: %v", path, err)
+	}
+
+	return &Log{
+		f:        f,
+		lastHash: lastHash,
+	}, nil
+}
+
+// Append chains r to the previous record and writes it to the log
+func (l *Log) Append(r Record) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.f == nil {
+		return errors.New("audit log is closed")
+	}
+
+	if r.Timestamp.IsZero() {
+		r.Timestamp = time.Now()
+	}
+	r.Timestamp = r.Timestamp.UTC()
+	r.PrevHash = l.lastHash
+
+	hash, err := r.computeHash()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+
+	l.lastHash = hash
+	return nil
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Verify checks the hash chain of the log read from r. It returns the hash of the last record,
+// GenesisHash for an empty log, and the number of valid records.
+func Verify(r io.Reader) (string, int, error) {
+	return verify(r)
+}
+
+// VerifyFile checks the hash chain of the log at path. It returns the hash of the last record,
+// GenesisHash for an empty log, and the number of valid records.
+func VerifyFile(path string) (string, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	return Verify(f)
+}
+
+func verify(r io.Reader) (string, int, error) {
+	scanner := bufio.NewScanner(r)
+	prevHash := GenesisHash
+	n := 0
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return "", n, fmt.Errorf("record %d: %v", n+1, err)
+		}
+
+		if rec.PrevHash != prevHash {
+			return "", n, fmt.Errorf("record %d: previous hash %s does not match %s", n+1, rec.PrevHash, prevHash)
+		}
+
+		hash, err := rec.computeHash()
+		if err != nil {
+			return "", n, fmt.Errorf("record %d: %v", n+1, err)
+		}
+		if hash != rec.Hash {
+			return "", n, fmt.Errorf("record %d: hash %s does not match contents, expected %s", n+1, rec.Hash, hash)
+		}
+
+		prevHash = rec.Hash
+		n++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", n, err
+	}
+
+	return prevHash, n, nil
+}
@@ -0,0 +1,206 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempLog(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "audit.log"), func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func appendRecords(t *testing.T, l *Log, endpoints ...string) {
+	for _, e := range endpoints {
+		if err := l.Append(Record{
+			Timestamp:   time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC),
+			Origin:      "http://127.0.0.1:8000",
+			Endpoint:    e,
+			Device:      "USB",
+			Status:      http.StatusOK,
+			Outcome:     OutcomeOK,
+			RequestHash: HashRequest([]byte(e)),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readLines(t *testing.T, path string) []string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendReopen(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, l, "/a", "/b")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(Record{}); err == nil {
+		t.Fatal("append to a closed log succeeded")
+	}
+
+	head, n, err := VerifyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 records, got %d", n)
+	}
+
+	// reopening continues the chain from the last record
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, l, "/c")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readLines(t, path)
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	if !strings.Contains(lines[2], `"prev_hash":"`+head+`"`) {
+		t.Fatalf("the record appended after reopening isn't chained to %s: %s", head, lines[2])
+	}
+
+	if _, n, err := VerifyFile(path); err != nil || n != 3 {
+		t.Fatalf("expected 3 valid records, got %d: %v", n, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, l, "/a", "/b", "/c")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := readLines(t, path)
+
+	head, n, err := Verify(bytes.NewBufferString(""))
+	if err != nil || n != 0 || head != GenesisHash {
+		t.Fatalf("expected an empty log to end at the genesis hash, got %s %d %v", head, n, err)
+	}
+
+	cases := []struct {
+		name  string
+		lines []string
+		valid int
+		err   string
+	}{
+		{
+			name:  "intact",
+			lines: lines,
+			valid: 3,
+		},
+		{
+			name:  "edited record",
+			lines: []string{lines[0], strings.Replace(lines[1], `"status":200`, `"status":500`, 1), lines[2]},
+			valid: 1,
+			err:   "record 2: hash",
+		},
+		{
+			name:  "reordered records",
+			lines: []string{lines[0], lines[2], lines[1]},
+			valid: 1,
+			err:   "record 2: previous hash",
+		},
+		{
+			name:  "deleted record",
+			lines: []string{lines[0], lines[2]},
+			valid: 1,
+			err:   "record 2: previous hash",
+		},
+		{
+			name:  "invalid json",
+			lines: []string{lines[0], "{"},
+			valid: 1,
+			err:   "record 2:",
+		},
+		{
+			// truncation leaves a valid chain, only the head hash shows it
+			name:  "truncated",
+			lines: lines[:2],
+			valid: 2,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, n, err := Verify(bytes.NewBufferString(strings.Join(tc.lines, "\n") + "\n"))
+			if n != tc.valid {
+				t.Fatalf("expected %d valid records, got %d", tc.valid, n)
+			}
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Fatalf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, l, "/a", "/b")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readLines(t, path)
+	writeLines(t, path, []string{strings.Replace(lines[0], `"/a"`, `"/x"`, 1), lines[1]})
+
+	if _, err := Open(path); err == nil {
+		t.Fatal("opened a tampered log")
+	}
+
+	// nothing was appended to the tampered log
+	if got := readLines(t, path); len(got) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(got))
+	}
+}
@@ -0,0 +1,277 @@
+/*
+Package bundle implements the offline signing file format. An online machine exports an unsigned
+bundle describing a transaction, a signing station without network access signs it with the
+hardware wallet and the online machine finalizes the signed bundle into a transaction to broadcast.
+*/
+package bundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	wh "github.com/skycoin/skycoin/src/util/http"
+
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+// Version is the version of the bundle format
+const Version = 1
+
+var (
+	// ErrChecksum is returned when the checksum of a bundle doesn't match its contents
+	ErrChecksum = errors.New("bundle checksum does not match its contents")
+	// ErrUnsigned is returned when a bundle must be signed but isn't
+	ErrUnsigned = errors.New("bundle is not signed")
+	// ErrSigned is returned when a bundle must be unsigned but is signed
+	ErrSigned = errors.New("bundle is already signed")
+	// ErrOutputsExceedInputs is returned when the outputs of a bundle spend more coins or hours than its inputs hold
+	ErrOutputsExceedInputs = errors.New("bundle outputs spend more coins or hours than its inputs hold")
+)
+
+// Bundle is a transaction exchanged between an online machine and an offline signing station
+type Bundle struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Metadata is free form information about the transaction, such as a description
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Inputs   []Input           `json:"inputs"`
+	Outputs  []Output          `json:"outputs"`
+	// Signatures are the hex encoded signatures of the inputs, in the same order, empty until the bundle is signed
+	Signatures []string `json:"signatures,omitempty"`
+	// Checksum is the hex encoded SHA256 of the bundle serialized with an empty checksum
+	Checksum string `json:"checksum"`
+}
+
+// Input is an unspent output spent by the transaction
+type Input struct {
+	Hash string `json:"hash"`
+	// Address is the device address owning the output, AddressIndex is its index
+	Address      string   `json:"address"`
+	AddressIndex uint32   `json:"address_index"`
+	Coins        wh.Coins `json:"coins"`
+	// Hours are the coin hours of the output when the bundle was created
+	Hours wh.Hours `json:"hours"`
+}
+
+// Output is an output created by the transaction
+type Output struct {
+	// AddressIndex is set for change outputs, it is the index of the device address receiving the change
+	AddressIndex *uint32  `json:"address_index,omitempty"`
+	Address      string   `json:"address"`
+	Coins        wh.Coins `json:"coins"`
+	Hours        wh.Hours `json:"hours"`
+}
+
+// Read decodes a bundle and verifies it
+func Read(r io.Reader) (*Bundle, error) {
+	var b Bundle
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %v", err)
+	}
+
+	if err := b.Verify(); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// Load reads the bundle file at path
+func Load(path string) (*Bundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Write seals the bundle and encodes it
+func (b *Bundle) Write(w io.Writer) error {
+	if err := b.Seal(); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(b)
+}
+
+// Seal sets the checksum of the bundle
+func (b *Bundle) Seal() error {
+	sum, err := b.checksum()
+	if err != nil {
+		return err
+	}
+
+	b.Checksum = sum
+	return nil
+}
+
+// Verify checks the version, the checksum and the transaction of the bundle, and the signatures
+// of a signed bundle
+func (b *Bundle) Verify() error {
+	if b.Version != Version {
+		return fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+
+	sum, err := b.checksum()
+	if err != nil {
+		return err
+	}
+	if sum != b.Checksum {
+		return ErrChecksum
+	}
+
+	if b.Signed() {
+		_, err = b.Finalize()
+	} else {
+		_, err = b.Transaction()
+	}
+	return err
+}
+
+// Signed returns true if the bundle holds signatures
+func (b *Bundle) Signed() bool {
+	return len(b.Signatures) != 0
+}
+
+// Transaction returns the unsigned transaction of the bundle
+func (b *Bundle) Transaction() (*transaction.Transaction, error) {
+	if len(b.Inputs) == 0 {
+		return nil, errors.New("bundle has no inputs")
+	}
+	if len(b.Outputs) == 0 {
+		return nil, errors.New("bundle has no outputs")
+	}
+	if len(b.Inputs) > transaction.MaxInputs {
+		return nil, transaction.ErrTooManyInputs
+	}
+	if len(b.Outputs) > transaction.MaxOutputs {
+		return nil, transaction.ErrTooManyOutputs
+	}
+
+	var inputCoins, inputHours, outputCoins, outputHours uint64
+	for _, in := range b.Inputs {
+		if err := addCoinsHours(&inputCoins, &inputHours, in.Coins.Value(), in.Hours.Value()); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range b.Outputs {
+		if err := addCoinsHours(&outputCoins, &outputHours, o.Coins.Value(), o.Hours.Value()); err != nil {
+			return nil, err
+		}
+	}
+	if outputCoins > inputCoins || outputHours > inputHours {
+		return nil, ErrOutputsExceedInputs
+	}
+
+	txn := &transaction.Transaction{
+		Sigs: make([]cipher.Sig, len(b.Inputs)),
+		In:   make([]cipher.SHA256, len(b.Inputs)),
+		Out:  make([]transaction.Output, len(b.Outputs)),
+	}
+
+	for i, in := range b.Inputs {
+		hash, err := cipher.SHA256FromHex(in.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("bundle input %d: invalid hash: %v", i, err)
+		}
+		if _, err := cipher.DecodeBase58Address(in.Address); err != nil {
+			return nil, fmt.Errorf("bundle input %d: invalid address: %v", i, err)
+		}
+		txn.In[i] = hash
+	}
+
+	for i, o := range b.Outputs {
+		addr, err := cipher.DecodeBase58Address(o.Address)
+		if err != nil {
+			return nil, fmt.Errorf("bundle output %d: invalid address: %v", i, err)
+		}
+		txn.Out[i] = transaction.Output{
+			Address: addr,
+			Coins:   o.Coins.Value(),
+			Hours:   o.Hours.Value(),
+		}
+	}
+
+	txn.UpdateHeader()
+
+	return txn, nil
+}
+
+// addCoinsHours adds coins and hours to the totals
+func addCoinsHours(totalCoins, totalHours *uint64, coins, hours uint64) error {
+	if *totalCoins+coins < *totalCoins || *totalHours+hours < *totalHours {
+		return transaction.ErrOverflow
+	}
+	*totalCoins += coins
+	*totalHours += hours
+	return nil
+}
+
+// AddSignatures verifies that each signature was made by the address of its input, adds the
+// signatures to the bundle and seals it
+func (b *Bundle) AddSignatures(signatures []string) error {
+	if b.Signed() {
+		return ErrSigned
+	}
+
+	b.Signatures = signatures
+	if _, err := b.Finalize(); err != nil {
+		b.Signatures = nil
+		return err
+	}
+
+	return b.Seal()
+}
+
+// Finalize verifies the signatures of a signed bundle and returns its signed transaction
+func (b *Bundle) Finalize() (*transaction.Transaction, error) {
+	if !b.Signed() {
+		return nil, ErrUnsigned
+	}
+
+	txn, err := b.Transaction()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b.Signatures) != len(b.Inputs) {
+		return nil, fmt.Errorf("bundle has %d signatures for %d inputs", len(b.Signatures), len(b.Inputs))
+	}
+
+	for i, s := range b.Signatures {
+		sig, err := cipher.SigFromHex(s)
+		if err != nil {
+			return nil, fmt.Errorf("bundle input %d: invalid signature: %v", i, err)
+		}
+		txn.Sigs[i] = sig
+	}
+
+	for i, in := range b.Inputs {
+		if err := txn.VerifyInput(i, cipher.MustDecodeBase58Address(in.Address)); err != nil {
+			return nil, fmt.Errorf("bundle input %d: invalid signature: %v", i, err)
+		}
+	}
+
+	return txn, nil
+}
+
+func (b *Bundle) checksum() (string, error) {
+	unsealed := *b
+	unsealed.Checksum = ""
+
+	data, err := json.Marshal(unsealed)
+	if err != nil {
+		return "", err
+	}
+
+	return cipher.SumSHA256(data).Hex(), nil
+}
@@ -0,0 +1,174 @@
+package bundle
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+func newTestBundle(t *testing.T) (*Bundle, []cipher.SecKey) {
+	keys, err := cipher.GenerateDeterministicKeyPairs([]byte("bundle"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change := uint32(1)
+	b := &Bundle{
+		Version:   Version,
+		CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Metadata:  map[string]string{"description": "rent"},
+		Inputs: []Input{
+			{
+				Hash:    cipher.SumSHA256([]byte("unspent")).Hex(),
+				Address: cipher.MustAddressFromSecKey(keys[0]).String(),
+				Coins:   5000000,
+				Hours:   20,
+			},
+		},
+		Outputs: []Output{
+			{Address: cipher.MustAddressFromSecKey(keys[1]).String(), Coins: 2000000, Hours: 5},
+			{Address: cipher.MustAddressFromSecKey(keys[0]).String(), AddressIndex: &change, Coins: 3000000, Hours: 5},
+		},
+	}
+	if err := b.Seal(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b, keys
+}
+
+func sign(t *testing.T, b *Bundle, key cipher.SecKey) []string {
+	txn, err := b.Transaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []string{cipher.MustSignHash(transaction.SignatureHash(txn.InnerHash, txn.In[0]), key).Hex()}
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	b, keys := newTestBundle(t)
+
+	var buf bytes.Buffer
+	if err := b.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Checksum != b.Checksum || read.Signed() {
+		t.Fatalf("unexpected bundle %+v", read)
+	}
+	if _, err := read.Finalize(); err != ErrUnsigned {
+		t.Fatalf("expected ErrUnsigned, got %v", err)
+	}
+
+	// signatures of another address are rejected
+	if err := read.AddSignatures(sign(t, read, keys[1])); err == nil || read.Signed() {
+		t.Fatal("a signature of another address was added")
+	}
+
+	if err := read.AddSignatures(sign(t, read, keys[0])); err != nil {
+		t.Fatal(err)
+	}
+	if read.Checksum == b.Checksum {
+		t.Fatal("signed bundle was not sealed again")
+	}
+	if err := read.AddSignatures(sign(t, read, keys[0])); err != ErrSigned {
+		t.Fatalf("expected ErrSigned, got %v", err)
+	}
+
+	buf.Reset()
+	if err := read.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txn, err := signed.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txn.Sigs) != 1 || txn.Sigs[0].Hex() != signed.Signatures[0] || int(txn.Length) != len(txn.Serialize()) {
+		t.Fatalf("unexpected transaction %+v", txn)
+	}
+}
+
+func TestReadRejectsTampering(t *testing.T) {
+	b, _ := newTestBundle(t)
+
+	var buf bytes.Buffer
+	if err := b.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := strings.Replace(buf.String(), `"2.000000"`, `"2.500000"`, 1)
+	if tampered == buf.String() {
+		t.Fatal("the bundle was not tampered with")
+	}
+	if _, err := Read(strings.NewReader(tampered)); err != ErrChecksum {
+		t.Fatalf("expected ErrChecksum, got %v", err)
+	}
+
+	unsupported := strings.Replace(buf.String(), `"version": 1`, `"version": 2`, 1)
+	if _, err := Read(strings.NewReader(unsupported)); err == nil || err.Error() != "unsupported bundle version 2" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestTransactionRejectsOverspending(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(b *Bundle)
+		err    error
+	}{
+		{
+			name: "coins",
+			modify: func(b *Bundle) {
+				b.Outputs[0].Coins++
+			},
+			err: ErrOutputsExceedInputs,
+		},
+		{
+			name: "hours",
+			modify: func(b *Bundle) {
+				b.Outputs[1].Hours = 16
+			},
+			err: ErrOutputsExceedInputs,
+		},
+		{
+			name: "overflow",
+			modify: func(b *Bundle) {
+				b.Outputs[0].Hours = math.MaxUint64
+			},
+			err: transaction.ErrOverflow,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, _ := newTestBundle(t)
+			tc.modify(b)
+			if _, err := b.Transaction(); err != tc.err {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+
+			// a sealed bundle doesn't pass verification either
+			if err := b.Seal(); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Verify(); err != tc.err {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
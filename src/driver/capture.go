@@ -0,0 +1,341 @@
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+)
+
+// Capture events
+const (
+	// EventSend is a message written to the device
+	EventSend = "send"
+	// EventRecv is a message read from the device
+	EventRecv = "recv"
+	// EventButton is a simulated emulator button press
+	EventButton = "button"
+	// EventError is a failed read or write
+	EventError = "error"
+	// EventConnectError is a failure to open the device
+	EventConnectError = "connect_error"
+)
+
+// CaptureEntry is a single event of a device capture, written as one JSON line
+type CaptureEntry struct {
+	Time   time.Time `json:"time"`
+	Device string    `json:"device"`
+	Event  string    `json:"event"`
+	// Kind is the MessageType name of send and recv events
+	Kind string `json:"kind,omitempty"`
+	// Data is the message payload, or the raw bytes of a button press
+	Data []byte `json:"data,omitempty"`
+	// Redacted is set if the payload carried a PIN, passphrase, mnemonic word or entropy and was dropped
+	Redacted bool   `json:"redacted,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// redacted reports whether messages of this kind carry secrets that must not be captured
+func redacted(kind messages.MessageType) bool {
+	switch kind {
+	case messages.MessageType_MessageType_PinMatrixAck,
+		messages.MessageType_MessageType_PassphraseAck,
+		messages.MessageType_MessageType_WordAck,
+		messages.MessageType_MessageType_SetMnemonic,
+		messages.MessageType_MessageType_EntropyAck:
+		return true
+	}
+	return false
+}
+
+// Recorder writes capture entries to a capture file
+type Recorder struct {
+	lock sync.Mutex
+	w    io.Writer
+	err  error
+}
+
+// NewRecorder creates a Recorder writing JSON lines to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		w: w,
+	}
+}
+
+// OpenCaptureFile opens or creates the capture file at path and returns a Recorder appending to it
+func OpenCaptureFile(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f), nil
+}
+
+// Record writes e to the capture. Failing to record doesn't interrupt the device traffic,
+// the first error is kept and returned by Err.
+func (r *Recorder) Record(e CaptureEntry) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+
+	if e.Redacted {
+		e.Data = nil
+	}
+
+	b, err := json.Marshal(e)
+	if err == nil {
+		_, err = r.w.Write(append(b, '\n'))
+	}
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// Err returns the first error that happened while recording
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// Close closes the underlying writer if it is an io.Closer
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if c, ok := r.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// LoadCapture reads a capture file
+func LoadCapture(path string) ([]CaptureEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadCapture(f)
+}
+
+// ReadCapture reads capture entries from r
+func ReadCapture(r io.Reader) ([]CaptureEntry, error) {
+	var entries []CaptureEntry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 2*DefaultMaxMessageSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var e CaptureEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("capture entry %d: %v", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// messageAssembler reassembles wire messages from the 64 byte packets they are sent in
+type messageAssembler struct {
+	started bool
+	kind    uint16
+	size    uint32
+	data    []byte
+}
+
+// add adds a packet, returning the message once its last packet was added
+func (a *messageAssembler) add(p []byte) (wire.Message, bool, error) {
+	if len(p) != PacketLen || p[0] != '?' {
+		a.started = false
+		return wire.Message{}, false, wire.ErrMalformedMessage
+	}
+
+	if !a.started {
+		if p[1] != '#' || p[2] != '#' {
+			return wire.Message{}, false, wire.ErrMalformedMessage
+		}
+		a.kind = binary.BigEndian.Uint16(p[3:])
+		a.size = binary.BigEndian.Uint32(p[5:])
+		a.data = append(a.data[:0], p[headerLen:]...)
+		a.started = true
+	} else {
+		a.data = append(a.data, p[1:]...)
+	}
+
+	if uint32(len(a.data)) < a.size {
+		return wire.Message{}, false, nil
+	}
+
+	a.started = false
+	data := make([]byte, a.size)
+	copy(data, a.data)
+	return wire.Message{
+		Kind: a.kind,
+		Data: data,
+	}, true, nil
+}
+
+// isButtonPress reports whether p is a button press written by Device.SimulateButtonPress
+func isButtonPress(p []byte) bool {
+	return len(p) == len(emulatorButtonPrefix)+1 && bytes.HasPrefix(p, emulatorButtonPrefix)
+}
+
+// packets splits a message into the 64 byte packets it is sent in
+func packets(msg wire.Message) [][PacketLen]byte {
+	var buf bytes.Buffer
+	if _, err := msg.WriteTo(&buf); err != nil {
+		// WriteTo only fails if the writer does, which bytes.Buffer doesn't
+		panic(err)
+	}
+
+	b := buf.Bytes()
+	var out [][PacketLen]byte
+	for len(b) >= PacketLen {
+		var p [PacketLen]byte
+		copy(p[:], b[:PacketLen])
+		out = append(out, p)
+		b = b[PacketLen:]
+	}
+	return out
+}
+
+// writeChunks writes every chunk of a message to dev
+func writeChunks(dev io.Writer, chunks [][64]byte) error {
+	for _, c := range chunks {
+		if _, err := dev.Write(c[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordingDevice records the messages passing through a device connection
+type recordingDevice struct {
+	io.ReadWriteCloser
+	device string
+	rec    *Recorder
+	in     messageAssembler
+	out    messageAssembler
+}
+
+// Write records the message once its last packet was written
+func (d *recordingDevice) Write(p []byte) (int, error) {
+	n, err := d.ReadWriteCloser.Write(p)
+	if err != nil {
+		d.recordError(err)
+		return n, err
+	}
+
+	if isButtonPress(p) {
+		d.rec.Record(CaptureEntry{
+			Device: d.device,
+			Event:  EventButton,
+			Data:   append([]byte(nil), p...),
+		})
+		return n, nil
+	}
+
+	d.record(EventSend, &d.out, p)
+	return n, nil
+}
+
+// Read records the message once its last packet was read
+func (d *recordingDevice) Read(p []byte) (int, error) {
+	n, err := d.ReadWriteCloser.Read(p)
+	if err != nil {
+		d.recordError(err)
+		return n, err
+	}
+
+	d.record(EventRecv, &d.in, p[:n])
+	return n, nil
+}
+
+func (d *recordingDevice) record(event string, a *messageAssembler, p []byte) {
+	msg, ok, err := a.add(p)
+	if err != nil {
+		d.recordError(fmt.Errorf("%s: %v", event, err))
+		return
+	}
+	if !ok {
+		return
+	}
+
+	kind := messages.MessageType(msg.Kind)
+	d.rec.Record(CaptureEntry{
+		Device:   d.device,
+		Event:    event,
+		Kind:     kind.String(),
+		Data:     msg.Data,
+		Redacted: redacted(kind),
+	})
+}
+
+func (d *recordingDevice) recordError(err error) {
+	d.rec.Record(CaptureEntry{
+		Device: d.device,
+		Event:  EventError,
+		Error:  err.Error(),
+	})
+}
+
+// RecordingDriver wraps a DeviceDriver and records all traffic of its devices, including
+// ButtonAck and simulated button presses that bypass SendToDevice. Secrets are redacted.
+type RecordingDriver struct {
+	deviceWallet.DeviceDriver
+	Recorder *Recorder
+}
+
+// NewRecordingDriver creates a RecordingDriver
+func NewRecordingDriver(drv deviceWallet.DeviceDriver, rec *Recorder) *RecordingDriver {
+	return &RecordingDriver{
+		DeviceDriver: drv,
+		Recorder:     rec,
+	}
+}
+
+// GetDevice returns a device instance whose traffic is recorded
+func (drv *RecordingDriver) GetDevice() (io.ReadWriteCloser, error) {
+	dev, err := drv.DeviceDriver.GetDevice()
+	if err != nil {
+		drv.Recorder.Record(CaptureEntry{
+			Device: drv.DeviceType().String(),
+			Event:  EventConnectError,
+			Error:  err.Error(),
+		})
+		return dev, err
+	}
+	if dev == nil {
+		return dev, err
+	}
+
+	return &recordingDevice{
+		ReadWriteCloser: dev,
+		device:          drv.DeviceType().String(),
+		rec:             drv.Recorder,
+	}, nil
+}
@@ -0,0 +1,112 @@
+package driver
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var capture bytes.Buffer
+	rec := NewRecorder(&capture)
+
+	sim := NewSimulator(SimulatorConfig{
+		Mnemonic:      testMnemonic,
+		PIN:           "1234",
+		UsePassphrase: true,
+	})
+	dev := &deviceWallet.Device{
+		Driver: NewRecordingDriver(sim, rec),
+	}
+
+	run := func(dev *deviceWallet.Device) []string {
+		t.Helper()
+
+		msg, err := dev.AddressGen(2, 0, true)
+		expectKind(t, msg, err, messages.MessageType_MessageType_PinMatrixRequest)
+		msg, err = dev.PinMatrixAck("1234")
+		expectKind(t, msg, err, messages.MessageType_MessageType_PassphraseRequest)
+		msg, err = dev.PassphraseAck("hunter2")
+		expectKind(t, msg, err, messages.MessageType_MessageType_ButtonRequest)
+		msg, err = dev.ButtonAck()
+		expectKind(t, msg, err, messages.MessageType_MessageType_ResponseSkycoinAddress)
+
+		addresses, err := deviceWallet.DecodeResponseSkycoinAddress(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return addresses
+	}
+
+	recorded := run(dev)
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"1234", "hunter2"} {
+		if strings.Contains(capture.String(), secret) {
+			t.Fatalf("capture contains the secret %q", secret)
+		}
+	}
+
+	entries, err := ReadCapture(bytes.NewReader(capture.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 8 {
+		t.Fatalf("capture has %d entries, want 8", len(entries))
+	}
+
+	redactedKinds := 0
+	for _, e := range entries {
+		if e.Device != deviceWallet.DeviceTypeEmulator.String() {
+			t.Errorf("entry recorded for device %q", e.Device)
+		}
+		if e.Redacted {
+			redactedKinds++
+			if len(e.Data) != 0 {
+				t.Errorf("redacted %s entry has data", e.Kind)
+			}
+		}
+	}
+	if redactedKinds != 2 {
+		t.Fatalf("%d entries are redacted, want 2", redactedKinds)
+	}
+
+	replay := NewReplayDriver(entries, deviceWallet.DeviceTypeEmulator)
+	replayed := run(&deviceWallet.Device{Driver: replay})
+
+	if strings.Join(recorded, ",") != strings.Join(replayed, ",") {
+		t.Fatalf("replayed addresses %v, recorded %v", replayed, recorded)
+	}
+	if !replay.Done() {
+		t.Fatal("capture was not fully replayed")
+	}
+
+	if _, err := (&deviceWallet.Device{Driver: replay}).GetFeatures(); err != ErrCaptureExhausted {
+		t.Fatalf("expected ErrCaptureExhausted, got %v", err)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	var capture bytes.Buffer
+	rec := NewRecorder(&capture)
+
+	sim := NewSimulator(SimulatorConfig{Mnemonic: testMnemonic})
+	msg, err := (&deviceWallet.Device{Driver: NewRecordingDriver(sim, rec)}).GetFeatures()
+	expectKind(t, msg, err, messages.MessageType_MessageType_Features)
+
+	entries, err := ReadCapture(&capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev := &deviceWallet.Device{Driver: NewReplayDriver(entries, deviceWallet.DeviceTypeEmulator)}
+	_, err = dev.AddressGen(1, 0, false)
+	if _, ok := err.(ReplayMismatchError); !ok {
+		t.Fatalf("expected a ReplayMismatchError, got %v", err)
+	}
+}
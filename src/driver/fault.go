@@ -0,0 +1,190 @@
+package driver
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+)
+
+var (
+	// ErrDisconnected has the message of the usb package's error for a device unplugged during an action
+	ErrDisconnected = errors.New("Device disconnected during action")
+	// ErrFaultClosed is returned by a connection closed by a CloseAfterBytes fault
+	ErrFaultClosed = errors.New("fault: connection closed")
+)
+
+// FaultConfig selects the faults a FaultDriver injects. Zero values disable a fault.
+// Packet counts are shared by every connection of the driver so that a fault can hit a
+// later request, byte counts are per connection.
+type FaultConfig struct {
+	// ConnectError makes GetDevice fail
+	ConnectError error
+	// ReadDelay delays every read
+	ReadDelay time.Duration
+	// DropWriteEvery silently drops every Nth written packet
+	DropWriteEvery int
+	// CorruptReadEvery flips a byte of every Nth read packet
+	CorruptReadEvery int
+	// CorruptOffset is the offset of the flipped byte, defaults to the first payload byte
+	CorruptOffset int
+	// DisconnectAfterReads makes reads fail with ErrDisconnected once N packets were read
+	DisconnectAfterReads int
+	// CloseAfterBytes closes the connection when a read or write would exceed N bytes on it
+	CloseAfterBytes int
+}
+
+// FaultDriver wraps a DeviceDriver and injects faults in the connections to its devices,
+// including reads and writes that bypass SendToDevice such as ButtonAck
+type FaultDriver struct {
+	deviceWallet.DeviceDriver
+
+	lock   sync.Mutex
+	faults FaultConfig
+	writes int
+	reads  int
+}
+
+// NewFaultDriver creates a FaultDriver
+func NewFaultDriver(drv deviceWallet.DeviceDriver, faults FaultConfig) *FaultDriver {
+	return &FaultDriver{
+		DeviceDriver: drv,
+		faults:       faults,
+	}
+}
+
+// SetFaults replaces the injected faults and resets the packet counts
+func (drv *FaultDriver) SetFaults(faults FaultConfig) {
+	drv.lock.Lock()
+	defer drv.lock.Unlock()
+
+	drv.faults = faults
+	drv.writes = 0
+	drv.reads = 0
+}
+
+func (drv *FaultDriver) config() FaultConfig {
+	drv.lock.Lock()
+	defer drv.lock.Unlock()
+	return drv.faults
+}
+
+// GetDevice returns a device instance with faults injected
+func (drv *FaultDriver) GetDevice() (io.ReadWriteCloser, error) {
+	if err := drv.config().ConnectError; err != nil {
+		return nil, err
+	}
+
+	dev, err := drv.DeviceDriver.GetDevice()
+	if err != nil || dev == nil {
+		return dev, err
+	}
+
+	return &faultyDevice{
+		ReadWriteCloser: dev,
+		drv:             drv,
+	}, nil
+}
+
+// countWrite counts a written packet and reports whether it is dropped
+func (drv *FaultDriver) countWrite() bool {
+	drv.lock.Lock()
+	defer drv.lock.Unlock()
+
+	drv.writes++
+	return drv.faults.DropWriteEvery > 0 && drv.writes%drv.faults.DropWriteEvery == 0
+}
+
+// countRead counts a read packet and reports whether the device disconnects or the packet is corrupted
+func (drv *FaultDriver) countRead() (disconnect, corrupt bool) {
+	drv.lock.Lock()
+	defer drv.lock.Unlock()
+
+	if drv.faults.DisconnectAfterReads > 0 && drv.reads >= drv.faults.DisconnectAfterReads {
+		return true, false
+	}
+
+	drv.reads++
+	return false, drv.faults.CorruptReadEvery > 0 && drv.reads%drv.faults.CorruptReadEvery == 0
+}
+
+// faultyDevice injects the faults of its driver in a device connection
+type faultyDevice struct {
+	io.ReadWriteCloser
+	drv    *FaultDriver
+	bytes  int
+	closed bool
+}
+
+// transfer counts n transferred bytes. It closes the connection and returns false if
+// they would exceed the CloseAfterBytes limit.
+func (d *faultyDevice) transfer(n, limit int) bool {
+	if limit > 0 && d.bytes+n > limit {
+		d.closed = true
+		d.ReadWriteCloser.Close()
+		return false
+	}
+
+	d.bytes += n
+	return true
+}
+
+// Write writes p unless the packet is dropped or the connection is closed
+func (d *faultyDevice) Write(p []byte) (int, error) {
+	if d.closed {
+		return 0, ErrFaultClosed
+	}
+
+	faults := d.drv.config()
+
+	if d.drv.countWrite() {
+		return len(p), nil
+	}
+
+	if !d.transfer(len(p), faults.CloseAfterBytes) {
+		return 0, ErrFaultClosed
+	}
+
+	return d.ReadWriteCloser.Write(p)
+}
+
+// Read reads a packet, delaying, corrupting or failing it as configured
+func (d *faultyDevice) Read(p []byte) (int, error) {
+	if d.closed {
+		return 0, ErrFaultClosed
+	}
+
+	faults := d.drv.config()
+
+	if faults.ReadDelay > 0 {
+		time.Sleep(faults.ReadDelay)
+	}
+
+	disconnect, corrupt := d.drv.countRead()
+	if disconnect {
+		return 0, ErrDisconnected
+	}
+
+	n, err := d.ReadWriteCloser.Read(p)
+	if err != nil {
+		return n, err
+	}
+
+	if corrupt {
+		offset := faults.CorruptOffset
+		if offset == 0 {
+			offset = headerLen
+		}
+		if offset < n {
+			p[offset] ^= 0xff
+		}
+	}
+
+	if !d.transfer(n, faults.CloseAfterBytes) {
+		return 0, ErrFaultClosed
+	}
+
+	return n, nil
+}
@@ -0,0 +1,91 @@
+package driver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+)
+
+func TestFaultDriver(t *testing.T) {
+	errConnect := errors.New("No device connected")
+
+	cases := []struct {
+		name   string
+		faults FaultConfig
+		kind   messages.MessageType
+		err    error
+	}{
+		{
+			name: "no faults",
+			kind: messages.MessageType_MessageType_ResponseSkycoinAddress,
+		},
+		{
+			name:   "read delay",
+			faults: FaultConfig{ReadDelay: 10 * time.Millisecond},
+			kind:   messages.MessageType_MessageType_ResponseSkycoinAddress,
+		},
+		{
+			name:   "connect error",
+			faults: FaultConfig{ConnectError: errConnect},
+			err:    errConnect,
+		},
+		{
+			name:   "disconnect mid message",
+			faults: FaultConfig{DisconnectAfterReads: 1},
+			err:    ErrDisconnected,
+		},
+		{
+			name:   "close after first packet",
+			faults: FaultConfig{CloseAfterBytes: PacketLen},
+			err:    ErrFaultClosed,
+		},
+		{
+			name:   "dropped request packet",
+			faults: FaultConfig{DropWriteEvery: 1},
+			err:    ErrNoResponse,
+		},
+		{
+			name:   "corrupt header",
+			faults: FaultConfig{CorruptReadEvery: 1, CorruptOffset: 1},
+			err:    wire.ErrMalformedMessage,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := NewSimulator(SimulatorConfig{Mnemonic: testMnemonic})
+			dev := &deviceWallet.Device{
+				Driver: NewValidatingDriver(NewFaultDriver(sim, tc.faults), 0),
+			}
+
+			// enough addresses for the answer to span several packets
+			msg, err := dev.AddressGen(5, 0, false)
+			if tc.err != nil {
+				if err != tc.err {
+					t.Fatalf("expected error %v, got %v", tc.err, err)
+				}
+				return
+			}
+			expectKind(t, msg, err, tc.kind)
+		})
+	}
+}
+
+func TestFaultDriverSetFaults(t *testing.T) {
+	drv := NewFaultDriver(NewSimulator(SimulatorConfig{Mnemonic: testMnemonic}), FaultConfig{DisconnectAfterReads: 1})
+	dev := &deviceWallet.Device{Driver: drv}
+
+	if _, err := dev.AddressGen(5, 0, false); err != ErrDisconnected {
+		t.Fatalf("expected ErrDisconnected, got %v", err)
+	}
+
+	// the device still holds the rest of the interrupted answer on the old connection,
+	// a new request is answered once the faults are cleared
+	drv.SetFaults(FaultConfig{})
+	msg, err := dev.GetFeatures()
+	expectKind(t, msg, err, messages.MessageType_MessageType_Features)
+}
@@ -0,0 +1,411 @@
+package driver
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	"github.com/therealssj/testingdep1/src/device-wallet/usb"
+)
+
+const (
+	// DefaultKeepAliveInterval is how often a PersistentDriver checks its idle connection
+	DefaultKeepAliveInterval = 5 * time.Second
+	// DefaultIdleTimeout is how long a PersistentDriver keeps an unused connection open
+	DefaultIdleTimeout = 5 * time.Minute
+
+	usbConnectTries = 3
+)
+
+// ErrNoDevice has the message of the error returned by deviceWallet.Driver when no device is plugged
+var ErrNoDevice = errors.New("No device connected")
+
+// Connector opens the connections of a PersistentDriver
+type Connector interface {
+	// Connect opens a connection to the device
+	Connect() (io.ReadWriteCloser, error)
+	// Attached reports whether the device of the last connection is still attached.
+	// Connectors that can't tell without talking to the device return true.
+	Attached() bool
+	// Close releases the resources held by the connector
+	Close() error
+}
+
+// DriverConnector opens connections with the GetDevice method of a DeviceDriver
+type DriverConnector struct {
+	Driver deviceWallet.DeviceDriver
+}
+
+// Connect opens a connection to the device
+func (c DriverConnector) Connect() (io.ReadWriteCloser, error) {
+	dev, err := c.Driver.GetDevice()
+	if err == nil && dev == nil {
+		err = ErrNoDevice
+	}
+	return dev, err
+}
+
+// Attached returns true, GetDevice can't tell if a device is still attached
+func (c DriverConnector) Attached() bool {
+	return true
+}
+
+// Close does nothing
+func (c DriverConnector) Close() error {
+	return nil
+}
+
+// USBConnector opens connections to the first USB device found. Unlike deviceWallet.Driver,
+// it initializes the webusb and hidapi buses once and reuses them for every connection.
+type USBConnector struct {
+	webUSB *usb.WebUSB
+	bus    *usb.USB
+	path   string
+}
+
+// NewUSBConnector creates a USBConnector, the buses are initialized on the first connection
+func NewUSBConnector() *USBConnector {
+	return &USBConnector{}
+}
+
+func (c *USBConnector) init() error {
+	if c.bus != nil {
+		return nil
+	}
+
+	w, err := usb.InitWebUSB()
+	if err != nil {
+		return err
+	}
+	h, err := usb.InitHIDAPI()
+	if err != nil {
+		w.Close()
+		return err
+	}
+
+	c.webUSB = w
+	c.bus = usb.Init(w, h)
+	return nil
+}
+
+// Connect opens a connection to the first device found on the buses
+func (c *USBConnector) Connect() (io.ReadWriteCloser, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+
+	infos, err := c.bus.Enumerate()
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, ErrNoDevice
+	}
+
+	for tries := 0; ; tries++ {
+		dev, err := c.bus.Connect(infos[0].Path)
+		if err == nil {
+			c.path = infos[0].Path
+			return dev, nil
+		}
+		if tries == usbConnectTries-1 {
+			return nil, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Attached reports whether the device of the last connection is still enumerated
+func (c *USBConnector) Attached() bool {
+	if c.bus == nil || c.path == "" {
+		return false
+	}
+
+	infos, err := c.bus.Enumerate()
+	if err != nil {
+		return false
+	}
+	for _, info := range infos {
+		if info.Path == c.path {
+			return true
+		}
+	}
+	return false
+}
+
+// Close releases the webusb context
+func (c *USBConnector) Close() error {
+	if c.webUSB != nil {
+		c.webUSB.Close()
+		c.webUSB = nil
+		c.bus = nil
+	}
+	return nil
+}
+
+// PersistentConfig configures a PersistentDriver
+type PersistentConfig struct {
+	// Connector opens the connections. Defaults to a USBConnector for the USB driver of
+	// deviceWallet and to a DriverConnector otherwise.
+	Connector Connector
+	// KeepAliveInterval is how often the idle connection is checked, defaults to DefaultKeepAliveInterval
+	KeepAliveInterval time.Duration
+	// IdleTimeout closes the connection after this long without use, defaults to DefaultIdleTimeout
+	IdleTimeout time.Duration
+}
+
+// PersistentDriver wraps a DeviceDriver and keeps one connection to the device open across
+// calls instead of opening one per call. A single handle on the connection exists at a time,
+// so that the frames of concurrent calls don't interleave. The connection is dropped and lazily reopened when
+// a read or write fails, when a call leaves an answer unread, when the device is unplugged
+// while idle, or after IdleTimeout without use.
+type PersistentDriver struct {
+	deviceWallet.DeviceDriver
+
+	connector         Connector
+	keepAliveInterval time.Duration
+	idleTimeout       time.Duration
+
+	// exclusive is held from GetDevice until the returned handle is closed
+	exclusive sync.Mutex
+
+	lock     sync.Mutex
+	conn     *persistentConn
+	inUse    int
+	lastUsed time.Time
+	started  bool
+	closed   bool
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// NewPersistentDriver creates a PersistentDriver. Its keepalive loop starts with the first connection.
+func NewPersistentDriver(drv deviceWallet.DeviceDriver, cfg PersistentConfig) *PersistentDriver {
+	if cfg.Connector == nil {
+		if d, ok := drv.(*deviceWallet.Driver); ok && d.DeviceType() == deviceWallet.DeviceTypeUSB {
+			cfg.Connector = NewUSBConnector()
+		} else {
+			cfg.Connector = DriverConnector{drv}
+		}
+	}
+	if cfg.KeepAliveInterval == 0 {
+		cfg.KeepAliveInterval = DefaultKeepAliveInterval
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+
+	return &PersistentDriver{
+		DeviceDriver:      drv,
+		connector:         cfg.Connector,
+		keepAliveInterval: cfg.KeepAliveInterval,
+		idleTimeout:       cfg.IdleTimeout,
+		quit:              make(chan struct{}),
+		done:              make(chan struct{}),
+	}
+}
+
+// GetDevice returns a handle on the open connection, connecting first if there is none.
+// It waits until the handle returned before is closed. Closing the handle leaves the connection open.
+func (p *PersistentDriver) GetDevice() (io.ReadWriteCloser, error) {
+	p.exclusive.Lock()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		p.exclusive.Unlock()
+		return nil, ErrNoDevice
+	}
+
+	if p.conn == nil {
+		dev, err := p.connector.Connect()
+		if err != nil {
+			p.exclusive.Unlock()
+			return nil, err
+		}
+		p.conn = &persistentConn{ReadWriteCloser: dev}
+
+		if !p.started {
+			p.started = true
+			go p.keepAlive()
+		}
+	}
+
+	p.inUse++
+	return &persistentHandle{
+		drv:  p,
+		conn: p.conn,
+	}, nil
+}
+
+// Connected reports whether a connection is open
+func (p *PersistentDriver) Connected() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.conn != nil
+}
+
+// Close stops the keepalive loop and closes the connection and the connector
+func (p *PersistentDriver) Close() error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return nil
+	}
+	p.closed = true
+	started := p.started
+	p.lock.Unlock()
+
+	if started {
+		close(p.quit)
+		<-p.done
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.dropLocked(p.conn)
+	return p.connector.Close()
+}
+
+// release is called when a handle on conn is closed, it lets the next GetDevice call proceed
+func (p *PersistentDriver) release(conn *persistentConn, drop bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	defer p.exclusive.Unlock()
+
+	p.inUse--
+	p.lastUsed = time.Now()
+	if drop {
+		p.dropLocked(conn)
+	}
+}
+
+// drop closes conn if it is still the open connection
+func (p *PersistentDriver) drop(conn *persistentConn) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.dropLocked(conn)
+}
+
+func (p *PersistentDriver) dropLocked(conn *persistentConn) {
+	if conn == nil || p.conn != conn {
+		return
+	}
+	p.conn = nil
+	conn.ReadWriteCloser.Close()
+}
+
+// keepAlive closes the idle connection when it timed out or its device was unplugged,
+// so that the next call reconnects instead of failing
+func (p *PersistentDriver) keepAlive() {
+	defer close(p.done)
+
+	t := time.NewTicker(p.keepAliveInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-t.C:
+			p.checkIdle()
+		}
+	}
+}
+
+func (p *PersistentDriver) checkIdle() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.conn == nil || p.inUse > 0 {
+		return
+	}
+
+	if time.Since(p.lastUsed) >= p.idleTimeout || !p.connector.Attached() {
+		p.dropLocked(p.conn)
+	}
+}
+
+// persistentConn is the connection kept open by a PersistentDriver
+type persistentConn struct {
+	io.ReadWriteCloser
+}
+
+// persistentHandle is the connection handle returned by PersistentDriver.GetDevice. It tracks
+// the messages written and read so that a connection left with an unread answer is dropped
+// instead of serving that answer to the next call.
+type persistentHandle struct {
+	drv    *PersistentDriver
+	conn   *persistentConn
+	in     messageAssembler
+	out    messageAssembler
+	sent   int
+	recv   int
+	broken bool
+	closed bool
+}
+
+// Write writes p to the connection, dropping it on error
+func (h *persistentHandle) Write(p []byte) (int, error) {
+	if h.closed {
+		return 0, ErrNoDevice
+	}
+
+	n, err := h.conn.Write(p)
+	if err != nil {
+		h.broken = true
+		h.drv.drop(h.conn)
+		return n, err
+	}
+
+	if isButtonPress(p) {
+		return n, nil
+	}
+
+	if _, ok, err := h.out.add(p); err != nil {
+		h.broken = true
+	} else if ok {
+		h.sent++
+	}
+
+	return n, nil
+}
+
+// Read reads from the connection, dropping it on error
+func (h *persistentHandle) Read(p []byte) (int, error) {
+	if h.closed {
+		return 0, ErrNoDevice
+	}
+
+	n, err := h.conn.Read(p)
+	if err != nil {
+		h.broken = true
+		h.drv.drop(h.conn)
+		return n, err
+	}
+
+	if _, ok, err := h.in.add(p[:n]); err != nil {
+		h.broken = true
+	} else if ok {
+		h.recv++
+	}
+
+	return n, nil
+}
+
+// Close releases the handle. The connection stays open unless the handle saw an error or
+// the last message exchange is incomplete.
+func (h *persistentHandle) Close() error {
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+
+	drop := h.broken || h.sent != h.recv || h.in.started || h.out.started
+	h.drv.release(h.conn, drop)
+	return nil
+}
@@ -0,0 +1,291 @@
+package driver
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+)
+
+// countingConnector counts the connections it opens and lets tests unplug the device
+type countingConnector struct {
+	DriverConnector
+
+	lock     sync.Mutex
+	connects int
+	detached bool
+}
+
+func (c *countingConnector) Connect() (io.ReadWriteCloser, error) {
+	c.lock.Lock()
+	c.connects++
+	c.lock.Unlock()
+	return c.DriverConnector.Connect()
+}
+
+func (c *countingConnector) Attached() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return !c.detached
+}
+
+func (c *countingConnector) count() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.connects
+}
+
+// slowConnector opens connections pausing after each frame, so that concurrent exchanges
+// sharing a connection would interleave their frames
+type slowConnector struct {
+	DriverConnector
+}
+
+func (c slowConnector) Connect() (io.ReadWriteCloser, error) {
+	dev, err := c.DriverConnector.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return slowConn{dev}, nil
+}
+
+type slowConn struct {
+	io.ReadWriteCloser
+}
+
+func (c slowConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	time.Sleep(time.Millisecond)
+	return n, err
+}
+
+func (c slowConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	time.Sleep(time.Millisecond)
+	return n, err
+}
+
+func newPersistentTestDevice(t *testing.T, inner deviceWallet.DeviceDriver, cfg PersistentConfig) (*deviceWallet.Device, *PersistentDriver, *countingConnector) {
+	c := &countingConnector{
+		DriverConnector: DriverConnector{inner},
+	}
+	cfg.Connector = c
+	drv := NewPersistentDriver(inner, cfg)
+	t.Cleanup(func() {
+		drv.Close()
+	})
+	return &deviceWallet.Device{Driver: drv}, drv, c
+}
+
+func TestPersistentDriverReusesConnection(t *testing.T) {
+	dev, drv, c := newPersistentTestDevice(t, NewSimulator(SimulatorConfig{Mnemonic: testMnemonic}), PersistentConfig{})
+
+	for i := 0; i < 3; i++ {
+		msg, err := dev.AddressGen(2, i, false)
+		expectKind(t, msg, err, messages.MessageType_MessageType_ResponseSkycoinAddress)
+	}
+	msg, err := dev.GetFeatures()
+	expectKind(t, msg, err, messages.MessageType_MessageType_Features)
+
+	if c.count() != 1 {
+		t.Fatalf("expected a single connection, got %d", c.count())
+	}
+	if !drv.Connected() {
+		t.Fatal("connection was closed")
+	}
+}
+
+func TestPersistentDriverPinFlow(t *testing.T) {
+	sim := NewSimulator(SimulatorConfig{
+		Mnemonic: testMnemonic,
+		PIN:      "1234",
+	})
+	dev, _, c := newPersistentTestDevice(t, sim, PersistentConfig{})
+
+	msg, err := dev.AddressGen(1, 0, false)
+	expectKind(t, msg, err, messages.MessageType_MessageType_PinMatrixRequest)
+
+	// the device keeps its state between the calls sharing the connection
+	msg, err = dev.PinMatrixAck("1234")
+	expectKind(t, msg, err, messages.MessageType_MessageType_ResponseSkycoinAddress)
+
+	if c.count() != 1 {
+		t.Fatalf("expected a single connection, got %d", c.count())
+	}
+}
+
+func TestPersistentDriverReconnects(t *testing.T) {
+	faults := NewFaultDriver(NewSimulator(SimulatorConfig{Mnemonic: testMnemonic}), FaultConfig{DisconnectAfterReads: 1})
+	dev, drv, c := newPersistentTestDevice(t, faults, PersistentConfig{})
+
+	if _, err := dev.AddressGen(5, 0, false); err != ErrDisconnected {
+		t.Fatalf("expected ErrDisconnected, got %v", err)
+	}
+	if drv.Connected() {
+		t.Fatal("broken connection was kept")
+	}
+
+	// the rest of the interrupted answer is not served to the next request
+	faults.SetFaults(FaultConfig{})
+	msg, err := dev.GetFeatures()
+	expectKind(t, msg, err, messages.MessageType_MessageType_Features)
+
+	if c.count() != 2 {
+		t.Fatalf("expected 2 connections, got %d", c.count())
+	}
+}
+
+func TestPersistentDriverDropsUnansweredConnection(t *testing.T) {
+	_, drv, c := newPersistentTestDevice(t, NewSimulator(SimulatorConfig{Mnemonic: testMnemonic}), PersistentConfig{})
+
+	dev, err := drv.GetDevice()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := deviceWallet.MessageGetFeatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := drv.SendToDeviceNoAnswer(dev, chunks); err != nil {
+		t.Fatal(err)
+	}
+	dev.Close()
+
+	if drv.Connected() {
+		t.Fatal("connection with an unread answer was kept")
+	}
+
+	d := &deviceWallet.Device{Driver: drv}
+	msg, err := d.AddressGen(1, 0, false)
+	expectKind(t, msg, err, messages.MessageType_MessageType_ResponseSkycoinAddress)
+
+	if c.count() != 2 {
+		t.Fatalf("expected 2 connections, got %d", c.count())
+	}
+}
+
+func TestPersistentDriverConcurrentCalls(t *testing.T) {
+	sim := NewSimulator(SimulatorConfig{Mnemonic: testMnemonic})
+	drv := NewPersistentDriver(sim, PersistentConfig{
+		Connector: slowConnector{DriverConnector{sim}},
+	})
+	defer drv.Close()
+
+	const calls = 20
+	expected, err := sim.Addresses("", 0, calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// exchange sends a request on its own handle, like deviceWallet.Device does
+	exchange := func(i int) error {
+		dev, err := drv.GetDevice()
+		if err != nil {
+			return err
+		}
+		defer dev.Close()
+
+		chunks, err := deviceWallet.MessageAddressGen(1, i, false)
+		if err != nil {
+			return err
+		}
+		msg, err := drv.SendToDevice(dev, chunks)
+		if err != nil {
+			return err
+		}
+		addresses, err := deviceWallet.DecodeResponseSkycoinAddress(msg)
+		if err != nil {
+			return err
+		}
+		// each call reads the answer to its own request
+		if len(addresses) != 1 || addresses[0] != expected[i] {
+			return fmt.Errorf("call %d got addresses %v instead of %s", i, addresses, expected[i])
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, calls)
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := exchange(i); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestPersistentDriverKeepAlive(t *testing.T) {
+	cases := []struct {
+		name   string
+		cfg    PersistentConfig
+		detach bool
+	}{
+		{
+			name: "idle timeout",
+			cfg: PersistentConfig{
+				KeepAliveInterval: 5 * time.Millisecond,
+				IdleTimeout:       20 * time.Millisecond,
+			},
+		},
+		{
+			name: "device unplugged",
+			cfg: PersistentConfig{
+				KeepAliveInterval: 5 * time.Millisecond,
+			},
+			detach: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dev, drv, c := newPersistentTestDevice(t, NewSimulator(SimulatorConfig{Mnemonic: testMnemonic}), tc.cfg)
+
+			msg, err := dev.GetFeatures()
+			expectKind(t, msg, err, messages.MessageType_MessageType_Features)
+
+			if tc.detach {
+				c.lock.Lock()
+				c.detached = true
+				c.lock.Unlock()
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for drv.Connected() {
+				if time.Now().After(deadline) {
+					t.Fatal("idle connection was not closed")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestPersistentDriverClose(t *testing.T) {
+	dev, drv, _ := newPersistentTestDevice(t, NewSimulator(SimulatorConfig{Mnemonic: testMnemonic}), PersistentConfig{})
+
+	msg, err := dev.GetFeatures()
+	expectKind(t, msg, err, messages.MessageType_MessageType_Features)
+
+	if err := drv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if drv.Connected() {
+		t.Fatal("connection open after Close")
+	}
+	if _, err := dev.GetFeatures(); err != ErrNoDevice {
+		t.Fatalf("expected ErrNoDevice, got %v", err)
+	}
+}
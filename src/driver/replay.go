@@ -0,0 +1,205 @@
+package driver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+)
+
+// ErrCaptureExhausted is returned when the daemon talks to a replayed device past the end of the capture
+var ErrCaptureExhausted = errors.New("replay: capture exhausted")
+
+// ReplayMismatchError is returned when the daemon sends something else than the capture recorded
+type ReplayMismatchError struct {
+	Index    int
+	Expected string
+	Got      string
+}
+
+func (e ReplayMismatchError) Error() string {
+	return fmt.Sprintf("replay: capture entry %d expected %s, got %s", e.Index, e.Expected, e.Got)
+}
+
+// ReplayDriver is a DeviceDriver serving a capture recorded by RecordingDriver back to the daemon.
+// Messages written to the device are checked against the capture by kind, their payloads
+// aren't compared since redacted payloads weren't recorded.
+type ReplayDriver struct {
+	lock       sync.Mutex
+	deviceType deviceWallet.DeviceType
+	entries    []CaptureEntry
+	pos        int
+}
+
+// NewReplayDriver creates a ReplayDriver replaying the entries recorded for deviceType
+func NewReplayDriver(entries []CaptureEntry, deviceType deviceWallet.DeviceType) *ReplayDriver {
+	drv := &ReplayDriver{
+		deviceType: deviceType,
+	}
+	for _, e := range entries {
+		if e.Device == deviceType.String() {
+			drv.entries = append(drv.entries, e)
+		}
+	}
+	return drv
+}
+
+// Done reports whether every entry of the capture was replayed
+func (drv *ReplayDriver) Done() bool {
+	drv.lock.Lock()
+	defer drv.lock.Unlock()
+	return drv.pos == len(drv.entries)
+}
+
+// DeviceType return driver device type
+func (drv *ReplayDriver) DeviceType() deviceWallet.DeviceType {
+	return drv.deviceType
+}
+
+// GetDevice returns a connection to the replayed device, or the recorded connection failure
+func (drv *ReplayDriver) GetDevice() (io.ReadWriteCloser, error) {
+	drv.lock.Lock()
+	defer drv.lock.Unlock()
+
+	if drv.pos < len(drv.entries) && drv.entries[drv.pos].Event == EventConnectError {
+		e := drv.entries[drv.pos]
+		drv.pos++
+		return nil, errors.New(e.Error)
+	}
+
+	return &replayConn{drv: drv}, nil
+}
+
+// SendToDevice sends msg to device and returns response
+func (drv *ReplayDriver) SendToDevice(dev io.ReadWriteCloser, chunks [][64]byte) (wire.Message, error) {
+	var msg wire.Message
+	if err := writeChunks(dev, chunks); err != nil {
+		return msg, err
+	}
+	_, err := msg.ReadFrom(dev)
+	return msg, err
+}
+
+// SendToDeviceNoAnswer sends msg to device and doesnt return response
+func (drv *ReplayDriver) SendToDeviceNoAnswer(dev io.ReadWriteCloser, chunks [][64]byte) error {
+	return writeChunks(dev, chunks)
+}
+
+// next consumes the next entry, which must be of the given event
+func (drv *ReplayDriver) next(event, got string) (CaptureEntry, error) {
+	drv.lock.Lock()
+	defer drv.lock.Unlock()
+
+	if drv.pos == len(drv.entries) {
+		return CaptureEntry{}, ErrCaptureExhausted
+	}
+
+	e := drv.entries[drv.pos]
+	if e.Event != event && e.Event != EventError {
+		return CaptureEntry{}, ReplayMismatchError{
+			Index:    drv.pos,
+			Expected: describeEntry(e),
+			Got:      got,
+		}
+	}
+
+	drv.pos++
+	return e, nil
+}
+
+func describeEntry(e CaptureEntry) string {
+	if e.Kind != "" {
+		return e.Event + " " + e.Kind
+	}
+	return e.Event
+}
+
+// replayConn is a connection to a replayed device
+type replayConn struct {
+	drv *ReplayDriver
+	in  messageAssembler
+	out [][PacketLen]byte
+}
+
+// Write checks a written packet or button press against the capture
+func (c *replayConn) Write(p []byte) (int, error) {
+	if isButtonPress(p) {
+		e, err := c.drv.next(EventButton, EventButton)
+		if err != nil {
+			return 0, err
+		}
+		if e.Event == EventError {
+			return 0, errors.New(e.Error)
+		}
+		if !bytes.Equal(e.Data, p) {
+			return 0, ReplayMismatchError{
+				Index:    c.drv.pos - 1,
+				Expected: fmt.Sprintf("button %v", e.Data),
+				Got:      fmt.Sprintf("button %v", p),
+			}
+		}
+		return len(p), nil
+	}
+
+	msg, ok, err := c.in.add(p)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return len(p), nil
+	}
+
+	kind := messages.MessageType(msg.Kind).String()
+	e, err := c.drv.next(EventSend, EventSend+" "+kind)
+	if err != nil {
+		return 0, err
+	}
+	if e.Event == EventError {
+		return 0, errors.New(e.Error)
+	}
+	if e.Kind != kind {
+		return 0, ReplayMismatchError{
+			Index:    c.drv.pos - 1,
+			Expected: describeEntry(e),
+			Got:      EventSend + " " + kind,
+		}
+	}
+
+	return len(p), nil
+}
+
+// Read returns the next packet of the recorded answer
+func (c *replayConn) Read(p []byte) (int, error) {
+	if len(c.out) == 0 {
+		e, err := c.drv.next(EventRecv, EventRecv)
+		if err != nil {
+			return 0, err
+		}
+		if e.Event == EventError {
+			return 0, errors.New(e.Error)
+		}
+
+		kind, ok := messages.MessageType_value[e.Kind]
+		if !ok {
+			return 0, fmt.Errorf("replay: unknown message kind %q", e.Kind)
+		}
+		c.out = packets(wire.Message{
+			Kind: uint16(kind),
+			Data: e.Data,
+		})
+	}
+
+	n := copy(p, c.out[0][:])
+	c.out = c.out[1:]
+	return n, nil
+}
+
+// Close closes the connection
+func (c *replayConn) Close() error {
+	return nil
+}
@@ -0,0 +1,771 @@
+package driver
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/base58"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+const (
+	// DefaultSimulatorMaxAddresses is the largest number of addresses the simulator derives per request,
+	// mirroring the firmware limit
+	DefaultSimulatorMaxAddresses = 99
+)
+
+var (
+	// ErrNoResponse is returned when reading from a simulated device that has nothing to answer
+	ErrNoResponse = errors.New("simulator: no response pending")
+	// ErrClosed is returned when using a closed simulated device connection
+	ErrClosed = errors.New("simulator: connection closed")
+
+	// emulatorButtonPrefix starts the messages written by Device.SimulateButtonPress
+	emulatorButtonPrefix = []byte{0, 1, 2, 3, 4}
+)
+
+// ButtonAction is how the simulated user answers a ButtonRequest
+type ButtonAction int
+
+const (
+	// ButtonConfirm confirms the action shown on the screen
+	ButtonConfirm ButtonAction = iota
+	// ButtonCancel cancels the action shown on the screen
+	ButtonCancel
+)
+
+// SimulatorConfig configures a Simulator
+type SimulatorConfig struct {
+	// Mnemonic the device is initialized with, the device is uninitialized if empty
+	Mnemonic string
+	// PIN protecting the device, no PIN is requested if empty.
+	// The simulator shows the PIN matrix in keypad order so PinMatrixAck takes the PIN itself.
+	PIN string
+	// UsePassphrase enables passphrase protection
+	UsePassphrase bool
+	Label         string
+	DeviceID      string
+	// DeviceType reported by the driver, defaults to DeviceTypeEmulator so that simulated button presses work
+	DeviceType deviceWallet.DeviceType
+	// MaxAddresses is the largest number of addresses derived per request, defaults to DefaultSimulatorMaxAddresses
+	MaxAddresses int
+}
+
+// Simulator is an in-process software wallet implementing DeviceDriver.
+// It speaks the wire framing used by the firmware, derives keys from the mnemonic with
+// cipher.GenerateDeterministicKeyPairs and models PIN, passphrase and button interaction.
+// Every connection returned by GetDevice shares the simulator state, as the Device reconnects for every call.
+type Simulator struct {
+	lock sync.Mutex
+
+	deviceType   deviceWallet.DeviceType
+	maxAddresses int
+
+	mnemonic             string
+	pin                  string
+	label                string
+	deviceID             string
+	passphraseProtection bool
+
+	// session state, cleared by Initialize
+	pinCached  bool
+	passphrase *string
+
+	button  ButtonAction
+	pending *pendingRequest
+}
+
+type requestStage int
+
+const (
+	stageNone requestStage = iota
+	stagePin
+	stagePassphrase
+	stageButton
+	stageNewPinFirst
+	stageNewPinSecond
+)
+
+// pendingRequest is a request waiting for a PIN, passphrase or button confirmation
+type pendingRequest struct {
+	kind    messages.MessageType
+	msg     proto.Message
+	stage   requestStage
+	pinDone bool
+	buttons int
+	newPin  string
+}
+
+// NewSimulator creates a Simulator
+func NewSimulator(c SimulatorConfig) *Simulator {
+	if c.DeviceType == 0 {
+		c.DeviceType = deviceWallet.DeviceTypeEmulator
+	}
+	if c.MaxAddresses == 0 {
+		c.MaxAddresses = DefaultSimulatorMaxAddresses
+	}
+	if c.DeviceID == "" {
+		c.DeviceID = newDeviceID()
+	}
+
+	return &Simulator{
+		deviceType:           c.DeviceType,
+		maxAddresses:         c.MaxAddresses,
+		mnemonic:             c.Mnemonic,
+		pin:                  c.PIN,
+		label:                c.Label,
+		deviceID:             c.DeviceID,
+		passphraseProtection: c.UsePassphrase,
+	}
+}
+
+// NewSimulatedDevice creates a Device backed by a Simulator
+func NewSimulatedDevice(c SimulatorConfig) (*deviceWallet.Device, *Simulator) {
+	sim := NewSimulator(c)
+	return &deviceWallet.Device{
+		Driver: sim,
+	}, sim
+}
+
+func newDeviceID() string {
+	return strings.ToUpper(hex.EncodeToString(cipher.RandByte(12)))
+}
+
+// SetButtonAction sets how the simulated user answers ButtonRequests that are not
+// answered by a simulated emulator button press
+func (s *Simulator) SetButtonAction(a ButtonAction) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.button = a
+}
+
+// Mnemonic returns the mnemonic the simulator is configured with
+func (s *Simulator) Mnemonic() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.mnemonic
+}
+
+// Addresses derives n addresses starting at startIndex for the given passphrase,
+// without any user interaction. Tests use it to compute expected results.
+func (s *Simulator) Addresses(passphrase string, startIndex, n int) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	keys, err := s.keys(passphrase, startIndex, n)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, len(keys))
+	for i, k := range keys {
+		addresses[i] = cipher.MustAddressFromSecKey(k).String()
+	}
+	return addresses, nil
+}
+
+// DeviceType return driver device type
+func (s *Simulator) DeviceType() deviceWallet.DeviceType {
+	return s.deviceType
+}
+
+// GetDevice returns a new connection to the simulated device
+func (s *Simulator) GetDevice() (io.ReadWriteCloser, error) {
+	return &simulatedConn{sim: s}, nil
+}
+
+// SendToDevice sends msg to device and returns response
+func (s *Simulator) SendToDevice(dev io.ReadWriteCloser, chunks [][64]byte) (wire.Message, error) {
+	var msg wire.Message
+	if err := s.SendToDeviceNoAnswer(dev, chunks); err != nil {
+		return msg, err
+	}
+	_, err := msg.ReadFrom(dev)
+	return msg, err
+}
+
+// SendToDeviceNoAnswer sends msg to device and doesnt return response
+func (s *Simulator) SendToDeviceNoAnswer(dev io.ReadWriteCloser, chunks [][64]byte) error {
+	return writeChunks(dev, chunks)
+}
+
+// seed returns the seed keys are derived from. Hidden wallets append the passphrase to the mnemonic,
+// which keeps their addresses distinct from the standard wallet in tests.
+func (s *Simulator) seed(passphrase string) []byte {
+	if passphrase == "" {
+		return []byte(s.mnemonic)
+	}
+	return []byte(s.mnemonic + "\n" + passphrase)
+}
+
+func (s *Simulator) keys(passphrase string, startIndex, n int) ([]cipher.SecKey, error) {
+	if s.mnemonic == "" {
+		return nil, errors.New("device is not initialized")
+	}
+
+	keys, err := cipher.GenerateDeterministicKeyPairs(s.seed(passphrase), startIndex+n)
+	if err != nil {
+		return nil, err
+	}
+	return keys[startIndex:], nil
+}
+
+func (s *Simulator) sessionPassphrase() string {
+	if s.passphrase == nil {
+		return ""
+	}
+	return *s.passphrase
+}
+
+// handle processes a request and returns the device answer
+func (s *Simulator) handle(kind messages.MessageType, data []byte) wire.Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch kind {
+	case messages.MessageType_MessageType_Initialize:
+		s.pending = nil
+		s.pinCached = false
+		s.passphrase = nil
+		return s.features()
+	case messages.MessageType_MessageType_GetFeatures:
+		return s.features()
+	case messages.MessageType_MessageType_Ping:
+		var ping messages.Ping
+		if err := unmarshalRequest(data, &ping); err != nil {
+			return failure(messages.FailureType_Failure_DataError, err.Error())
+		}
+		return success(ping.GetMessage())
+	case messages.MessageType_MessageType_Cancel:
+		s.pending = nil
+		return failure(messages.FailureType_Failure_ActionCancelled, "Action cancelled by user")
+	case messages.MessageType_MessageType_PinMatrixAck:
+		var ack messages.PinMatrixAck
+		if err := unmarshalRequest(data, &ack); err != nil {
+			return failure(messages.FailureType_Failure_DataError, err.Error())
+		}
+		return s.pinMatrixAck(ack.GetPin())
+	case messages.MessageType_MessageType_PassphraseAck:
+		var ack messages.PassphraseAck
+		if err := unmarshalRequest(data, &ack); err != nil {
+			return failure(messages.FailureType_Failure_DataError, err.Error())
+		}
+		if s.pending == nil || s.pending.stage != stagePassphrase {
+			s.pending = nil
+			return failure(messages.FailureType_Failure_UnexpectedMessage, "Unexpected message")
+		}
+		passphrase := ack.GetPassphrase()
+		s.passphrase = &passphrase
+		return s.advance()
+	}
+
+	msg, err := newRequestMessage(kind)
+	if err != nil {
+		s.pending = nil
+		return failure(messages.FailureType_Failure_UnexpectedMessage, err.Error())
+	}
+	if err := unmarshalRequest(data, msg); err != nil {
+		s.pending = nil
+		return failure(messages.FailureType_Failure_DataError, err.Error())
+	}
+
+	// a new request replaces any request that was waiting for the user
+	s.pending = &pendingRequest{
+		kind:    kind,
+		msg:     msg,
+		buttons: s.buttonCount(kind, msg),
+	}
+	return s.advance()
+}
+
+// pressButton resolves a pending ButtonRequest, using the simulator's button action if the
+// host did not simulate a press
+func (s *Simulator) pressButton(press *ButtonAction) wire.Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.pending == nil || s.pending.stage != stageButton {
+		s.pending = nil
+		return failure(messages.FailureType_Failure_UnexpectedMessage, "Unexpected message")
+	}
+
+	action := s.button
+	if press != nil {
+		action = *press
+	}
+
+	if action == ButtonCancel {
+		s.pending = nil
+		return failure(messages.FailureType_Failure_ActionCancelled, "Action cancelled by user")
+	}
+
+	return s.advance()
+}
+
+func (s *Simulator) pinMatrixAck(pin string) wire.Message {
+	p := s.pending
+	if p == nil {
+		return failure(messages.FailureType_Failure_UnexpectedMessage, "Unexpected message")
+	}
+
+	switch p.stage {
+	case stagePin:
+		if pin != s.pin {
+			s.pending = nil
+			return failure(messages.FailureType_Failure_PinInvalid, "PIN invalid")
+		}
+		s.pinCached = true
+		p.pinDone = true
+		return s.advance()
+	case stageNewPinFirst:
+		p.newPin = pin
+		p.stage = stageNewPinSecond
+		return pinMatrixRequest()
+	case stageNewPinSecond:
+		s.pending = nil
+		if pin != p.newPin {
+			return failure(messages.FailureType_Failure_PinMismatch, "PIN mismatch")
+		}
+		s.pin = pin
+		s.pinCached = true
+		return success("PIN changed")
+	default:
+		s.pending = nil
+		return failure(messages.FailureType_Failure_UnexpectedMessage, "Unexpected message")
+	}
+}
+
+// advance moves the pending request to its next stage, executing it once no user input is missing
+func (s *Simulator) advance() wire.Message {
+	p := s.pending
+
+	if requiresSeed(p.kind) && s.mnemonic == "" {
+		s.pending = nil
+		return failure(messages.FailureType_Failure_NotInitialized, "Device not initialized")
+	}
+
+	if requiresPin(p.kind) && s.pin != "" && !s.pinCached && !p.pinDone {
+		p.stage = stagePin
+		return pinMatrixRequest()
+	}
+
+	if requiresPassphrase(p.kind) && s.passphraseProtection && s.passphrase == nil {
+		p.stage = stagePassphrase
+		return newMessage(messages.MessageType_MessageType_PassphraseRequest, &messages.PassphraseRequest{})
+	}
+
+	if p.buttons > 0 {
+		p.buttons--
+		p.stage = stageButton
+		return newMessage(messages.MessageType_MessageType_ButtonRequest, &messages.ButtonRequest{})
+	}
+
+	if p.kind == messages.MessageType_MessageType_ChangePin {
+		if req := p.msg.(*messages.ChangePin); !req.GetRemove() {
+			p.stage = stageNewPinFirst
+			return pinMatrixRequest()
+		}
+	}
+
+	s.pending = nil
+	return s.execute(p.kind, p.msg)
+}
+
+// buttonCount returns the number of confirmations a request needs
+func (s *Simulator) buttonCount(kind messages.MessageType, msg proto.Message) int {
+	switch kind {
+	case messages.MessageType_MessageType_ApplySettings,
+		messages.MessageType_MessageType_WipeDevice,
+		messages.MessageType_MessageType_SetMnemonic,
+		messages.MessageType_MessageType_GenerateMnemonic,
+		messages.MessageType_MessageType_ChangePin:
+		return 1
+	case messages.MessageType_MessageType_SkycoinAddress:
+		if msg.(*messages.SkycoinAddress).GetConfirmAddress() {
+			return 1
+		}
+	case messages.MessageType_MessageType_TransactionSign:
+		// every output that is not change is confirmed on the screen
+		n := 0
+		for _, o := range msg.(*messages.TransactionSign).TransactionOut {
+			if o.AddressIndex == nil {
+				n++
+			}
+		}
+		return n
+	}
+	return 0
+}
+
+func (s *Simulator) execute(kind messages.MessageType, msg proto.Message) wire.Message {
+	switch kind {
+	case messages.MessageType_MessageType_SkycoinAddress:
+		return s.addressGen(msg.(*messages.SkycoinAddress))
+	case messages.MessageType_MessageType_ApplySettings:
+		req := msg.(*messages.ApplySettings)
+		if req.Label != nil {
+			s.label = req.GetLabel()
+		}
+		if req.UsePassphrase != nil {
+			s.passphraseProtection = req.GetUsePassphrase()
+			s.passphrase = nil
+		}
+		return success("Settings applied")
+	case messages.MessageType_MessageType_SetMnemonic:
+		s.mnemonic = msg.(*messages.SetMnemonic).GetMnemonic()
+		s.passphrase = nil
+		return success("Mnemonic successfully configured")
+	case messages.MessageType_MessageType_GenerateMnemonic:
+		if s.mnemonic != "" {
+			return failure(messages.FailureType_Failure_UnexpectedMessage, "Device is already initialized. Use Wipe first.")
+		}
+		req := msg.(*messages.GenerateMnemonic)
+		s.mnemonic = hex.EncodeToString(cipher.RandByte(32))
+		s.passphraseProtection = req.GetPassphraseProtection()
+		s.passphrase = nil
+		return success("Mnemonic successfully configured")
+	case messages.MessageType_MessageType_WipeDevice:
+		s.mnemonic = ""
+		s.pin = ""
+		s.label = ""
+		s.passphraseProtection = false
+		s.pinCached = false
+		s.passphrase = nil
+		s.deviceID = newDeviceID()
+		return success("Device wiped")
+	case messages.MessageType_MessageType_ChangePin:
+		s.pin = ""
+		s.pinCached = false
+		return success("PIN removed")
+	case messages.MessageType_MessageType_SkycoinSignMessage:
+		return s.signMessage(msg.(*messages.SkycoinSignMessage))
+	case messages.MessageType_MessageType_SkycoinCheckMessageSignature:
+		return checkMessageSignature(msg.(*messages.SkycoinCheckMessageSignature))
+	case messages.MessageType_MessageType_TransactionSign:
+		return s.transactionSign(msg.(*messages.TransactionSign))
+	default:
+		return failure(messages.FailureType_Failure_UnexpectedMessage, fmt.Sprintf("%s is not supported by the simulator", kind))
+	}
+}
+
+func (s *Simulator) features() wire.Message {
+	return newMessage(messages.MessageType_MessageType_Features, &messages.Features{
+		Vendor:               proto.String("Skycoin Foundation"),
+		MajorVersion:         proto.Uint32(1),
+		MinorVersion:         proto.Uint32(0),
+		PatchVersion:         proto.Uint32(0),
+		DeviceId:             proto.String(s.deviceID),
+		PinProtection:        proto.Bool(s.pin != ""),
+		PassphraseProtection: proto.Bool(s.passphraseProtection),
+		Label:                proto.String(s.label),
+		Initialized:          proto.Bool(s.mnemonic != ""),
+		PinCached:            proto.Bool(s.pinCached),
+		PassphraseCached:     proto.Bool(s.passphrase != nil),
+	})
+}
+
+func (s *Simulator) addressGen(req *messages.SkycoinAddress) wire.Message {
+	n := int(req.GetAddressN())
+	if n == 0 || n > s.maxAddresses {
+		return failure(messages.FailureType_Failure_DataError, "Asking for too much addresses")
+	}
+
+	keys, err := s.keys(s.sessionPassphrase(), int(req.GetStartIndex()), n)
+	if err != nil {
+		return failure(messages.FailureType_Failure_ProcessError, err.Error())
+	}
+
+	addresses := make([]string, len(keys))
+	for i, k := range keys {
+		addresses[i] = cipher.MustAddressFromSecKey(k).String()
+	}
+
+	return newMessage(messages.MessageType_MessageType_ResponseSkycoinAddress, &messages.ResponseSkycoinAddress{
+		Addresses: addresses,
+	})
+}
+
+func (s *Simulator) signMessage(req *messages.SkycoinSignMessage) wire.Message {
+	keys, err := s.keys(s.sessionPassphrase(), int(req.GetAddressN()), 1)
+	if err != nil {
+		return failure(messages.FailureType_Failure_ProcessError, err.Error())
+	}
+
+	sig, err := cipher.SignHash(cipher.SumSHA256([]byte(req.GetMessage())), keys[0])
+	if err != nil {
+		return failure(messages.FailureType_Failure_ProcessError, err.Error())
+	}
+
+	return newMessage(messages.MessageType_MessageType_ResponseSkycoinSignMessage, &messages.ResponseSkycoinSignMessage{
+		SignedMessage: proto.String(base58.Encode(sig[:])),
+	})
+}
+
+func checkMessageSignature(req *messages.SkycoinCheckMessageSignature) wire.Message {
+	addr, err := cipher.DecodeBase58Address(req.GetAddress())
+	if err != nil {
+		return failure(messages.FailureType_Failure_DataError, err.Error())
+	}
+
+	b, err := base58.Decode(req.GetSignature())
+	if err != nil {
+		return failure(messages.FailureType_Failure_DataError, err.Error())
+	}
+	sig, err := cipher.NewSig(b)
+	if err != nil {
+		return failure(messages.FailureType_Failure_DataError, err.Error())
+	}
+
+	if err := cipher.VerifyAddressSignedHash(addr, sig, cipher.SumSHA256([]byte(req.GetMessage()))); err != nil {
+		return failure(messages.FailureType_Failure_InvalidSignature, "Invalid signature")
+	}
+
+	return success(addr.String())
+}
+
+func (s *Simulator) transactionSign(req *messages.TransactionSign) wire.Message {
+	inputs := make([]cipher.SHA256, len(req.TransactionIn))
+	for i, in := range req.TransactionIn {
+		h, err := cipher.SHA256FromHex(in.GetHashIn())
+		if err != nil {
+			return failure(messages.FailureType_Failure_DataError, fmt.Sprintf("input %d: %v", i, err))
+		}
+		inputs[i] = h
+	}
+
+	outputs := make([]transaction.Output, len(req.TransactionOut))
+	for i, out := range req.TransactionOut {
+		addr, err := cipher.DecodeBase58Address(out.GetAddress())
+		if err != nil {
+			return failure(messages.FailureType_Failure_DataError, fmt.Sprintf("output %d: %v", i, err))
+		}
+		outputs[i] = transaction.Output{
+			Address: addr,
+			Coins:   out.GetCoin(),
+			Hours:   out.GetHour(),
+		}
+	}
+
+	innerHash := transaction.HashInner(inputs, outputs)
+	passphrase := s.sessionPassphrase()
+
+	signatures := make([]string, len(inputs))
+	for i, in := range req.TransactionIn {
+		keys, err := s.keys(passphrase, int(in.GetIndex()), 1)
+		if err != nil {
+			return failure(messages.FailureType_Failure_ProcessError, err.Error())
+		}
+
+		sig, err := cipher.SignHash(transaction.SignatureHash(innerHash, inputs[i]), keys[0])
+		if err != nil {
+			return failure(messages.FailureType_Failure_ProcessError, err.Error())
+		}
+		signatures[i] = sig.Hex()
+	}
+
+	return newMessage(messages.MessageType_MessageType_ResponseTransactionSign, &messages.ResponseTransactionSign{
+		Signatures: signatures,
+		Finished:   proto.Bool(true),
+	})
+}
+
+func requiresSeed(kind messages.MessageType) bool {
+	switch kind {
+	case messages.MessageType_MessageType_SkycoinAddress,
+		messages.MessageType_MessageType_SkycoinSignMessage,
+		messages.MessageType_MessageType_TransactionSign,
+		messages.MessageType_MessageType_BackupDevice:
+		return true
+	}
+	return false
+}
+
+func requiresPin(kind messages.MessageType) bool {
+	switch kind {
+	case messages.MessageType_MessageType_SkycoinAddress,
+		messages.MessageType_MessageType_SkycoinSignMessage,
+		messages.MessageType_MessageType_TransactionSign,
+		messages.MessageType_MessageType_ApplySettings,
+		messages.MessageType_MessageType_ChangePin,
+		messages.MessageType_MessageType_BackupDevice:
+		return true
+	}
+	return false
+}
+
+func requiresPassphrase(kind messages.MessageType) bool {
+	switch kind {
+	case messages.MessageType_MessageType_SkycoinAddress,
+		messages.MessageType_MessageType_SkycoinSignMessage,
+		messages.MessageType_MessageType_TransactionSign:
+		return true
+	}
+	return false
+}
+
+// newRequestMessage returns an empty message for the request kinds the simulator understands
+func newRequestMessage(kind messages.MessageType) (proto.Message, error) {
+	switch kind {
+	case messages.MessageType_MessageType_SkycoinAddress:
+		return &messages.SkycoinAddress{}, nil
+	case messages.MessageType_MessageType_ApplySettings:
+		return &messages.ApplySettings{}, nil
+	case messages.MessageType_MessageType_SetMnemonic:
+		return &messages.SetMnemonic{}, nil
+	case messages.MessageType_MessageType_GenerateMnemonic:
+		return &messages.GenerateMnemonic{}, nil
+	case messages.MessageType_MessageType_WipeDevice:
+		return &messages.WipeDevice{}, nil
+	case messages.MessageType_MessageType_ChangePin:
+		return &messages.ChangePin{}, nil
+	case messages.MessageType_MessageType_SkycoinSignMessage:
+		return &messages.SkycoinSignMessage{}, nil
+	case messages.MessageType_MessageType_SkycoinCheckMessageSignature:
+		return &messages.SkycoinCheckMessageSignature{}, nil
+	case messages.MessageType_MessageType_TransactionSign:
+		return &messages.TransactionSign{}, nil
+	default:
+		return nil, fmt.Errorf("%s is not supported by the simulator", kind)
+	}
+}
+
+// unmarshalRequest decodes a request payload. makeSkyWalletMessage overwrites the first payload
+// byte with '\n', the key of a length-delimited field 1. When field 1 of the message is a varint
+// the original key is restored before decoding.
+func unmarshalRequest(data []byte, pb proto.Message) error {
+	if len(data) > 0 && data[0] == '\n' && firstFieldIsVarint(pb) {
+		fixed := make([]byte, len(data))
+		copy(fixed, data)
+		fixed[0] = 1<<3 | 0 // field 1, varint
+		data = fixed
+	}
+	return proto.Unmarshal(data, pb)
+}
+
+// firstFieldIsVarint reports whether the protobuf field number 1 of pb is varint encoded
+func firstFieldIsVarint(pb proto.Message) bool {
+	t := reflect.TypeOf(pb).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		parts := strings.Split(t.Field(i).Tag.Get("protobuf"), ",")
+		if len(parts) < 2 {
+			continue
+		}
+		if n, err := strconv.Atoi(parts[1]); err == nil && n == 1 {
+			return parts[0] == "varint"
+		}
+	}
+	return false
+}
+
+func newMessage(kind messages.MessageType, pb proto.Message) wire.Message {
+	data, err := proto.Marshal(pb)
+	if err != nil {
+		// only happens for messages with missing required fields, which would be a simulator bug
+		panic(err)
+	}
+	return wire.Message{
+		Kind: uint16(kind),
+		Data: data,
+	}
+}
+
+func success(msg string) wire.Message {
+	return newMessage(messages.MessageType_MessageType_Success, &messages.Success{
+		Message: proto.String(msg),
+	})
+}
+
+func failure(code messages.FailureType, msg string) wire.Message {
+	return newMessage(messages.MessageType_MessageType_Failure, &messages.Failure{
+		Code:    code.Enum(),
+		Message: proto.String(msg),
+	})
+}
+
+func pinMatrixRequest() wire.Message {
+	return newMessage(messages.MessageType_MessageType_PinMatrixRequest, &messages.PinMatrixRequest{})
+}
+
+// simulatedConn is a connection to a Simulator, framing requests and answers in 64 byte packets
+type simulatedConn struct {
+	sim *Simulator
+
+	in             messageAssembler
+	out            [][PacketLen]byte
+	awaitingButton bool
+	press          *ButtonAction
+	closed         bool
+}
+
+// Write accepts a single wire packet, or a button press written by Device.SimulateButtonPress
+func (c *simulatedConn) Write(p []byte) (int, error) {
+	if c.closed {
+		return 0, ErrClosed
+	}
+
+	if isButtonPress(p) {
+		press := ButtonConfirm
+		if deviceWallet.ButtonType(p[len(emulatorButtonPrefix)]) == deviceWallet.ButtonLeft {
+			press = ButtonCancel
+		}
+		c.press = &press
+		return len(p), nil
+	}
+
+	msg, ok, err := c.in.add(p)
+	if err != nil {
+		return 0, err
+	}
+
+	if ok {
+		kind := messages.MessageType(msg.Kind)
+		if kind == messages.MessageType_MessageType_ButtonAck {
+			c.awaitingButton = true
+			c.press = nil
+		} else {
+			c.out = append(c.out, packets(c.sim.handle(kind, msg.Data))...)
+		}
+	}
+
+	return len(p), nil
+}
+
+// Read returns the next packet of the device answer
+func (c *simulatedConn) Read(p []byte) (int, error) {
+	if c.closed {
+		return 0, ErrClosed
+	}
+
+	if len(c.out) == 0 && c.awaitingButton {
+		c.awaitingButton = false
+		c.out = packets(c.sim.pressButton(c.press))
+		c.press = nil
+	}
+
+	if len(c.out) == 0 {
+		return 0, ErrNoResponse
+	}
+
+	n := copy(p, c.out[0][:])
+	c.out = c.out[1:]
+	return n, nil
+}
+
+// Close closes the connection, the simulator state is kept
+func (c *simulatedConn) Close() error {
+	c.closed = true
+	return nil
+}
@@ -0,0 +1,266 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/base58"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+const testMnemonic = "cloud flower upset remain green metal below cup stem infant art thank"
+
+func expectKind(t *testing.T, msg wire.Message, err error, kind messages.MessageType) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Kind != uint16(kind) {
+		reason, _ := deviceWallet.DecodeFailMsg(msg)
+		t.Fatalf("got %s (%s), want %s", messages.MessageType(msg.Kind), reason, kind)
+	}
+}
+
+func TestSimulatorAddressGen(t *testing.T) {
+	dev, sim := NewSimulatedDevice(SimulatorConfig{Mnemonic: testMnemonic})
+
+	msg, err := dev.AddressGen(3, 2, false)
+	expectKind(t, msg, err, messages.MessageType_MessageType_ResponseSkycoinAddress)
+
+	addresses, err := deviceWallet.DecodeResponseSkycoinAddress(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := cipher.GenerateDeterministicKeyPairs([]byte(testMnemonic), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses) != 3 {
+		t.Fatalf("got %d addresses, want 3", len(addresses))
+	}
+	for i, a := range addresses {
+		if want := cipher.MustAddressFromSecKey(keys[i+2]).String(); a != want {
+			t.Errorf("address %d: got %s, want %s", i, a, want)
+		}
+	}
+
+	expected, err := sim.Addresses("", 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range expected {
+		if expected[i] != addresses[i] {
+			t.Errorf("Addresses %d: got %s, want %s", i, expected[i], addresses[i])
+		}
+	}
+
+	msg, err = dev.AddressGen(DefaultSimulatorMaxAddresses+1, 0, false)
+	expectKind(t, msg, err, messages.MessageType_MessageType_Failure)
+}
+
+func TestSimulatorNotInitialized(t *testing.T) {
+	dev, _ := NewSimulatedDevice(SimulatorConfig{})
+
+	msg, err := dev.AddressGen(1, 0, false)
+	expectKind(t, msg, err, messages.MessageType_MessageType_Failure)
+
+	msg, err = dev.GetFeatures()
+	expectKind(t, msg, err, messages.MessageType_MessageType_Features)
+}
+
+func TestSimulatorPinAndButton(t *testing.T) {
+	dev, sim := NewSimulatedDevice(SimulatorConfig{
+		Mnemonic: testMnemonic,
+		PIN:      "1234",
+	})
+
+	msg, err := dev.AddressGen(1, 0, true)
+	expectKind(t, msg, err, messages.MessageType_MessageType_PinMatrixRequest)
+
+	msg, err = dev.PinMatrixAck("4321")
+	expectKind(t, msg, err, messages.MessageType_MessageType_Failure)
+
+	msg, err = dev.AddressGen(1, 0, true)
+	expectKind(t, msg, err, messages.MessageType_MessageType_PinMatrixRequest)
+
+	msg, err = dev.PinMatrixAck("1234")
+	expectKind(t, msg, err, messages.MessageType_MessageType_ButtonRequest)
+
+	msg, err = dev.ButtonAck()
+	expectKind(t, msg, err, messages.MessageType_MessageType_ResponseSkycoinAddress)
+
+	// the PIN is cached for the session, a simulated left button press cancels
+	if err := dev.SetAutoPressButton(true, deviceWallet.ButtonLeft); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = dev.AddressGen(1, 0, true)
+	expectKind(t, msg, err, messages.MessageType_MessageType_ButtonRequest)
+	msg, err = dev.ButtonAck()
+	expectKind(t, msg, err, messages.MessageType_MessageType_Failure)
+
+	if err := dev.SetAutoPressButton(false, deviceWallet.ButtonRight); err != nil {
+		t.Fatal(err)
+	}
+	sim.SetButtonAction(ButtonCancel)
+	msg, err = dev.ApplySettings(false, "label")
+	expectKind(t, msg, err, messages.MessageType_MessageType_ButtonRequest)
+	msg, err = dev.ButtonAck()
+	expectKind(t, msg, err, messages.MessageType_MessageType_Failure)
+}
+
+func TestSimulatorPassphrase(t *testing.T) {
+	dev, sim := NewSimulatedDevice(SimulatorConfig{
+		Mnemonic:      testMnemonic,
+		UsePassphrase: true,
+	})
+
+	msg, err := dev.AddressGen(1, 0, false)
+	expectKind(t, msg, err, messages.MessageType_MessageType_PassphraseRequest)
+
+	msg, err = dev.PassphraseAck("secret")
+	expectKind(t, msg, err, messages.MessageType_MessageType_ResponseSkycoinAddress)
+
+	addresses, err := deviceWallet.DecodeResponseSkycoinAddress(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hidden, err := sim.Addresses("secret", 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standard, err := sim.Addresses("", 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addresses[0] != hidden[0] || addresses[0] == standard[0] {
+		t.Fatalf("passphrase not applied: got %s, hidden %s, standard %s", addresses[0], hidden[0], standard[0])
+	}
+}
+
+func TestSimulatorSignMessage(t *testing.T) {
+	dev, sim := NewSimulatedDevice(SimulatorConfig{Mnemonic: testMnemonic})
+
+	msg, err := dev.SignMessage(1, "hello")
+	expectKind(t, msg, err, messages.MessageType_MessageType_ResponseSkycoinSignMessage)
+
+	signature, err := deviceWallet.DecodeResponseSkycoinSignMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addresses, err := sim.Addresses("", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := cipher.MustDecodeBase58Address(addresses[0])
+
+	b, err := base58.Decode(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cipher.VerifyAddressSignedHash(addr, cipher.MustNewSig(b), cipher.SumSHA256([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Device.CheckMessageSignature can't frame messages of this size, the request is handled directly
+	for _, tc := range []struct {
+		message string
+		kind    messages.MessageType
+	}{
+		{"hello", messages.MessageType_MessageType_Success},
+		{"tampered", messages.MessageType_MessageType_Failure},
+	} {
+		data, err := proto.Marshal(&messages.SkycoinCheckMessageSignature{
+			Address:   newString(addresses[0]),
+			Message:   newString(tc.message),
+			Signature: newString(signature),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg = sim.handle(messages.MessageType_MessageType_SkycoinCheckMessageSignature, data)
+		expectKind(t, msg, nil, tc.kind)
+	}
+}
+
+func TestSimulatorTransactionSign(t *testing.T) {
+	dev, sim := NewSimulatedDevice(SimulatorConfig{Mnemonic: testMnemonic})
+
+	addresses, err := sim.Addresses("", 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := []cipher.SHA256{
+		cipher.SumSHA256([]byte("input 0")),
+		cipher.SumSHA256([]byte("input 1")),
+	}
+	inputs := []*messages.SkycoinTransactionInput{
+		{HashIn: newString(hashes[0].Hex()), Index: newUint32(0)},
+		{HashIn: newString(hashes[1].Hex()), Index: newUint32(1)},
+	}
+	outputs := []*messages.SkycoinTransactionOutput{
+		{Address: newString(addresses[0]), Coin: newUint64(1e6), Hour: newUint64(2)},
+		{Address: newString(addresses[1]), Coin: newUint64(3e6), Hour: newUint64(4), AddressIndex: newUint32(1)},
+	}
+
+	// only the output that is not change is confirmed
+	msg, err := dev.TransactionSign(inputs, outputs)
+	expectKind(t, msg, err, messages.MessageType_MessageType_ButtonRequest)
+	msg, err = dev.ButtonAck()
+	expectKind(t, msg, err, messages.MessageType_MessageType_ResponseTransactionSign)
+
+	signatures, err := deviceWallet.DecodeResponseTransactionSign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	innerHash := transaction.HashInner(hashes, []transaction.Output{
+		{Address: cipher.MustDecodeBase58Address(addresses[0]), Coins: 1e6, Hours: 2},
+		{Address: cipher.MustDecodeBase58Address(addresses[1]), Coins: 3e6, Hours: 4},
+	})
+	for i, s := range signatures {
+		sig, err := cipher.SigFromHex(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := cipher.MustDecodeBase58Address(addresses[i])
+		if err := cipher.VerifyAddressSignedHash(addr, sig, transaction.SignatureHash(innerHash, hashes[i])); err != nil {
+			t.Errorf("signature %d: %v", i, err)
+		}
+	}
+}
+
+func TestSimulatorChangePin(t *testing.T) {
+	dev, _ := NewSimulatedDevice(SimulatorConfig{Mnemonic: testMnemonic})
+
+	// ChangePin acknowledges the ButtonRequest itself
+	msg, err := dev.ChangePin()
+	expectKind(t, msg, err, messages.MessageType_MessageType_PinMatrixRequest)
+	msg, err = dev.PinMatrixAck("1111")
+	expectKind(t, msg, err, messages.MessageType_MessageType_PinMatrixRequest)
+	msg, err = dev.PinMatrixAck("2222")
+	expectKind(t, msg, err, messages.MessageType_MessageType_Failure)
+
+	msg, err = dev.GetFeatures()
+	expectKind(t, msg, err, messages.MessageType_MessageType_Features)
+}
+
+func newString(s string) *string {
+	return &s
+}
+
+func newUint32(n uint32) *uint32 {
+	return &n
+}
+
+func newUint64(n uint64) *uint64 {
+	return &n
+}
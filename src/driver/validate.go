@@ -0,0 +1,184 @@
+/*
+Package driver implements DeviceDriver decorators and fake devices for the hardware wallet daemon.
+*/
+package driver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+)
+
+const (
+	// PacketLen is the size of a single wire packet
+	PacketLen = 64
+	// headerLen is the size of the message header in the first packet: "?##", kind and size
+	headerLen = 9
+
+	// DefaultMaxMessageSize is the largest message payload accepted from a device by default
+	DefaultMaxMessageSize = 1024 * 1024
+)
+
+var (
+	// ErrMessageTooLarge is returned when a message header announces a payload larger than the limit
+	ErrMessageTooLarge = errors.New("wire message exceeds the maximum message size")
+	// ErrUnknownMessageKind is returned when a message header has a kind that is not a known MessageType
+	ErrUnknownMessageKind = errors.New("unknown wire message kind")
+	// ErrShortPacket is returned when a read returns less than a full packet
+	ErrShortPacket = errors.New("short wire packet")
+)
+
+// InvalidPayloadError is returned when a message payload fails wire.Validate
+type InvalidPayloadError struct {
+	Kind messages.MessageType
+	Err  error
+}
+
+func (e InvalidPayloadError) Error() string {
+	return fmt.Sprintf("invalid %s payload: %v", e.Kind, e.Err)
+}
+
+// ReadMessage reads a single message from r, one packet per Read call as wire.Message.ReadFrom does.
+// Unlike ReadFrom it rejects unknown message kinds and payloads larger than maxSize before
+// allocating, and validates the payload with wire.Validate.
+func ReadMessage(r io.Reader, maxSize uint32) (wire.Message, error) {
+	msg, _, err := readMessage(r, maxSize)
+	return msg, err
+}
+
+// readMessage reads and validates a message, returning it along with the raw packets it was read from
+func readMessage(r io.Reader, maxSize uint32) (wire.Message, [][PacketLen]byte, error) {
+	var first [PacketLen]byte
+	if err := readPacket(r, &first); err != nil {
+		return wire.Message{}, nil, err
+	}
+
+	kind, size, err := ParseHeader(first, maxSize)
+	if err != nil {
+		return wire.Message{}, nil, err
+	}
+
+	packets := [][PacketLen]byte{first}
+	data := make([]byte, 0, size)
+	data = append(data, first[headerLen:]...)
+
+	for uint32(len(data)) < size {
+		var p [PacketLen]byte
+		if err := readPacket(r, &p); err != nil {
+			return wire.Message{}, nil, err
+		}
+		if p[0] != '?' {
+			return wire.Message{}, nil, wire.ErrMalformedMessage
+		}
+		packets = append(packets, p)
+		data = append(data, p[1:]...)
+	}
+	data = data[:size]
+
+	if err := wire.Validate(data); err != nil {
+		return wire.Message{}, nil, InvalidPayloadError{
+			Kind: messages.MessageType(kind),
+			Err:  err,
+		}
+	}
+
+	return wire.Message{
+		Kind: kind,
+		Data: data,
+	}, packets, nil
+}
+
+// ParseHeader parses and checks the header of the first packet of a message
+func ParseHeader(p [PacketLen]byte, maxSize uint32) (uint16, uint32, error) {
+	if p[0] != '?' || p[1] != '#' || p[2] != '#' {
+		return 0, 0, wire.ErrMalformedMessage
+	}
+
+	kind := binary.BigEndian.Uint16(p[3:])
+	size := binary.BigEndian.Uint32(p[5:])
+
+	if _, ok := messages.MessageType_name[int32(kind)]; !ok {
+		return 0, 0, ErrUnknownMessageKind
+	}
+
+	if size > maxSize {
+		return 0, 0, ErrMessageTooLarge
+	}
+
+	return kind, size, nil
+}
+
+func readPacket(r io.Reader, p *[PacketLen]byte) error {
+	n, err := r.Read(p[:])
+	if err != nil {
+		return err
+	}
+	if n != PacketLen {
+		return ErrShortPacket
+	}
+	return nil
+}
+
+// validatingDevice validates every message read from the device before handing its packets out.
+// Reads from the caller are served one packet at a time so that wire.Message.ReadFrom keeps working.
+type validatingDevice struct {
+	io.ReadWriteCloser
+	maxSize uint32
+	pending [][PacketLen]byte
+}
+
+// Read returns the next packet of a validated message
+func (d *validatingDevice) Read(b []byte) (int, error) {
+	if len(b) < PacketLen {
+		return 0, io.ErrShortBuffer
+	}
+
+	if len(d.pending) == 0 {
+		_, packets, err := readMessage(d.ReadWriteCloser, d.maxSize)
+		if err != nil {
+			return 0, err
+		}
+		d.pending = packets
+	}
+
+	n := copy(b, d.pending[0][:])
+	d.pending = d.pending[1:]
+	return n, nil
+}
+
+// ValidatingDriver wraps a DeviceDriver so that every message read from its devices is size
+// checked and validated, including reads that bypass SendToDevice such as ButtonAck
+type ValidatingDriver struct {
+	deviceWallet.DeviceDriver
+	MaxMessageSize uint32
+}
+
+// NewValidatingDriver creates a ValidatingDriver, a zero maxSize uses DefaultMaxMessageSize
+func NewValidatingDriver(drv deviceWallet.DeviceDriver, maxSize uint32) *ValidatingDriver {
+	if maxSize == 0 {
+		maxSize = DefaultMaxMessageSize
+	}
+
+	return &ValidatingDriver{
+		DeviceDriver:   drv,
+		MaxMessageSize: maxSize,
+	}
+}
+
+// GetDevice returns a device instance whose reads are validated
+func (drv *ValidatingDriver) GetDevice() (io.ReadWriteCloser, error) {
+	dev, err := drv.DeviceDriver.GetDevice()
+	if err != nil || dev == nil {
+		return dev, err
+	}
+
+	return &validatingDevice{
+		ReadWriteCloser: dev,
+		maxSize:         drv.MaxMessageSize,
+	}, nil
+}
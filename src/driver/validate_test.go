@@ -0,0 +1,221 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+)
+
+func encodeMessage(t testing.TB, kind messages.MessageType, pb proto.Message) []byte {
+	data, err := proto.Marshal(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := wire.Message{
+		Kind: uint16(kind),
+		Data: data,
+	}
+
+	var buf bytes.Buffer
+	if _, err := msg.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func header(kind uint16, size uint32) []byte {
+	p := make([]byte, PacketLen)
+	p[0], p[1], p[2] = '?', '#', '#'
+	binary.BigEndian.PutUint16(p[3:], kind)
+	binary.BigEndian.PutUint32(p[5:], size)
+	return p
+}
+
+func TestReadMessage(t *testing.T) {
+	longAddresses := &messages.ResponseSkycoinAddress{}
+	for i := 0; i < 10; i++ {
+		longAddresses.Addresses = append(longAddresses.Addresses, "2EU3JbveHdkxW6z5tdhbbB2kRAWvXC2pLzw")
+	}
+
+	malformed := header(uint16(messages.MessageType_MessageType_Success), 3)
+	// field 1 with wire type 1 (64-bit) is rejected by wire.Validate
+	copy(malformed[headerLen:], []byte{0x09, 0x01, 0x02})
+
+	badContinuation := encodeMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, longAddresses)
+	badContinuation[PacketLen] = 'x'
+
+	cases := []struct {
+		name    string
+		input   []byte
+		maxSize uint32
+		kind    messages.MessageType
+		err     error
+	}{
+		{
+			name:    "single packet",
+			input:   encodeMessage(t, messages.MessageType_MessageType_Success, &messages.Success{Message: proto.String("ok")}),
+			maxSize: DefaultMaxMessageSize,
+			kind:    messages.MessageType_MessageType_Success,
+		},
+		{
+			name:    "multiple packets",
+			input:   encodeMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, longAddresses),
+			maxSize: DefaultMaxMessageSize,
+			kind:    messages.MessageType_MessageType_ResponseSkycoinAddress,
+		},
+		{
+			name:    "too large",
+			input:   header(uint16(messages.MessageType_MessageType_Success), 0xFFFFFFFF),
+			maxSize: DefaultMaxMessageSize,
+			err:     ErrMessageTooLarge,
+		},
+		{
+			name:    "over configured limit",
+			input:   encodeMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, longAddresses),
+			maxSize: 100,
+			err:     ErrMessageTooLarge,
+		},
+		{
+			name:    "unknown kind",
+			input:   header(0xFFFF, 0),
+			maxSize: DefaultMaxMessageSize,
+			err:     ErrUnknownMessageKind,
+		},
+		{
+			name:    "bad magic",
+			input:   append([]byte("?#!"), make([]byte, PacketLen-3)...),
+			maxSize: DefaultMaxMessageSize,
+			err:     wire.ErrMalformedMessage,
+		},
+		{
+			name:    "bad continuation marker",
+			input:   badContinuation,
+			maxSize: DefaultMaxMessageSize,
+			err:     wire.ErrMalformedMessage,
+		},
+		{
+			name:    "short packet",
+			input:   header(uint16(messages.MessageType_MessageType_Success), 0)[:10],
+			maxSize: DefaultMaxMessageSize,
+			err:     ErrShortPacket,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, err := ReadMessage(bytes.NewReader(tc.input), tc.maxSize)
+			if tc.err != nil {
+				if err != tc.err {
+					t.Fatalf("expected error %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if msg.Kind != uint16(tc.kind) {
+				t.Fatalf("expected kind %s, got %s", tc.kind, messages.MessageType(msg.Kind))
+			}
+		})
+	}
+
+	msg, err := ReadMessage(bytes.NewReader(malformed), DefaultMaxMessageSize)
+	if err == nil {
+		t.Fatalf("expected malformed protobuf to be rejected, got %v", msg)
+	}
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Write(b []byte) (int, error) { return len(b), nil }
+func (nopCloser) Close() error                { return nil }
+
+func TestValidatingDeviceServesWireReadFrom(t *testing.T) {
+	longAddresses := &messages.ResponseSkycoinAddress{}
+	for i := 0; i < 5; i++ {
+		longAddresses.Addresses = append(longAddresses.Addresses, "2EU3JbveHdkxW6z5tdhbbB2kRAWvXC2pLzw")
+	}
+	input := encodeMessage(t, messages.MessageType_MessageType_ResponseSkycoinAddress, longAddresses)
+
+	dev := &validatingDevice{
+		ReadWriteCloser: nopCloser{bytes.NewReader(input)},
+		maxSize:         DefaultMaxMessageSize,
+	}
+
+	var msg wire.Message
+	if _, err := msg.ReadFrom(dev); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp messages.ResponseSkycoinAddress
+	if err := proto.Unmarshal(msg.Data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Addresses) != 5 {
+		t.Fatalf("expected 5 addresses, got %d", len(resp.Addresses))
+	}
+}
+
+func FuzzReadMessage(f *testing.F) {
+	f.Add(encodeMessage(f, messages.MessageType_MessageType_Success, &messages.Success{Message: proto.String("ok")}))
+	f.Add(encodeMessage(f, messages.MessageType_MessageType_ResponseSkycoinAddress, &messages.ResponseSkycoinAddress{
+		Addresses: []string{"2EU3JbveHdkxW6z5tdhbbB2kRAWvXC2pLzw", "zC8GAQGQBfwk7vtTxVoRG7iMperHNuyYPs"},
+	}))
+	f.Add(header(uint16(messages.MessageType_MessageType_Failure), 0xFFFFFFFF))
+	f.Add([]byte("?##"))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		const maxSize = 4096
+
+		msg, err := ReadMessage(bytes.NewReader(b), maxSize)
+		if err != nil {
+			return
+		}
+
+		if len(msg.Data) > maxSize {
+			t.Fatalf("accepted message with %d bytes over the %d limit", len(msg.Data), maxSize)
+		}
+		if _, ok := messages.MessageType_name[int32(msg.Kind)]; !ok {
+			t.Fatalf("accepted unknown message kind %d", msg.Kind)
+		}
+		if err := wire.Validate(msg.Data); err != nil {
+			t.Fatalf("accepted invalid payload: %v", err)
+		}
+	})
+}
+
+func FuzzWireRoundTrip(f *testing.F) {
+	f.Add(uint16(messages.MessageType_MessageType_Success), []byte{0x0a, 0x02, 'o', 'k'})
+	f.Add(uint16(messages.MessageType_MessageType_Features), []byte{})
+
+	f.Fuzz(func(t *testing.T, kind uint16, data []byte) {
+		if _, ok := messages.MessageType_name[int32(kind)]; !ok {
+			return
+		}
+		if wire.Validate(data) != nil {
+			return
+		}
+
+		in := wire.Message{Kind: kind, Data: data}
+		var buf bytes.Buffer
+		if _, err := in.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := ReadMessage(&buf, DefaultMaxMessageSize)
+		if err != nil {
+			t.Fatalf("failed to read back a valid message: %v", err)
+		}
+		if out.Kind != in.Kind || !bytes.Equal(out.Data, in.Data) {
+			t.Fatalf("round trip mismatch: %v != %v", out, in)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+/*
+Package message verifies messages signed by the hardware wallet and implements the armored signed
+message format:
+
+	-----BEGIN SKYCOIN SIGNED MESSAGE-----
+	the message
+	-----BEGIN SKYCOIN SIGNATURE-----
+	Address: 2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv
+	Signature: 3mSCBmuAasG...
+	-----END SKYCOIN SIGNED MESSAGE-----
+
+Message lines starting with a dash are escaped with "- ", as in OpenPGP cleartext signatures.
+*/
+package message
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/base58"
+)
+
+const (
+	beginMessage   = "-----BEGIN SKYCOIN SIGNED MESSAGE-----"
+	beginSignature = "-----BEGIN SKYCOIN SIGNATURE-----"
+	endMessage     = "-----END SKYCOIN SIGNED MESSAGE-----"
+
+	addressHeader   = "Address: "
+	signatureHeader = "Signature: "
+)
+
+// ErrNotArmored is returned when a text is not an armored signed message
+var ErrNotArmored = errors.New("not an armored signed message")
+
+// Signed is a message signed by an address
+type Signed struct {
+	Message string
+	Address string
+	// Signature is the base58 encoded signature of the SHA256 of the message
+	Signature string
+}
+
+// Hash returns the hash the device signs for a message
+func Hash(message string) cipher.SHA256 {
+	return cipher.SumSHA256([]byte(message))
+}
+
+// ParseSignature decodes a base58 or hex encoded signature
+func ParseSignature(signature string) (cipher.Sig, error) {
+	if len(signature) == 2*len(cipher.Sig{}) {
+		if b, err := hex.DecodeString(signature); err == nil {
+			return cipher.NewSig(b)
+		}
+	}
+
+	b, err := base58.Decode(signature)
+	if err != nil {
+		return cipher.Sig{}, fmt.Errorf("invalid signature: %v", err)
+	}
+	return cipher.NewSig(b)
+}
+
+// Verify checks that the signature of the message was made by the address. It returns the
+// address recovered from the signature, which differs from the expected one if the verification fails.
+func (s Signed) Verify() (cipher.Address, error) {
+	addr, err := cipher.DecodeBase58Address(s.Address)
+	if err != nil {
+		return cipher.Address{}, fmt.Errorf("invalid address: %v", err)
+	}
+
+	sig, err := ParseSignature(s.Signature)
+	if err != nil {
+		return cipher.Address{}, err
+	}
+
+	hash := Hash(s.Message)
+	pubKey, err := cipher.PubKeyFromSig(sig, hash)
+	if err != nil {
+		return cipher.Address{}, fmt.Errorf("invalid signature: %v", err)
+	}
+
+	signer := cipher.AddressFromPubKey(pubKey)
+	if signer != addr {
+		return signer, fmt.Errorf("message was signed by %s, not %s", signer, addr)
+	}
+
+	if err := cipher.VerifyAddressSignedHash(addr, sig, hash); err != nil {
+		return signer, fmt.Errorf("invalid signature: %v", err)
+	}
+
+	return signer, nil
+}
+
+// Armor encodes the signed message in the armored format
+func (s Signed) Armor() string {
+	var b strings.Builder
+	b.WriteString(beginMessage + "\n")
+	for _, line := range strings.Split(s.Message, "\n") {
+		if strings.HasPrefix(line, "-") {
+			line = "- " + line
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString(beginSignature + "\n")
+	b.WriteString(addressHeader + s.Address + "\n")
+	b.WriteString(signatureHeader + s.Signature + "\n")
+	b.WriteString(endMessage + "\n")
+	return b.String()
+}
+
+// Dearmor decodes an armored signed message, the text around the armor is ignored
+func Dearmor(armored string) (Signed, error) {
+	lines := strings.Split(strings.Replace(armored, "\r\n", "\n", -1), "\n")
+
+	start := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == beginMessage {
+			start = i + 1
+			break
+		}
+	}
+	if start == -1 {
+		return Signed{}, ErrNotArmored
+	}
+
+	var s Signed
+	var message []string
+	i := start
+	for ; i < len(lines) && strings.TrimRight(lines[i], " \t") != beginSignature; i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "- ") {
+			line = line[2:]
+		} else if strings.HasPrefix(line, "-") {
+			return Signed{}, fmt.Errorf("line %d of the message starts with an unescaped dash", i-start+1)
+		}
+		message = append(message, line)
+	}
+	if i == len(lines) {
+		return Signed{}, errors.New("armored message has no signature")
+	}
+	s.Message = strings.Join(message, "\n")
+
+	for i++; i < len(lines) && strings.TrimSpace(lines[i]) != endMessage; i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, addressHeader):
+			s.Address = strings.TrimSpace(strings.TrimPrefix(line, addressHeader))
+		case strings.HasPrefix(line, signatureHeader):
+			s.Signature = strings.TrimSpace(strings.TrimPrefix(line, signatureHeader))
+		default:
+			return Signed{}, fmt.Errorf("unknown armor header %q", line)
+		}
+	}
+	if i == len(lines) {
+		return Signed{}, errors.New("armored message is not terminated")
+	}
+
+	if s.Address == "" || s.Signature == "" {
+		return Signed{}, errors.New("armored message must have an address and a signature")
+	}
+
+	return s, nil
+}
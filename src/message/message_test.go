@@ -0,0 +1,90 @@
+package message
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/base58"
+)
+
+func newSigned(t *testing.T, text string) (Signed, cipher.SecKey) {
+	_, sk, err := cipher.GenerateDeterministicKeyPair([]byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := cipher.MustSignHash(Hash(text), sk)
+	return Signed{
+		Message:   text,
+		Address:   cipher.MustAddressFromSecKey(sk).String(),
+		Signature: base58.Encode(sig[:]),
+	}, sk
+}
+
+func TestVerify(t *testing.T) {
+	s, sk := newSigned(t, "hello")
+
+	if _, err := s.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	sig := cipher.MustSignHash(Hash("hello"), sk)
+	hexSigned := s
+	hexSigned.Signature = sig.Hex()
+	if _, err := hexSigned.Verify(); err != nil {
+		t.Fatalf("hex signature: %v", err)
+	}
+
+	tampered := s
+	tampered.Message = "hello!"
+	if signer, err := tampered.Verify(); err == nil || signer.String() == s.Address {
+		t.Fatalf("tampered message verified, signer %s", signer)
+	}
+
+	invalid := s
+	invalid.Signature = "signature"
+	if _, err := invalid.Verify(); err == nil {
+		t.Fatal("invalid signature verified")
+	}
+}
+
+func TestArmor(t *testing.T) {
+	s, _ := newSigned(t, "first line\n-----BEGIN SKYCOIN SIGNATURE-----\n- dashed\n")
+
+	armored := s.Armor()
+	if !strings.HasPrefix(armored, beginMessage+"\nfirst line\n- -----BEGIN SKYCOIN SIGNATURE-----\n- - dashed\n\n"+beginSignature+"\n") {
+		t.Fatalf("unexpected armor:\n%s", armored)
+	}
+
+	// text around the armor and CRLF line endings are accepted
+	d, err := Dearmor("signed by me:\r\n" + strings.Replace(armored, "\n", "\r\n", -1) + "bye")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != s {
+		t.Fatalf("expected %+v, got %+v", s, d)
+	}
+	if _, err := d.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		armored string
+	}{
+		{"not armored", "hello"},
+		{"no signature", beginMessage + "\nhello\n"},
+		{"not terminated", beginMessage + "\nhello\n" + beginSignature + "\nAddress: a\nSignature: b\n"},
+		{"unescaped dash", beginMessage + "\n-hello\n" + beginSignature + "\nAddress: a\nSignature: b\n" + endMessage},
+		{"missing address", beginMessage + "\nhello\n" + beginSignature + "\nSignature: b\n" + endMessage},
+		{"unknown header", beginMessage + "\nhello\n" + beginSignature + "\nComment: c\n" + endMessage},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Dearmor(tc.armored); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
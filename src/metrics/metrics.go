@@ -0,0 +1,358 @@
+/*
+Package metrics implements counters and histograms exposed in the Prometheus text format.
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// ContentType is the content type of the Prometheus text exposition format
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	// DefBuckets are the default histogram buckets, in seconds
+	DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// InteractionBuckets are histogram buckets for waits that involve a user, in seconds
+	InteractionBuckets = []float64{.5, 1, 2, 5, 10, 20, 30, 60, 120, 300}
+)
+
+// Collector is a metric that can be written in the text exposition format
+type Collector interface {
+	Name() string
+	Write(w io.Writer) error
+}
+
+// Registry holds a set of collectors
+type Registry struct {
+	lock       sync.RWMutex
+	collectors map[string]Collector
+}
+
+// NewRegistry creates a Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]Collector),
+	}
+}
+
+// DefaultRegistry is the registry used by the package level constructors
+var DefaultRegistry = NewRegistry()
+
+// Register adds a collector to the registry, it panics if a collector with the same name exists
+func (r *Registry) Register(c Collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.collectors[c.Name()]; ok {
+		panic(fmt.Sprintf("metrics: collector %s already registered", c.Name()))
+	}
+	r.collectors[c.Name()] = c
+}
+
+// Write writes all collectors sorted by name
+func (r *Registry) Write(w io.Writer) error {
+	r.lock.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]Collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.lock.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		if err := c.Write(bw); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry in the text exposition format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		if err := r.Write(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Handler serves the DefaultRegistry
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+// metric holds the name, help and label names shared by all vector types
+type metric struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (m metric) Name() string {
+	return m.name
+}
+
+func (m metric) key(values []string) string {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", m.name, len(m.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (m metric) writeHeader(w io.Writer, typ string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, escapeHelp(m.help), m.name, typ)
+	return err
+}
+
+// labelString formats label pairs, extra is appended after the metric's own labels
+func (m metric) labelString(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, l := range m.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l, escapeLabel(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a set of counters partitioned by label values
+type CounterVec struct {
+	metric
+	lock   sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+// NewCounterVec creates a CounterVec and registers it with the DefaultRegistry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		metric: metric{
+			name:   name,
+			help:   help,
+			labels: labels,
+		},
+		values: make(map[string]*counterValue),
+	}
+	DefaultRegistry.Register(c)
+	return c
+}
+
+// Inc increments the counter for the given label values
+func (c *CounterVec) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add adds v to the counter for the given label values
+func (c *CounterVec) Add(v float64, labels ...string) {
+	if v < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+
+	k := c.key(labels)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cv, ok := c.values[k]
+	if !ok {
+		cv = &counterValue{labels: append([]string(nil), labels...)}
+		c.values[k] = cv
+	}
+	cv.value += v
+}
+
+// Value returns the counter for the given label values
+func (c *CounterVec) Value(labels ...string) float64 {
+	k := c.key(labels)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cv, ok := c.values[k]; ok {
+		return cv.value
+	}
+	return 0
+}
+
+// Write writes the counters in the text exposition format
+func (c *CounterVec) Write(w io.Writer) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.writeHeader(w, "counter"); err != nil {
+		return err
+	}
+
+	for _, k := range sortedKeys(c.values) {
+		cv := c.values[k]
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(cv.labels), formatFloat(cv.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec is a set of histograms partitioned by label values
+type HistogramVec struct {
+	metric
+	lock    sync.Mutex
+	buckets []float64
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates a HistogramVec and registers it with the DefaultRegistry
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+
+	h := &HistogramVec{
+		metric: metric{
+			name:   name,
+			help:   help,
+			labels: labels,
+		},
+		buckets: b,
+		values:  make(map[string]*histogramValue),
+	}
+	DefaultRegistry.Register(h)
+	return h
+}
+
+// Observe adds an observation for the given label values
+func (h *HistogramVec) Observe(v float64, labels ...string) {
+	k := h.key(labels)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	hv, ok := h.values[k]
+	if !ok {
+		hv = &histogramValue{
+			labels: append([]string(nil), labels...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[k] = hv
+	}
+
+	for i, b := range h.buckets {
+		if v <= b {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+// Count returns the number of observations for the given label values
+func (h *HistogramVec) Count(labels ...string) uint64 {
+	k := h.key(labels)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if hv, ok := h.values[k]; ok {
+		return hv.count
+	}
+	return 0
+}
+
+// Write writes the histograms in the text exposition format
+func (h *HistogramVec) Write(w io.Writer) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+
+	for _, k := range sortedKeys(h.values) {
+		hv := h.values[k]
+		for i, b := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(hv.labels, "le", formatFloat(b)), hv.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(hv.labels, "le", "+Inf"), hv.count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(hv.labels), formatFloat(hv.sum)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(hv.labels), hv.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch v := m.(type) {
+	case map[string]*counterValue:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]*histogramValue:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// escapeLabel escapes backslashes, quotes and newlines, the only escapes the exposition format
+// has for label values. Other characters are written as they are.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCounterVecWrite(t *testing.T) {
+	r := NewRegistry()
+	c := &CounterVec{
+		metric: metric{
+			name:   "test_requests_total",
+			help:   "Requests with a \\ and a\nnewline.",
+			labels: []string{"endpoint", "status"},
+		},
+		values: make(map[string]*counterValue),
+	}
+	r.Register(c)
+
+	c.Inc("/b", "200")
+	c.Add(2.5, "/a", "500")
+	c.Inc("/b", "200")
+	c.Inc("quote\" back\\slash\nnewline\ttab é", "200")
+
+	if v := c.Value("/b", "200"); v != 2 {
+		t.Fatalf("expected 2, got %v", v)
+	}
+	if v := c.Value("/c", "200"); v != 0 {
+		t.Fatalf("expected 0 for an unused label set, got %v", v)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP test_requests_total Requests with a \\ and a\nnewline.
+# TYPE test_requests_total counter
+test_requests_total{endpoint="/a",status="500"} 2.5
+test_requests_total{endpoint="/b",status="200"} 2
+test_requests_total{endpoint="quote\" back\\slash\nnewline` + "\t" + `tab é",status="200"} 1
+`
+	if buf.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestHistogramVecWrite(t *testing.T) {
+	r := NewRegistry()
+	h := &HistogramVec{
+		metric: metric{
+			name:   "test_duration_seconds",
+			help:   "Durations.",
+			labels: []string{"kind"},
+		},
+		buckets: []float64{0.1, 1},
+		values:  make(map[string]*histogramValue),
+	}
+	r.Register(h)
+
+	h.Observe(0.05, "a")
+	h.Observe(0.5, "a")
+	h.Observe(3, "a")
+
+	if n := h.Count("a"); n != 3 {
+		t.Fatalf("expected 3 observations, got %d", n)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// buckets are cumulative, +Inf counts every observation
+	expected := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{kind="a",le="0.1"} 1
+test_duration_seconds_bucket{kind="a",le="1"} 2
+test_duration_seconds_bucket{kind="a",le="+Inf"} 3
+test_duration_seconds_sum{kind="a"} 3.55
+test_duration_seconds_count{kind="a"} 3
+`
+	if buf.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestRegistryWriteSorted(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"test_b", "test_a"} {
+		r.Register(&CounterVec{
+			metric: metric{
+				name: name,
+				help: name,
+			},
+			values: make(map[string]*counterValue),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# HELP test_a test_a\n# TYPE test_a counter\n# HELP test_b test_b\n# TYPE test_b counter\n"
+	if buf.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestRegistryHandler(t *testing.T) {
+	r := NewRegistry()
+	c := &CounterVec{
+		metric: metric{
+			name: "test_total",
+			help: "Total.",
+		},
+		values: make(map[string]*counterValue),
+	}
+	r.Register(c)
+	c.Inc()
+
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != ContentType {
+		t.Fatalf("expected content type %q, got %q", ContentType, ct)
+	}
+	expected := "# HELP test_total Total.\n# TYPE test_total counter\ntest_total 1\n"
+	if rr.Body.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, rr.Body.String())
+	}
+}
+
+func TestPanics(t *testing.T) {
+	c := &CounterVec{
+		metric: metric{
+			name:   "test_labels_total",
+			labels: []string{"a", "b"},
+		},
+		values: make(map[string]*counterValue),
+	}
+	h := &HistogramVec{
+		metric: metric{
+			name:   "test_labels_seconds",
+			labels: []string{"a"},
+		},
+		values: make(map[string]*histogramValue),
+	}
+	r := NewRegistry()
+	r.Register(c)
+
+	cases := []struct {
+		name string
+		f    func()
+	}{
+		{"too few counter labels", func() { c.Inc("x") }},
+		{"too many counter labels", func() { c.Inc("x", "y", "z") }},
+		{"counter value labels", func() { c.Value() }},
+		{"histogram labels", func() { h.Observe(1, "x", "y") }},
+		{"histogram count labels", func() { h.Count() }},
+		{"negative counter", func() { c.Add(-1, "x", "y") }},
+		{"duplicate collector", func() { r.Register(c) }},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+			tc.f()
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package mock
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+// Seed is the seed the keys of the mock device are derived from
+const Seed = "mock"
+
+// ErrUnknownScenario is returned when switching to a scenario that is not defined
+type ErrUnknownScenario struct {
+	Name string
+}
+
+func (e ErrUnknownScenario) Error() string {
+	return fmt.Sprintf("unknown scenario %q", e.Name)
+}
+
+// Gateway implements deviceWallet.Devicer by replaying the responses of the active scenario
+type Gateway struct {
+	lock      sync.Mutex
+	scenarios map[string]Scenario
+	names     []string
+	active    string
+
+	// script is the remainder of the operation in progress, consumed by acknowledgements
+	script []Response
+	// derive fills in the addresses or signatures that the script of the operation in progress leaves out
+	derive func(Response) Response
+}
+
+var _ deviceWallet.Devicer = (*Gateway)(nil)
+
+// NewGateway creates a Gateway replaying the given scenarios
+func NewGateway(s *Scenarios) (*Gateway, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	g := &Gateway{
+		scenarios: make(map[string]Scenario, len(s.Scenarios)),
+		active:    s.Active,
+	}
+	for _, sc := range s.Scenarios {
+		g.scenarios[sc.Name] = sc
+		g.names = append(g.names, sc.Name)
+	}
+	if g.active == "" {
+		g.active = g.names[0]
+	}
+
+	return g, nil
+}
+
+// Scenarios returns the names of the available scenarios in file order
+func (g *Gateway) Scenarios() []string {
+	names := make([]string, len(g.names))
+	copy(names, g.names)
+	return names
+}
+
+// Active returns the name of the active scenario
+func (g *Gateway) Active() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.active
+}
+
+// SetActive switches the active scenario and drops any operation in progress
+func (g *Gateway) SetActive(name string) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if _, ok := g.scenarios[name]; !ok {
+		return ErrUnknownScenario{Name: name}
+	}
+
+	g.active = name
+	g.script = nil
+	g.derive = nil
+	return nil
+}
+
+// start replays the first response of op and keeps the rest for the following acknowledgements
+func (g *Gateway) start(op string) (wire.Message, error) {
+	return g.startDeriving(op, nil)
+}
+
+// startDeriving starts op like start, completing its responses with derive
+func (g *Gateway) startDeriving(op string, derive func(Response) Response) (wire.Message, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	responses := g.scenarios[g.active].Operations[op]
+	if len(responses) == 0 {
+		g.script = nil
+		g.derive = nil
+		return g.unscripted(op)
+	}
+
+	g.script = responses[1:]
+	g.derive = derive
+	return g.replay(responses[0])
+}
+
+// ack replays the next response of the operation in progress. Without an operation in
+// progress the acknowledgement's own script is used.
+func (g *Gateway) ack(op string) (wire.Message, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if len(g.script) == 0 {
+		responses := g.scenarios[g.active].Operations[op]
+		if len(responses) == 0 {
+			return g.unscripted(op)
+		}
+		return responses[0].WireMessage()
+	}
+
+	r := g.script[0]
+	g.script = g.script[1:]
+	return g.replay(r)
+}
+
+// replay encodes a response of the operation in progress
+func (g *Gateway) replay(r Response) (wire.Message, error) {
+	if g.derive != nil {
+		r = g.derive(r)
+	}
+	return r.WireMessage()
+}
+
+// unscripted answers an operation that the active scenario doesn't script, as the firmware
+// answers a message it doesn't expect
+func (g *Gateway) unscripted(op string) (wire.Message, error) {
+	return Response{
+		Kind:    "Failure",
+		Code:    messages.FailureType_Failure_UnexpectedMessage.String(),
+		Message: fmt.Sprintf("%s is not scripted in scenario %q", op, g.active),
+	}.WireMessage()
+}
+
+// AddressGen replays the generate_addresses script. A ResponseSkycoinAddress without addresses
+// answers the addresses derived from Seed at the requested indices.
+func (g *Gateway) AddressGen(addressN, startIndex int, confirmAddress bool) (wire.Message, error) {
+	return g.startDeriving(OpGenerateAddresses, func(r Response) Response {
+		if r.Kind != "ResponseSkycoinAddress" || len(r.Addresses) != 0 {
+			return r
+		}
+
+		keys, err := deriveKeys(startIndex, addressN)
+		if err != nil {
+			return processFailure(err)
+		}
+		for _, k := range keys {
+			r.Addresses = append(r.Addresses, cipher.MustAddressFromSecKey(k).String())
+		}
+		return r
+	})
+}
+
+// ApplySettings replays the apply_settings script
+func (g *Gateway) ApplySettings(usePassphrase bool, label string) (wire.Message, error) {
+	return g.start(OpApplySettings)
+}
+
+// Backup replays the backup script
+func (g *Gateway) Backup() (wire.Message, error) {
+	return g.start(OpBackup)
+}
+
+// Cancel replays the cancel script
+func (g *Gateway) Cancel() (wire.Message, error) {
+	return g.start(OpCancel)
+}
+
+// CheckMessageSignature replays the check_message_signature script
+func (g *Gateway) CheckMessageSignature(message, signature, address string) (wire.Message, error) {
+	return g.start(OpCheckMessageSignature)
+}
+
+// ChangePin replays the change_pin script
+func (g *Gateway) ChangePin() (wire.Message, error) {
+	return g.start(OpChangePin)
+}
+
+// Connected reports whether the active scenario has a device attached
+func (g *Gateway) Connected() bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return !g.scenarios[g.active].Disconnected
+}
+
+// FirmwareUpload is not supported in mock mode
+func (g *Gateway) FirmwareUpload(payload []byte, hash [32]byte) error {
+	return errors.New("firmware upload is not supported by the mock device")
+}
+
+// GetFeatures replays the features script
+func (g *Gateway) GetFeatures() (wire.Message, error) {
+	return g.start(OpFeatures)
+}
+
+// GenerateMnemonic replays the generate_mnemonic script
+func (g *Gateway) GenerateMnemonic(wordCount uint32, usePassphrase bool) (wire.Message, error) {
+	return g.start(OpGenerateMnemonic)
+}
+
+// Recovery replays the recovery script
+func (g *Gateway) Recovery(wordCount uint32, usePassphrase, dryRun bool) (wire.Message, error) {
+	return g.start(OpRecovery)
+}
+
+// SetMnemonic replays the set_mnemonic script
+func (g *Gateway) SetMnemonic(mnemonic string) (wire.Message, error) {
+	return g.start(OpSetMnemonic)
+}
+
+// TransactionSign replays the transaction_sign script. A ResponseTransactionSign without
+// signatures answers the signatures of the inputs by the keys derived from Seed at their index.
+func (g *Gateway) TransactionSign(inputs []*messages.SkycoinTransactionInput, outputs []*messages.SkycoinTransactionOutput) (wire.Message, error) {
+	return g.startDeriving(OpTransactionSign, func(r Response) Response {
+		if r.Kind != "ResponseTransactionSign" || len(r.Signatures) != 0 {
+			return r
+		}
+
+		signatures, err := signTransaction(inputs, outputs)
+		if err != nil {
+			return processFailure(err)
+		}
+		r.Signatures = signatures
+		return r
+	})
+}
+
+// SignMessage replays the sign_message script
+func (g *Gateway) SignMessage(addressIndex int, message string) (wire.Message, error) {
+	return g.start(OpSignMessage)
+}
+
+// Wipe replays the wipe script
+func (g *Gateway) Wipe() (wire.Message, error) {
+	return g.start(OpWipe)
+}
+
+// PinMatrixAck continues the operation in progress
+func (g *Gateway) PinMatrixAck(p string) (wire.Message, error) {
+	return g.ack(OpPinMatrixAck)
+}
+
+// WordAck continues the operation in progress
+func (g *Gateway) WordAck(word string) (wire.Message, error) {
+	return g.ack(OpWordAck)
+}
+
+// PassphraseAck continues the operation in progress
+func (g *Gateway) PassphraseAck(passphrase string) (wire.Message, error) {
+	return g.ack(OpPassphraseAck)
+}
+
+// ButtonAck continues the operation in progress
+func (g *Gateway) ButtonAck() (wire.Message, error) {
+	return g.ack(OpButtonAck)
+}
+
+// SetAutoPressButton is a no-op, the scenario decides the outcome of button requests
+func (g *Gateway) SetAutoPressButton(simulateButtonPress bool, simulateButtonType deviceWallet.ButtonType) error {
+	return nil
+}
+
+// deriveKeys returns the n keys derived from Seed starting at startIndex
+func deriveKeys(startIndex, n int) ([]cipher.SecKey, error) {
+	if startIndex < 0 || n <= 0 {
+		return nil, fmt.Errorf("invalid address range %d+%d", startIndex, n)
+	}
+
+	keys, err := cipher.GenerateDeterministicKeyPairs([]byte(Seed), startIndex+n)
+	if err != nil {
+		return nil, err
+	}
+	return keys[startIndex:], nil
+}
+
+// signTransaction signs each input with the key derived from Seed at its index, as the firmware does
+func signTransaction(inputs []*messages.SkycoinTransactionInput, outputs []*messages.SkycoinTransactionOutput) ([]string, error) {
+	hashes := make([]cipher.SHA256, len(inputs))
+	for i, in := range inputs {
+		h, err := cipher.SHA256FromHex(in.GetHashIn())
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %v", i, err)
+		}
+		hashes[i] = h
+	}
+
+	txnOutputs := make([]transaction.Output, len(outputs))
+	for i, o := range outputs {
+		addr, err := cipher.DecodeBase58Address(o.GetAddress())
+		if err != nil {
+			return nil, fmt.Errorf("output %d: %v", i, err)
+		}
+		txnOutputs[i] = transaction.Output{
+			Address: addr,
+			Coins:   o.GetCoin(),
+			Hours:   o.GetHour(),
+		}
+	}
+
+	innerHash := transaction.HashInner(hashes, txnOutputs)
+	signatures := make([]string, len(inputs))
+	for i, in := range inputs {
+		keys, err := deriveKeys(int(in.GetIndex()), 1)
+		if err != nil {
+			return nil, err
+		}
+
+		sig, err := cipher.SignHash(transaction.SignatureHash(innerHash, hashes[i]), keys[0])
+		if err != nil {
+			return nil, err
+		}
+		signatures[i] = sig.Hex()
+	}
+
+	return signatures, nil
+}
+
+// processFailure is the Failure answered when a response can't be derived
+func processFailure(err error) Response {
+	return Response{
+		Kind:    "Failure",
+		Code:    messages.FailureType_Failure_ProcessError.String(),
+		Message: err.Error(),
+	}
+}
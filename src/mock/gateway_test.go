@@ -0,0 +1,208 @@
+package mock
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/skycoin/skycoin/src/cipher"
+	deviceWallet "github.com/therealssj/testingdep1/src/device-wallet"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+
+	"github.com/therealssj/testingdep2/src/transaction"
+)
+
+func loadTestGateway(t *testing.T) *Gateway {
+	t.Helper()
+
+	s, err := LoadScenarios("testdata/scenarios.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := NewGateway(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return g
+}
+
+func TestGatewayReplaysScript(t *testing.T) {
+	g := loadTestGateway(t)
+
+	if g.Active() != "happy_path" {
+		t.Fatalf("active scenario is %q", g.Active())
+	}
+
+	msg, err := g.AddressGen(1, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Kind != uint16(messages.MessageType_MessageType_ButtonRequest) {
+		t.Fatalf("got %s, want ButtonRequest", messages.MessageType(msg.Kind))
+	}
+
+	msg, err = g.ButtonAck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses, err := deviceWallet.DecodeResponseSkycoinAddress(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the scenario leaves the addresses out, they are derived from Seed
+	address := cipher.MustAddressFromSecKey(cipher.MustGenerateDeterministicKeyPairs([]byte(Seed), 1)[0])
+	if len(addresses) != 1 || addresses[0] != address.String() {
+		t.Fatalf("unexpected addresses %v", addresses)
+	}
+
+	// the script is consumed, an unexpected ack fails like the firmware does
+	msg, err = g.ButtonAck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Kind != uint16(messages.MessageType_MessageType_Failure) {
+		t.Fatalf("got %s, want Failure", messages.MessageType(msg.Kind))
+	}
+}
+
+func TestGatewayDerivesResponses(t *testing.T) {
+	g := loadTestGateway(t)
+	keys := cipher.MustGenerateDeterministicKeyPairs([]byte(Seed), 3)
+
+	if _, err := g.AddressGen(2, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := g.ButtonAck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses, err := deviceWallet.DecodeResponseSkycoinAddress(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		cipher.MustAddressFromSecKey(keys[1]).String(),
+		cipher.MustAddressFromSecKey(keys[2]).String(),
+	}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Fatalf("expected addresses %v, got %v", expected, addresses)
+	}
+
+	input := cipher.SumSHA256([]byte("input"))
+	inputs := []*messages.SkycoinTransactionInput{
+		{HashIn: proto.String(input.Hex()), Index: proto.Uint32(2)},
+	}
+	outputs := []*messages.SkycoinTransactionOutput{
+		{Address: proto.String(expected[0]), Coin: proto.Uint64(1000000), Hour: proto.Uint64(1)},
+	}
+	if _, err := g.TransactionSign(inputs, outputs); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = g.ButtonAck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatures, err := deviceWallet.DecodeResponseTransactionSign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signatures) != 1 {
+		t.Fatalf("expected 1 signature, got %d", len(signatures))
+	}
+	innerHash := transaction.HashInner([]cipher.SHA256{input}, []transaction.Output{{
+		Address: cipher.MustDecodeBase58Address(expected[0]),
+		Coins:   1000000,
+		Hours:   1,
+	}})
+	if err := cipher.VerifyAddressSignedHash(cipher.MustAddressFromSecKey(keys[2]), cipher.MustSigFromHex(signatures[0]), transaction.SignatureHash(innerHash, input)); err != nil {
+		t.Fatalf("the signature isn't made by the key of the input: %v", err)
+	}
+
+	// a transaction the device can't parse is answered with a Failure
+	inputs[0].HashIn = proto.String("invalid")
+	if _, err := g.TransactionSign(inputs, outputs); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = g.ButtonAck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Kind != uint16(messages.MessageType_MessageType_Failure) {
+		t.Fatalf("got %s, want Failure", messages.MessageType(msg.Kind))
+	}
+}
+
+func TestGatewaySetActive(t *testing.T) {
+	g := loadTestGateway(t)
+
+	if err := g.SetActive("missing"); err == nil {
+		t.Fatal("expected an error for an unknown scenario")
+	}
+
+	if err := g.SetActive("user_cancels"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := g.TransactionSign(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reason, err := deviceWallet.DecodeFailMsg(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != "Action cancelled by user" {
+		t.Fatalf("unexpected failure %q", reason)
+	}
+
+	if err := g.SetActive("disconnected"); err != nil {
+		t.Fatal(err)
+	}
+	if g.Connected() {
+		t.Fatal("disconnected scenario reports a connected device")
+	}
+	if _, err := g.AddressGen(1, 0, false); err == nil {
+		t.Fatal("expected an error from the disconnected scenario")
+	}
+}
+
+func TestScenariosValidate(t *testing.T) {
+	cases := []struct {
+		name      string
+		scenarios Scenarios
+	}{
+		{"empty", Scenarios{}},
+		{"unnamed", Scenarios{Scenarios: []Scenario{{}}}},
+		{"duplicate", Scenarios{Scenarios: []Scenario{{Name: "a"}, {Name: "a"}}}},
+		{"unknown active", Scenarios{Active: "b", Scenarios: []Scenario{{Name: "a"}}}},
+		{"unknown operation", Scenarios{Scenarios: []Scenario{{
+			Name:       "a",
+			Operations: map[string][]Response{"reboot": {{Kind: "Success"}}},
+		}}}},
+		{"unknown kind", Scenarios{Scenarios: []Scenario{{
+			Name:       "a",
+			Operations: map[string][]Response{OpWipe: {{Kind: "Reboot"}}},
+		}}}},
+		{"unknown failure code", Scenarios{Scenarios: []Scenario{{
+			Name:       "a",
+			Operations: map[string][]Response{OpWipe: {{Kind: "Failure", Code: "Failure_Reboot"}}},
+		}}}},
+		{"invalid address", Scenarios{Scenarios: []Scenario{{
+			Name: "a",
+			Operations: map[string][]Response{OpGenerateAddresses: {{
+				Kind:      "ResponseSkycoinAddress",
+				Addresses: []string{"2HcV3JDBuU8HSgetgKPxmNa95XrCgx6VchF", "2HcV3JDBuU8HSgetgKPxmNa95XrCgx6VchG"},
+			}}},
+		}}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.scenarios.Validate(); err == nil {
+				t.Fatal("expected a validation error")
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+/*
+Package mock implements a scripted Gatewayer for running the daemon without a device or emulator.
+
+Scenarios are loaded from a JSON file such as:
+
+	{
+	    "active": "happy_path",
+	    "scenarios": [
+	        {
+	            "name": "happy_path",
+	            "operations": {
+	                "generate_addresses": [
+	                    {"kind": "ButtonRequest"},
+	                    {"kind": "ResponseSkycoinAddress", "addresses": ["2HcV3JDBuU8HSgetgKPxmNa95XrCgx6VchF"]}
+	                ],
+	                "transaction_sign": [
+	                    {"kind": "Failure", "code": "Failure_ActionCancelled", "message": "Action cancelled by user"}
+	                ]
+	            }
+	        }
+	    ]
+	}
+
+Calling an operation replays the first response of its script. Acknowledgements
+(button_ack, pin_matrix_ack, passphrase_ack and word_ack) replay the next response
+of the script in progress, so multi step device interactions can be modelled.
+
+The mock device derives its keys from Seed. A ResponseSkycoinAddress without addresses
+answers the addresses at the requested indices and a ResponseTransactionSign without
+signatures answers valid signatures of the transaction, so that scenarios pass the
+daemon's signature checks. testdata/scenarios.json is a complete example.
+*/
+package mock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/skycoin/skycoin/src/cipher"
+	messages "github.com/therealssj/testingdep1/src/device-wallet/messages/go"
+	"github.com/therealssj/testingdep1/src/device-wallet/wire"
+)
+
+// Operation names used as keys of Scenario.Operations
+const (
+	OpGenerateAddresses     = "generate_addresses"
+	OpApplySettings         = "apply_settings"
+	OpBackup                = "backup"
+	OpCancel                = "cancel"
+	OpCheckMessageSignature = "check_message_signature"
+	OpChangePin             = "change_pin"
+	OpFeatures              = "features"
+	OpGenerateMnemonic      = "generate_mnemonic"
+	OpRecovery              = "recovery"
+	OpSetMnemonic           = "set_mnemonic"
+	OpTransactionSign       = "transaction_sign"
+	OpSignMessage           = "sign_message"
+	OpWipe                  = "wipe"
+	OpPinMatrixAck          = "pin_matrix_ack"
+	OpWordAck               = "word_ack"
+	OpPassphraseAck         = "passphrase_ack"
+	OpButtonAck             = "button_ack"
+)
+
+// Response is a single scripted device answer
+type Response struct {
+	// Kind is the MessageType name without its "MessageType_" prefix, e.g. "ButtonRequest"
+	Kind string `json:"kind,omitempty"`
+	// Error makes the operation fail with a go error, as a disconnected device would
+	Error string `json:"error,omitempty"`
+
+	// Message is the Success or Failure message
+	Message string `json:"message,omitempty"`
+	// Code is the FailureType name of a Failure, e.g. "Failure_ActionCancelled"
+	Code       string          `json:"code,omitempty"`
+	Addresses  []string        `json:"addresses,omitempty"`
+	Signatures []string        `json:"signatures,omitempty"`
+	Signature  string          `json:"signature,omitempty"`
+	Features   json.RawMessage `json:"features,omitempty"`
+}
+
+// Scenario scripts the device answers for each operation
+type Scenario struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Operations  map[string][]Response `json:"operations"`
+	// Disconnected makes Connected report that no device is attached
+	Disconnected bool `json:"disconnected,omitempty"`
+}
+
+// Scenarios is the content of a scenario file
+type Scenarios struct {
+	// Active is the name of the scenario used at startup, defaults to the first scenario
+	Active    string     `json:"active,omitempty"`
+	Scenarios []Scenario `json:"scenarios"`
+}
+
+// LoadScenarios reads and validates a scenario file
+func LoadScenarios(path string) (*Scenarios, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Scenarios
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("invalid scenario file %s: %v", path, err)
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario file %s: %v", path, err)
+	}
+
+	return &s, nil
+}
+
+// Validate checks that scenario names are unique, that every response can be encoded and that
+// every address is a valid skycoin address
+func (s *Scenarios) Validate() error {
+	if len(s.Scenarios) == 0 {
+		return errors.New("no scenarios defined")
+	}
+
+	names := make(map[string]struct{}, len(s.Scenarios))
+	for _, sc := range s.Scenarios {
+		if sc.Name == "" {
+			return errors.New("scenario name is required")
+		}
+		if _, ok := names[sc.Name]; ok {
+			return fmt.Errorf("duplicate scenario %q", sc.Name)
+		}
+		names[sc.Name] = struct{}{}
+
+		for op, responses := range sc.Operations {
+			if !knownOperation(op) {
+				return fmt.Errorf("scenario %q: unknown operation %q", sc.Name, op)
+			}
+			for i, r := range responses {
+				if r.Error != "" {
+					continue
+				}
+				if _, err := r.WireMessage(); err != nil {
+					return fmt.Errorf("scenario %q: %s response %d: %v", sc.Name, op, i, err)
+				}
+				for _, a := range r.Addresses {
+					if _, err := cipher.DecodeBase58Address(a); err != nil {
+						return fmt.Errorf("scenario %q: %s response %d: invalid address %s: %v", sc.Name, op, i, a, err)
+					}
+				}
+			}
+		}
+	}
+
+	if s.Active != "" {
+		if _, ok := names[s.Active]; !ok {
+			return fmt.Errorf("active scenario %q is not defined", s.Active)
+		}
+	}
+
+	return nil
+}
+
+func knownOperation(op string) bool {
+	switch op {
+	case OpGenerateAddresses, OpApplySettings, OpBackup, OpCancel, OpCheckMessageSignature,
+		OpChangePin, OpFeatures, OpGenerateMnemonic, OpRecovery, OpSetMnemonic, OpTransactionSign,
+		OpSignMessage, OpWipe, OpPinMatrixAck, OpWordAck, OpPassphraseAck, OpButtonAck:
+		return true
+	}
+	return false
+}
+
+// WireMessage encodes the response as the wire message a device would send.
+// Responses with Error set have no message and return the error instead.
+func (r Response) WireMessage() (wire.Message, error) {
+	if r.Error != "" {
+		return wire.Message{}, errors.New(r.Error)
+	}
+
+	kind, ok := messages.MessageType_value["MessageType_"+r.Kind]
+	if !ok {
+		return wire.Message{}, fmt.Errorf("unknown message kind %q", r.Kind)
+	}
+
+	var pb proto.Message
+	switch messages.MessageType(kind) {
+	case messages.MessageType_MessageType_Success:
+		pb = &messages.Success{
+			Message: proto.String(r.Message),
+		}
+	case messages.MessageType_MessageType_Failure:
+		code := messages.FailureType_Failure_FirmwareError
+		if r.Code != "" {
+			c, ok := messages.FailureType_value[r.Code]
+			if !ok {
+				return wire.Message{}, fmt.Errorf("unknown failure code %q", r.Code)
+			}
+			code = messages.FailureType(c)
+		}
+		pb = &messages.Failure{
+			Code:    code.Enum(),
+			Message: proto.String(r.Message),
+		}
+	case messages.MessageType_MessageType_ButtonRequest:
+		pb = &messages.ButtonRequest{}
+	case messages.MessageType_MessageType_PinMatrixRequest:
+		pb = &messages.PinMatrixRequest{}
+	case messages.MessageType_MessageType_PassphraseRequest:
+		pb = &messages.PassphraseRequest{}
+	case messages.MessageType_MessageType_WordRequest:
+		pb = &messages.WordRequest{}
+	case messages.MessageType_MessageType_ResponseSkycoinAddress:
+		pb = &messages.ResponseSkycoinAddress{
+			Addresses: r.Addresses,
+		}
+	case messages.MessageType_MessageType_ResponseTransactionSign:
+		pb = &messages.ResponseTransactionSign{
+			Signatures: r.Signatures,
+			Finished:   proto.Bool(true),
+		}
+	case messages.MessageType_MessageType_ResponseSkycoinSignMessage:
+		pb = &messages.ResponseSkycoinSignMessage{
+			SignedMessage: proto.String(r.Signature),
+		}
+	case messages.MessageType_MessageType_Features:
+		features := &messages.Features{}
+		if len(r.Features) != 0 {
+			if err := json.Unmarshal(r.Features, features); err != nil {
+				return wire.Message{}, fmt.Errorf("invalid features: %v", err)
+			}
+		}
+		pb = features
+	default:
+		return wire.Message{}, fmt.Errorf("message kind %q can't be scripted", r.Kind)
+	}
+
+	data, err := proto.Marshal(pb)
+	if err != nil {
+		return wire.Message{}, err
+	}
+
+	return wire.Message{
+		Kind: uint16(kind),
+		Data: data,
+	}, nil
+}
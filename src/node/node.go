@@ -0,0 +1,318 @@
+/*
+Package node implements a client of the Skycoin node REST API, used to look up the chain state
+of device addresses.
+*/
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout is the timeout of requests to the node
+	DefaultTimeout = 30 * time.Second
+
+	// addressesPerRequest is the most addresses queried in a single request, so that the
+	// query string of a GET request stays below the URL length limits of the node and proxies
+	addressesPerRequest = 100
+)
+
+// Client is a Skycoin node REST API client
+type Client struct {
+	// URL is the node's address, such as http://127.0.0.1:6420
+	URL        string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a Client of the node at addr
+func NewClient(addr string) (*Client, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid node url %q", addr)
+	}
+
+	return &Client{
+		URL: strings.TrimRight(addr, "/"),
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+	}, nil
+}
+
+// APIError is returned when the node answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e APIError) Error() string {
+	return fmt.Sprintf("node returned %d: %s", e.StatusCode, e.Message)
+}
+
+// get sends a GET request to the node and decodes its JSON answer into v
+func (c *Client) get(path string, query url.Values, v interface{}) error {
+	u := c.URL + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+
+	resp, err := c.HTTPClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp, v)
+}
+
+// post sends a JSON request to the node and decodes its JSON answer into v
+func (c *Client) post(path string, req, v interface{}) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.HTTPClient.Post(c.URL+path, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp, v)
+}
+
+// chunkAddresses splits addresses in chunks of at most addressesPerRequest addresses
+func chunkAddresses(addresses []string) [][]string {
+	var chunks [][]string
+	for len(addresses) > addressesPerRequest {
+		chunks = append(chunks, addresses[:addressesPerRequest])
+		addresses = addresses[addressesPerRequest:]
+	}
+	return append(chunks, addresses)
+}
+
+// decodeResponse decodes the JSON answer of the node into v
+func decodeResponse(resp *http.Response, v interface{}) error {
+	if resp.StatusCode != http.StatusOK {
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return APIError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(b)),
+		}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Balance is an amount of coins and coin hours, coins are in droplets
+type Balance struct {
+	Coins uint64 `json:"coins"`
+	Hours uint64 `json:"hours"`
+}
+
+// BalancePair is the balance in the last block and the balance including unconfirmed transactions
+type BalancePair struct {
+	Confirmed Balance `json:"confirmed"`
+	Predicted Balance `json:"predicted"`
+}
+
+// BalanceResponse is the total balance of addresses and the balance of each one
+type BalanceResponse struct {
+	BalancePair
+	Addresses map[string]BalancePair `json:"addresses"`
+}
+
+// add adds the balance of o to b
+func (b *Balance) add(o Balance) error {
+	if b.Coins+o.Coins < b.Coins || b.Hours+o.Hours < b.Hours {
+		return errors.New("balance overflows")
+	}
+	b.Coins += o.Coins
+	b.Hours += o.Hours
+	return nil
+}
+
+// Balance returns the balance of the addresses, querying the node for at most
+// addressesPerRequest addresses at a time
+func (c *Client) Balance(addresses []string) (*BalanceResponse, error) {
+	total := BalanceResponse{
+		Addresses: make(map[string]BalancePair, len(addresses)),
+	}
+	for _, chunk := range chunkAddresses(addresses) {
+		var b BalanceResponse
+		if err := c.get("/api/v1/balance", url.Values{
+			"addrs": []string{strings.Join(chunk, ",")},
+		}, &b); err != nil {
+			return nil, err
+		}
+
+		if err := total.Confirmed.add(b.Confirmed); err != nil {
+			return nil, err
+		}
+		if err := total.Predicted.add(b.Predicted); err != nil {
+			return nil, err
+		}
+		for a, p := range b.Addresses {
+			total.Addresses[a] = p
+		}
+	}
+
+	return &total, nil
+}
+
+// TransactionStatus is the status of a transaction in the chain
+type TransactionStatus struct {
+	Confirmed bool   `json:"confirmed"`
+	Height    uint64 `json:"height"`
+}
+
+// TransactionOutput is an output of a transaction
+type TransactionOutput struct {
+	UxID    string `json:"uxid"`
+	Address string `json:"dst"`
+	Coins   string `json:"coins"`
+	Hours   uint64 `json:"hours"`
+}
+
+// Transaction is a transaction of the chain or of the unconfirmed pool
+type Transaction struct {
+	TxID    string              `json:"txid"`
+	Inputs  []string            `json:"inputs"`
+	Outputs []TransactionOutput `json:"outputs"`
+}
+
+// TransactionResult is a transaction and its status
+type TransactionResult struct {
+	Status      TransactionStatus `json:"status"`
+	Transaction Transaction       `json:"txn"`
+}
+
+// Transactions returns the transactions involving the addresses, unconfirmed ones included.
+// The node is queried for at most addressesPerRequest addresses at a time.
+func (c *Client) Transactions(addresses []string) ([]TransactionResult, error) {
+	var txns []TransactionResult
+	seen := make(map[string]bool)
+	for _, chunk := range chunkAddresses(addresses) {
+		var chunkTxns []TransactionResult
+		if err := c.get("/api/v1/transactions", url.Values{
+			"addrs": []string{strings.Join(chunk, ",")},
+		}, &chunkTxns); err != nil {
+			return nil, err
+		}
+
+		// a transaction involving addresses of several chunks is returned for each of them
+		for _, txn := range chunkTxns {
+			if !seen[txn.Transaction.TxID] {
+				seen[txn.Transaction.TxID] = true
+				txns = append(txns, txn)
+			}
+		}
+	}
+
+	return txns, nil
+}
+
+// UsedAddresses returns the addresses that received coins in a transaction. Spending coins requires
+// receiving them first, so these are all the addresses with a transaction history.
+func (c *Client) UsedAddresses(addresses []string) (map[string]bool, error) {
+	txns, err := c.Transactions(addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(addresses))
+	for _, a := range addresses {
+		wanted[a] = true
+	}
+
+	used := make(map[string]bool)
+	for _, txn := range txns {
+		for _, o := range txn.Transaction.Outputs {
+			if wanted[o.Address] {
+				used[o.Address] = true
+			}
+		}
+	}
+
+	return used, nil
+}
+
+// UnspentOutput is an unspent output of the chain
+type UnspentOutput struct {
+	Hash    string `json:"hash"`
+	Address string `json:"address"`
+	Coins   string `json:"coins"`
+	Hours   uint64 `json:"hours"`
+	// CalculatedHours are the coin hours the output holds at the head block
+	CalculatedHours uint64 `json:"calculated_hours"`
+}
+
+// OutputsResponse are the unspent outputs of the chain, the ones spent by unconfirmed
+// transactions and the ones they create
+type OutputsResponse struct {
+	HeadOutputs     []UnspentOutput `json:"head_outputs"`
+	OutgoingOutputs []UnspentOutput `json:"outgoing_outputs"`
+	IncomingOutputs []UnspentOutput `json:"incoming_outputs"`
+}
+
+// Spendable returns the unspent outputs that no unconfirmed transaction spends
+func (o *OutputsResponse) Spendable() []UnspentOutput {
+	outgoing := make(map[string]bool, len(o.OutgoingOutputs))
+	for _, u := range o.OutgoingOutputs {
+		outgoing[u.Hash] = true
+	}
+
+	var spendable []UnspentOutput
+	for _, u := range o.HeadOutputs {
+		if !outgoing[u.Hash] {
+			spendable = append(spendable, u)
+		}
+	}
+	return spendable
+}
+
+// Outputs returns the unspent outputs of the addresses, querying the node for at most
+// addressesPerRequest addresses at a time
+func (c *Client) Outputs(addresses []string) (*OutputsResponse, error) {
+	var outputs OutputsResponse
+	for _, chunk := range chunkAddresses(addresses) {
+		var o OutputsResponse
+		if err := c.get("/api/v1/outputs", url.Values{
+			"addrs": []string{strings.Join(chunk, ",")},
+		}, &o); err != nil {
+			return nil, err
+		}
+
+		outputs.HeadOutputs = append(outputs.HeadOutputs, o.HeadOutputs...)
+		outputs.OutgoingOutputs = append(outputs.OutgoingOutputs, o.OutgoingOutputs...)
+		outputs.IncomingOutputs = append(outputs.IncomingOutputs, o.IncomingOutputs...)
+	}
+
+	return &outputs, nil
+}
+
+// InjectTransaction broadcasts a hex encoded serialized transaction and returns its ID
+func (c *Client) InjectTransaction(rawTx string) (string, error) {
+	var txid string
+	if err := c.post("/api/v1/injectTransaction", struct {
+		RawTx string `json:"rawtx"`
+	}{rawTx}, &txid); err != nil {
+		return "", err
+	}
+
+	return txid, nil
+}
@@ -0,0 +1,222 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewClient(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:6420", "ftp://127.0.0.1", "http://"} {
+		if _, err := NewClient(addr); err == nil {
+			t.Fatalf("invalid url %q was accepted", addr)
+		}
+	}
+}
+
+func TestBalance(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/balance" {
+			http.NotFound(w, r)
+			return
+		}
+		if addrs := r.URL.Query().Get("addrs"); addrs != "a,b" {
+			http.Error(w, "400 Bad Request - invalid address", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{
+			"confirmed": {"coins": 3000000, "hours": 30},
+			"predicted": {"coins": 2000000, "hours": 20},
+			"addresses": {
+				"a": {"confirmed": {"coins": 3000000, "hours": 30}, "predicted": {"coins": 2000000, "hours": 20}},
+				"b": {"confirmed": {"coins": 0, "hours": 0}, "predicted": {"coins": 0, "hours": 0}}
+			}
+		}`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := c.Balance([]string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &BalanceResponse{
+		BalancePair: BalancePair{
+			Confirmed: Balance{Coins: 3000000, Hours: 30},
+			Predicted: Balance{Coins: 2000000, Hours: 20},
+		},
+		Addresses: map[string]BalancePair{
+			"a": {
+				Confirmed: Balance{Coins: 3000000, Hours: 30},
+				Predicted: Balance{Coins: 2000000, Hours: 20},
+			},
+			"b": {},
+		},
+	}
+	if !reflect.DeepEqual(b, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, b)
+	}
+
+	_, err = c.Balance([]string{"c"})
+	if err != (APIError{
+		StatusCode: http.StatusBadRequest,
+		Message:    "400 Bad Request - invalid address",
+	}) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+}
+
+func TestBalanceChunked(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		addrs := strings.Split(r.URL.Query().Get("addrs"), ",")
+		if len(addrs) > addressesPerRequest {
+			http.Error(w, "414 Request-URI Too Long", http.StatusRequestURITooLong)
+			return
+		}
+		b := BalanceResponse{
+			BalancePair: BalancePair{
+				Confirmed: Balance{Coins: uint64(len(addrs)), Hours: 1},
+			},
+			Addresses: make(map[string]BalancePair),
+		}
+		for _, a := range addrs {
+			b.Addresses[a] = BalancePair{Confirmed: Balance{Coins: 1}}
+		}
+		json.NewEncoder(w).Encode(b)
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addresses := make([]string, 2*addressesPerRequest+50)
+	for i := range addresses {
+		addresses[i] = fmt.Sprintf("a%d", i)
+	}
+
+	b, err := c.Balance(addresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 3 requests, got %d", requests)
+	}
+	if expected := (Balance{Coins: uint64(len(addresses)), Hours: 3}); b.Confirmed != expected {
+		t.Fatalf("expected %+v, got %+v", expected, b.Confirmed)
+	}
+	if len(b.Addresses) != len(addresses) {
+		t.Fatalf("expected %d addresses, got %d", len(addresses), len(b.Addresses))
+	}
+}
+
+func TestUsedAddresses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/transactions" || r.URL.Query().Get("addrs") != "a,b,c" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[
+			{"status": {"confirmed": true, "height": 10}, "txn": {"txid": "1", "inputs": ["x"], "outputs": [{"uxid": "u1", "dst": "a", "coins": "1.000000", "hours": 1}, {"uxid": "u2", "dst": "z", "coins": "2.000000", "hours": 1}]}},
+			{"status": {"confirmed": false}, "txn": {"txid": "2", "inputs": ["u1"], "outputs": [{"uxid": "u3", "dst": "c", "coins": "1.000000", "hours": 0}]}}
+		]`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used, err := c.UsedAddresses([]string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]bool{"a": true, "c": true}; !reflect.DeepEqual(used, expected) {
+		t.Fatalf("expected %v, got %v", expected, used)
+	}
+}
+
+func TestOutputs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/outputs" || r.URL.Query().Get("addrs") != "a,b" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{
+			"head_outputs": [
+				{"hash": "h1", "address": "a", "coins": "1.000000", "hours": 1, "calculated_hours": 5},
+				{"hash": "h2", "address": "b", "coins": "2.000000", "hours": 2, "calculated_hours": 6}
+			],
+			"outgoing_outputs": [
+				{"hash": "h1", "address": "a", "coins": "1.000000", "hours": 1, "calculated_hours": 5}
+			],
+			"incoming_outputs": []
+		}`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := c.Outputs([]string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []UnspentOutput{
+		{Hash: "h2", Address: "b", Coins: "2.000000", Hours: 2, CalculatedHours: 6},
+	}
+	if spendable := o.Spendable(); !reflect.DeepEqual(spendable, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, spendable)
+	}
+}
+
+func TestInjectTransaction(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RawTx string `json:"rawtx"`
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/injectTransaction" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RawTx != "00ff" {
+			http.Error(w, "400 Bad Request - invalid transaction", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`"txid"`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txid, err := c.InjectTransaction("00ff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txid != "txid" {
+		t.Fatalf("expected txid, got %q", txid)
+	}
+
+	if _, err := c.InjectTransaction("00"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
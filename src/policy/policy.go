@@ -0,0 +1,328 @@
+/*
+Package policy implements local spending rules enforced before a device signs a transaction.
+
+A policy file sets rules for every device, and optionally overrides them by device ID:
+
+	{
+		"default": {
+			"daily_coin_limit": "100",
+			"max_outputs": 4,
+			"min_hours_per_coin": "1"
+		},
+		"devices": {
+			"6A36DAAF3F3A1C7E8CB3A5E1": {
+				"daily_coin_limit": "1000",
+				"allowed_destinations": ["2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv"]
+			}
+		}
+	}
+
+A zero or missing value disables a rule. Rules only apply to the outputs sending coins away,
+change outputs returning coins to the device are exempt.
+
+The coins each device sent today are saved next to the policy file, in the same path with a
+.spent suffix, so that restarting the daemon doesn't reset the daily limits.
+*/
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+	wh "github.com/skycoin/skycoin/src/util/http"
+)
+
+// dropletsPerCoin is the number of droplets in a coin
+const dropletsPerCoin = 1000000
+
+// Rules are the spending rules of a device
+type Rules struct {
+	// DailyCoinLimit is the most coins the device may send per UTC day
+	DailyCoinLimit wh.Coins `json:"daily_coin_limit"`
+	// AllowedDestinations are the only addresses the device may send coins to
+	AllowedDestinations []string `json:"allowed_destinations"`
+	// MaxOutputs is the most outputs a transaction may have, change included
+	MaxOutputs int `json:"max_outputs"`
+	// MinHoursPerCoin is the fewest coin hours an output must carry per coin sent
+	MinHoursPerCoin wh.Hours `json:"min_hours_per_coin"`
+}
+
+// Policy are the rules of every device, Devices overrides Default by device ID
+type Policy struct {
+	Default Rules            `json:"default"`
+	Devices map[string]Rules `json:"devices"`
+}
+
+// rules returns the rules of the device
+func (p Policy) rules(deviceID string) Rules {
+	if r, ok := p.Devices[deviceID]; ok {
+		return r
+	}
+	return p.Default
+}
+
+// Output is an output of a transaction to sign
+type Output struct {
+	Address string
+	Coins   uint64
+	Hours   uint64
+	// Change is set for outputs returning coins to a device address
+	Change bool
+}
+
+// Violation is returned for transactions breaking a rule
+type Violation struct {
+	// Rule is the json name of the broken rule
+	Rule   string
+	Reason string
+}
+
+func (v Violation) Error() string {
+	return fmt.Sprintf("policy violation: %s", v.Reason)
+}
+
+// spentSuffix is appended to the policy file path to name the file the spent coins are saved in
+const spentSuffix = ".spent"
+
+// spending is the coins a device sent on a day
+type spending struct {
+	Day   string `json:"day"`
+	Coins uint64 `json:"coins"`
+}
+
+// Engine evaluates transactions against a policy and tracks the coins sent by each device.
+// If it has a spentPath, the coins sent are persisted there.
+type Engine struct {
+	lock      sync.Mutex
+	policy    Policy
+	spent     map[string]spending
+	spentPath string
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewEngine creates an Engine enforcing the policy
+func NewEngine(p Policy) *Engine {
+	return &Engine{
+		policy: p,
+		spent:  make(map[string]spending),
+		now:    time.Now,
+	}
+}
+
+// Load creates an Engine enforcing the policy file at path. The coins sent today are loaded
+// from the file next to it, none were sent if it doesn't exist.
+func Load(path string) (*Engine, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %v", path, err)
+	}
+
+	e := NewEngine(p)
+	e.spentPath = path + spentSuffix
+
+	b, err = ioutil.ReadFile(e.spentPath)
+	if os.IsNotExist(err) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &e.spent); err != nil {
+		return nil, fmt.Errorf("invalid spent coins file %s: %v", e.spentPath, err)
+	}
+	if e.spent == nil {
+		e.spent = make(map[string]spending)
+	}
+
+	return e, nil
+}
+
+// save persists the coins sent by each device. It is called with the lock held.
+func (e *Engine) save() error {
+	if e.spentPath == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(e.spent)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so that a crash can't leave a truncated file
+	tmp, err := ioutil.TempFile(filepath.Dir(e.spentPath), filepath.Base(e.spentPath)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(b)
+	if syncErr := tmp.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), e.spentPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Authorization is an approved transaction, its coins count toward the device's daily limit
+type Authorization struct {
+	engine   *Engine
+	deviceID string
+	day      string
+	coins    uint64
+}
+
+// Coins returns the coins the transaction sends away
+func (a *Authorization) Coins() uint64 {
+	return a.coins
+}
+
+// Revoke returns the coins of a transaction that wasn't signed to the device's daily limit
+func (a *Authorization) Revoke() {
+	e := a.engine
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	s := e.spent[a.deviceID]
+	if s.Day != a.day {
+		return
+	}
+	if s.Coins < a.coins {
+		s.Coins = 0
+	} else {
+		s.Coins -= a.coins
+	}
+	e.spent[a.deviceID] = s
+
+	// if saving fails the persisted coins still count the revoked ones, the limit only gets stricter
+	e.save()
+}
+
+// Authorize evaluates the transaction outputs of a device against the policy. If the transaction
+// is approved, its coins are counted toward the device's daily limit until the authorization is revoked.
+func (e *Engine) Authorize(deviceID string, outputs []Output) (*Authorization, error) {
+	rules := e.policy.rules(deviceID)
+
+	if rules.MaxOutputs > 0 && len(outputs) > rules.MaxOutputs {
+		return nil, Violation{
+			Rule:   "max_outputs",
+			Reason: fmt.Sprintf("transaction has %d outputs, at most %d are allowed", len(outputs), rules.MaxOutputs),
+		}
+	}
+
+	var coins uint64
+	for i, o := range outputs {
+		if o.Change {
+			continue
+		}
+
+		if len(rules.AllowedDestinations) > 0 && !contains(rules.AllowedDestinations, o.Address) {
+			return nil, Violation{
+				Rule:   "allowed_destinations",
+				Reason: fmt.Sprintf("output %d: %s is not an allowed destination", i, o.Address),
+			}
+		}
+
+		if !hasHoursPerCoin(o, rules.MinHoursPerCoin.Value()) {
+			return nil, Violation{
+				Rule:   "min_hours_per_coin",
+				Reason: fmt.Sprintf("output %d: %d hours is less than %d hours per coin", i, o.Hours, rules.MinHoursPerCoin.Value()),
+			}
+		}
+
+		if coins+o.Coins < coins {
+			return nil, Violation{
+				Rule:   "daily_coin_limit",
+				Reason: "transaction coins overflow",
+			}
+		}
+		coins += o.Coins
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	day := e.now().UTC().Format("2006-01-02")
+	prev, ok := e.spent[deviceID]
+	s := prev
+	if s.Day != day {
+		s = spending{Day: day}
+	}
+
+	if limit := rules.DailyCoinLimit.Value(); limit > 0 && (s.Coins+coins < s.Coins || s.Coins+coins > limit) {
+		return nil, Violation{
+			Rule: "daily_coin_limit",
+			Reason: fmt.Sprintf("sending %s coins exceeds the daily limit of %s coins, %s were sent today",
+				formatCoins(coins), formatCoins(limit), formatCoins(s.Coins)),
+		}
+	}
+
+	s.Coins += coins
+	e.spent[deviceID] = s
+
+	// a transaction is only approved once its coins are saved, or a restart would forget them
+	if err := e.save(); err != nil {
+		if ok {
+			e.spent[deviceID] = prev
+		} else {
+			delete(e.spent, deviceID)
+		}
+		return nil, fmt.Errorf("saving the spent coins failed: %v", err)
+	}
+
+	return &Authorization{
+		engine:   e,
+		deviceID: deviceID,
+		day:      day,
+		coins:    coins,
+	}, nil
+}
+
+// hasHoursPerCoin reports whether the output carries at least minHoursPerCoin hours per coin
+func hasHoursPerCoin(o Output, minHoursPerCoin uint64) bool {
+	if minHoursPerCoin == 0 {
+		return true
+	}
+
+	// hours * dropletsPerCoin >= coins * minHoursPerCoin, the products may overflow uint64
+	hours := new(big.Int).Mul(new(big.Int).SetUint64(o.Hours), big.NewInt(dropletsPerCoin))
+	required := new(big.Int).Mul(new(big.Int).SetUint64(o.Coins), new(big.Int).SetUint64(minHoursPerCoin))
+	return hours.Cmp(required) >= 0
+}
+
+func contains(addresses []string, address string) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+func formatCoins(droplets uint64) string {
+	s, err := droplet.ToString(droplets)
+	if err != nil {
+		return fmt.Sprintf("%d droplets", droplets)
+	}
+	return s
+}
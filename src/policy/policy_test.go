@@ -0,0 +1,252 @@
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuthorize(t *testing.T) {
+	p := Policy{
+		Default: Rules{
+			MaxOutputs:      2,
+			MinHoursPerCoin: 2,
+		},
+		Devices: map[string]Rules{
+			"treasury": {
+				AllowedDestinations: []string{"allowed"},
+			},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		deviceID string
+		outputs  []Output
+		rule     string
+	}{
+		{
+			name: "approved",
+			outputs: []Output{
+				{Address: "a", Coins: 1000000, Hours: 2},
+				{Address: "change", Coins: 5000000, Change: true},
+			},
+		},
+		{
+			name: "too many outputs",
+			outputs: []Output{
+				{Address: "a", Coins: 1000000, Hours: 2},
+				{Address: "b", Coins: 1000000, Hours: 2},
+				{Address: "change", Coins: 1000000, Change: true},
+			},
+			rule: "max_outputs",
+		},
+		{
+			name: "too few hours",
+			outputs: []Output{
+				{Address: "a", Coins: 1500000, Hours: 2},
+			},
+			rule: "min_hours_per_coin",
+		},
+		{
+			name: "hours of a fraction of a coin",
+			outputs: []Output{
+				{Address: "a", Coins: 500000, Hours: 1},
+			},
+		},
+		{
+			name:     "allowed destination",
+			deviceID: "treasury",
+			outputs: []Output{
+				{Address: "allowed", Coins: 1000000},
+				{Address: "change", Coins: 1000000, Change: true},
+			},
+		},
+		{
+			name:     "other destination",
+			deviceID: "treasury",
+			outputs: []Output{
+				{Address: "other", Coins: 1000000},
+			},
+			rule: "allowed_destinations",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewEngine(p).Authorize(tc.deviceID, tc.outputs)
+			if tc.rule == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			v, ok := err.(Violation)
+			if !ok {
+				t.Fatalf("expected a Violation, got %v", err)
+			}
+			if v.Rule != tc.rule {
+				t.Fatalf("expected a %s violation, got %s", tc.rule, v.Rule)
+			}
+		})
+	}
+}
+
+func TestAuthorizeDailyCoinLimit(t *testing.T) {
+	e := NewEngine(Policy{
+		Default: Rules{DailyCoinLimit: 10000000},
+	})
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	send := func(deviceID string, coins uint64) (*Authorization, error) {
+		return e.Authorize(deviceID, []Output{
+			{Address: "a", Coins: coins},
+			{Address: "change", Coins: 100000000, Change: true},
+		})
+	}
+
+	if _, err := send("device", 6000000); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := send("device", 4000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := send("device", 1); err == nil {
+		t.Fatal("daily limit was exceeded")
+	}
+
+	// the limit is per device
+	if _, err := send("other", 10000000); err != nil {
+		t.Fatal(err)
+	}
+
+	// revoked coins can be sent again
+	auth.Revoke()
+	if _, err := send("device", 4000000); err != nil {
+		t.Fatal(err)
+	}
+
+	// the limit resets every day
+	now = now.Add(12 * time.Hour)
+	if _, err := send("device", 10000000); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(path, []byte(`{
+		"default": {"daily_coin_limit": "1.5", "min_hours_per_coin": "3"},
+		"devices": {"treasury": {"max_outputs": 2}}
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := e.policy.rules("device"); r.DailyCoinLimit != 1500000 || r.MinHoursPerCoin != 3 {
+		t.Fatalf("unexpected default rules %+v", r)
+	}
+	if r := e.policy.rules("treasury"); r.MaxOutputs != 2 || r.DailyCoinLimit != 0 {
+		t.Fatalf("unexpected device rules %+v", r)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"default": {"daily_coin_limit": "1.0000001"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("invalid coins were accepted")
+	}
+}
+
+func TestDailyCoinLimitSurvivesRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(path, []byte(`{"default": {"daily_coin_limit": "10"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	load := func() *Engine {
+		e, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.now = func() time.Time { return now }
+		return e
+	}
+	send := func(e *Engine, coins uint64) (*Authorization, error) {
+		return e.Authorize("device", []Output{{Address: "a", Coins: coins}})
+	}
+
+	e := load()
+	if _, err := send(e, 6000000); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := send(e, 3000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.Revoke()
+
+	// the restarted engine remembers the 6 coins sent, but not the revoked ones
+	e = load()
+	if _, err := send(e, 5000000); err == nil {
+		t.Fatal("daily limit was exceeded after a restart")
+	}
+	if _, err := send(e, 4000000); err != nil {
+		t.Fatal(err)
+	}
+
+	e = load()
+	if _, err := send(e, 1); err == nil {
+		t.Fatal("daily limit was exceeded after a restart")
+	}
+
+	// the saved coins only count on the day they were sent
+	now = now.Add(12 * time.Hour)
+	e = load()
+	if _, err := send(e, 10000000); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path+spentSuffix, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("an invalid spent coins file was accepted")
+	}
+}
+
+func TestAuthorizeSaveFails(t *testing.T) {
+	e := NewEngine(Policy{
+		Default: Rules{DailyCoinLimit: 10000000},
+	})
+	// the directory of the spent coins file doesn't exist
+	e.spentPath = filepath.Join(os.TempDir(), "policy-missing-dir", "policy.json"+spentSuffix)
+
+	if _, err := e.Authorize("device", []Output{{Address: "a", Coins: 1000000}}); err == nil {
+		t.Fatal("a transaction was approved without saving its coins")
+	}
+	if s, ok := e.spent["device"]; ok {
+		t.Fatalf("coins of a rejected transaction were counted: %+v", s)
+	}
+}
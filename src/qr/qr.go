@@ -0,0 +1,496 @@
+/*
+Package qr encodes short texts, such as payment URIs, in QR codes.
+
+Texts are encoded in byte mode in versions 1 to 10, up to 271 bytes at the lowest
+error correction level, which covers any skycoin payment URI with a short label.
+*/
+package qr
+
+import (
+	"errors"
+)
+
+// Level is an error correction level
+type Level int
+
+// Error correction levels, recovering about 7, 15, 25 and 30% of the codewords
+const (
+	L Level = iota
+	M
+	Q
+	H
+)
+
+// maxVersion is the largest version the encoder supports
+const maxVersion = 10
+
+// ErrTooLong is returned when a text doesn't fit in the largest supported version
+var ErrTooLong = errors.New("text is too long for a QR code")
+
+// blockLayout is the error correction block structure of a version and level:
+// group1 blocks of data1 data codewords, followed by group2 blocks of data1+1 data codewords,
+// each with ec error correction codewords
+type blockLayout struct {
+	ec     int
+	group1 int
+	data1  int
+	group2 int
+}
+
+// layouts is indexed by version-1 and level
+var layouts = [maxVersion][4]blockLayout{
+	{{7, 1, 19, 0}, {10, 1, 16, 0}, {13, 1, 13, 0}, {17, 1, 9, 0}},
+	{{10, 1, 34, 0}, {16, 1, 28, 0}, {22, 1, 22, 0}, {28, 1, 16, 0}},
+	{{15, 1, 55, 0}, {26, 1, 44, 0}, {18, 2, 17, 0}, {22, 2, 13, 0}},
+	{{20, 1, 80, 0}, {18, 2, 32, 0}, {26, 2, 24, 0}, {16, 4, 9, 0}},
+	{{26, 1, 108, 0}, {24, 2, 43, 0}, {18, 2, 15, 2}, {22, 2, 11, 2}},
+	{{18, 2, 68, 0}, {16, 4, 27, 0}, {24, 4, 19, 0}, {28, 4, 15, 0}},
+	{{20, 2, 78, 0}, {18, 4, 31, 0}, {18, 2, 14, 4}, {26, 4, 13, 1}},
+	{{24, 2, 97, 0}, {22, 2, 38, 2}, {22, 4, 18, 2}, {26, 4, 14, 2}},
+	{{30, 2, 116, 0}, {22, 3, 36, 2}, {20, 4, 16, 4}, {24, 4, 12, 4}},
+	{{18, 2, 68, 2}, {26, 4, 43, 1}, {24, 6, 19, 2}, {28, 6, 15, 2}},
+}
+
+// alignmentPositions are the row and column coordinates of the alignment pattern centers, by version-1
+var alignmentPositions = [maxVersion][]int{
+	nil,
+	{6, 18},
+	{6, 22},
+	{6, 26},
+	{6, 30},
+	{6, 34},
+	{6, 22, 38},
+	{6, 24, 42},
+	{6, 26, 46},
+	{6, 28, 50},
+}
+
+// formatLevelBits are the error correction level bits of the format information
+var formatLevelBits = [4]uint{L: 1, M: 0, Q: 3, H: 2}
+
+func (l blockLayout) dataCodewords() int {
+	return l.group1*l.data1 + l.group2*(l.data1+1)
+}
+
+// Code is a QR code
+type Code struct {
+	// Size is the number of modules of a side, without the quiet zone
+	Size    int
+	Version int
+	Level   Level
+	Mask    int
+
+	modules  [][]bool
+	function [][]bool
+}
+
+// Black reports whether the module at column x and row y is dark
+func (c *Code) Black(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+	return c.modules[y][x]
+}
+
+// Encode encodes a text in the smallest version fitting it at the error correction level
+func Encode(text string, level Level) (*Code, error) {
+	if level < L || level > H {
+		return nil, errors.New("invalid error correction level")
+	}
+
+	data := []byte(text)
+	version := 1
+	for ; version <= maxVersion; version++ {
+		// mode indicator and character count, the count has 16 bits from version 10
+		headerBits := 4 + 8
+		if version >= 10 {
+			headerBits = 4 + 16
+		}
+		if headerBits+8*len(data) <= 8*layouts[version-1][level].dataCodewords() {
+			break
+		}
+	}
+	if version > maxVersion {
+		return nil, ErrTooLong
+	}
+
+	c := newCode(version, level)
+	c.drawCodewords(c.codewords(data))
+
+	// choose the mask with the lowest penalty, the format information is part of the score
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			bestMask, bestPenalty = mask, p
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(bestMask)
+	c.drawFormat(bestMask)
+	c.Mask = bestMask
+
+	return c, nil
+}
+
+// newCode returns a code of the version with its function patterns drawn
+func newCode(version int, level Level) *Code {
+	size := 17 + 4*version
+	c := &Code{
+		Size:     size,
+		Version:  version,
+		Level:    level,
+		modules:  make([][]bool, size),
+		function: make([][]bool, size),
+	}
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.function[i] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(size-4, 3)
+	c.drawFinder(3, size-4)
+
+	positions := alignmentPositions[version-1]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// alignment patterns don't overlap the finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// reserve the format information, it is drawn once the mask is chosen
+	c.drawFormat(0)
+	c.drawVersion()
+
+	return c
+}
+
+// set sets a function module
+func (c *Code) set(x, y int, black bool) {
+	c.modules[y][x] = black
+	c.function[y][x] = true
+}
+
+// drawFinder draws a finder pattern and its separator around its center
+func (c *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			c.set(x, y, d != 2 && d != 4)
+		}
+	}
+}
+
+// drawAlignment draws an alignment pattern around its center
+func (c *Code) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormat draws both copies of the format information of the level and mask, and the dark module
+func (c *Code) drawFormat(mask int) {
+	bits := formatBits(c.Level, mask)
+	bit := func(i uint) bool {
+		return bits>>i&1 == 1
+	}
+
+	for i := uint(0); i <= 5; i++ {
+		c.set(8, int(i), bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := uint(9); i < 15; i++ {
+		c.set(14-int(i), 8, bit(i))
+	}
+
+	for i := uint(0); i < 8; i++ {
+		c.set(c.Size-1-int(i), 8, bit(i))
+	}
+	for i := uint(8); i < 15; i++ {
+		c.set(8, c.Size-15+int(i), bit(i))
+	}
+	c.set(8, c.Size-8, true)
+}
+
+// formatBits returns the 15 bits of format information, protected by a BCH code and masked
+func formatBits(level Level, mask int) uint {
+	data := formatLevelBits[level]<<3 | uint(mask)
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem&0x3ff) ^ 0x5412
+}
+
+// drawVersion draws both copies of the version information, from version 7
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+
+	bits := versionBits(c.Version)
+	for i := uint(0); i < 18; i++ {
+		black := bits>>i&1 == 1
+		a, b := c.Size-11+int(i%3), int(i/3)
+		c.set(a, b, black)
+		c.set(b, a, black)
+	}
+}
+
+// versionBits returns the 18 bits of version information, protected by a BCH code
+func versionBits(version int) uint {
+	rem := uint(version)
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1f25
+	}
+	return uint(version)<<12 | rem&0xfff
+}
+
+// codewords returns the interleaved data and error correction codewords of the data
+func (c *Code) codewords(data []byte) []byte {
+	layout := layouts[c.Version-1][c.Level]
+
+	var b bitBuffer
+	b.append(4, 4)
+	if c.Version >= 10 {
+		b.append(uint(len(data)), 16)
+	} else {
+		b.append(uint(len(data)), 8)
+	}
+	for _, d := range data {
+		b.append(uint(d), 8)
+	}
+
+	capacity := 8 * layout.dataCodewords()
+	terminator := capacity - b.len
+	if terminator > 4 {
+		terminator = 4
+	}
+	b.append(0, terminator)
+	if r := b.len % 8; r != 0 {
+		b.append(0, 8-r)
+	}
+	for pad := uint(0xec); b.len < capacity; pad ^= 0xec ^ 0x11 {
+		b.append(pad, 8)
+	}
+
+	blocks := make([][]byte, layout.group1+layout.group2)
+	ecBlocks := make([][]byte, len(blocks))
+	divisor := rsDivisor(layout.ec)
+	offset := 0
+	for i := range blocks {
+		n := layout.data1
+		if i >= layout.group1 {
+			n++
+		}
+		blocks[i] = b.bytes[offset : offset+n]
+		ecBlocks[i] = rsRemainder(blocks[i], divisor)
+		offset += n
+	}
+
+	var result []byte
+	for i := 0; i <= layout.data1; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ec; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+
+	return result
+}
+
+// drawCodewords places the codewords in the zigzag order, the remainder modules stay light
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		// the vertical timing pattern is skipped
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.function[y][x] || i >= 8*len(codewords) {
+					continue
+				}
+				c.modules[y][x] = codewords[i/8]>>(7-uint(i%8))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by the mask, applying it twice removes it
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.function[y][x] {
+				continue
+			}
+
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// finderLike are the 11 module sequences penalized because they look like a finder pattern
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty scores the readability of the code, lower is better
+func (c *Code) penalty() int {
+	penalty := 0
+
+	line := func(i, j int, columns bool) bool {
+		if columns {
+			return c.modules[j][i]
+		}
+		return c.modules[i][j]
+	}
+
+	for _, columns := range []bool{false, true} {
+		for i := 0; i < c.Size; i++ {
+			// runs of five or more modules of the same color
+			run := 1
+			for j := 1; j < c.Size; j++ {
+				if line(i, j, columns) == line(i, j-1, columns) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				penalty += run - 2
+			}
+
+			for j := 0; j+11 <= c.Size; j++ {
+				for _, pattern := range finderLike {
+					match := true
+					for k, black := range pattern {
+						if line(i, j+k, columns) != black {
+							match = false
+							break
+						}
+					}
+					if match {
+						penalty += 40
+					}
+				}
+			}
+		}
+	}
+
+	// 2x2 blocks of the same color
+	for y := 0; y+1 < c.Size; y++ {
+		for x := 0; x+1 < c.Size; x++ {
+			m := c.modules[y][x]
+			if m == c.modules[y][x+1] && m == c.modules[y+1][x] && m == c.modules[y+1][x+1] {
+				penalty += 3
+			}
+		}
+	}
+
+	// deviation of the proportion of dark modules from 50%
+	dark := 0
+	for _, row := range c.modules {
+		for _, m := range row {
+			if m {
+				dark++
+			}
+		}
+	}
+	percent := dark * 100 / (c.Size * c.Size)
+	penalty += abs(percent-50) / 5 * 10
+
+	return penalty
+}
+
+// bitBuffer is a big endian sequence of bits
+type bitBuffer struct {
+	bytes []byte
+	len   int
+}
+
+// append appends the n low bits of v
+func (b *bitBuffer) append(v uint, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if b.len%8 == 0 {
+			b.bytes = append(b.bytes, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			b.bytes[b.len/8] |= 0x80 >> uint(b.len%8)
+		}
+		b.len++
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,202 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// HELLO WORLD at version 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if ec := rsRemainder(data, rsDivisor(10)); !bytes.Equal(ec, expected) {
+		t.Fatalf("expected %v, got %v", expected, ec)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	formats := map[Level]uint{L: 0x77c4, M: 0x5412, Q: 0x355f, H: 0x1689}
+	for level, expected := range formats {
+		if bits := formatBits(level, 0); bits != expected {
+			t.Errorf("level %d: expected %015b, got %015b", level, expected, bits)
+		}
+	}
+
+	versions := map[int]uint{7: 0x07c94, 10: 0x0a4d3}
+	for version, expected := range versions {
+		if bits := versionBits(version); bits != expected {
+			t.Errorf("version %d: expected %018b, got %018b", version, expected, bits)
+		}
+	}
+}
+
+// decode reads the text back from the code, checking its format information and error correction codewords
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+
+	var format uint
+	for i := uint(0); i <= 5; i++ {
+		format |= b2u(c.modules[i][8]) << i
+	}
+	format |= b2u(c.modules[7][8])<<6 | b2u(c.modules[8][8])<<7 | b2u(c.modules[8][7])<<8
+	for i := uint(9); i < 15; i++ {
+		format |= b2u(c.modules[8][14-i]) << i
+	}
+	if format != formatBits(c.Level, c.Mask) {
+		t.Fatalf("format information %015b doesn't match level %d and mask %d", format, c.Level, c.Mask)
+	}
+
+	// read the codewords back in the placement order
+	unmasked := newCode(c.Version, c.Level)
+	for y := range c.modules {
+		copy(unmasked.modules[y], c.modules[y])
+	}
+	unmasked.applyMask(c.Mask)
+
+	var b bitBuffer
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				if x := right - j; !unmasked.function[y][x] {
+					b.append(b2u(unmasked.modules[y][x]), 1)
+				}
+			}
+		}
+	}
+
+	layout := layouts[c.Version-1][c.Level]
+	blocks := make([][]byte, layout.group1+layout.group2)
+	n := 0
+	for i := 0; i <= layout.data1; i++ {
+		for k := range blocks {
+			if i < layout.data1 || k >= layout.group1 {
+				blocks[k] = append(blocks[k], b.bytes[n])
+				n++
+			}
+		}
+	}
+
+	var data []byte
+	divisor := rsDivisor(layout.ec)
+	for k, block := range blocks {
+		ec := make([]byte, layout.ec)
+		for i := range ec {
+			ec[i] = b.bytes[n+i*len(blocks)+k]
+		}
+		if !bytes.Equal(rsRemainder(block, divisor), ec) {
+			t.Fatalf("block %d has invalid error correction codewords", k)
+		}
+		data = append(data, block...)
+	}
+
+	if data[0]>>4 != 4 {
+		t.Fatalf("unexpected mode %d", data[0]>>4)
+	}
+	if c.Version >= 10 {
+		length := int(data[0]&0xf)<<12 | int(data[1])<<4 | int(data[2]>>4)
+		return string(shift(data[2:], length))
+	}
+	length := int(data[0]&0xf)<<4 | int(data[1]>>4)
+	return string(shift(data[1:], length))
+}
+
+// shift returns n bytes starting at the low nibble of b[0]
+func shift(b []byte, n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = b[i]<<4 | b[i+1]>>4
+	}
+	return out
+}
+
+func b2u(b bool) uint {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestEncode(t *testing.T) {
+	cases := []struct {
+		text    string
+		level   Level
+		version int
+	}{
+		{"hello", M, 1},
+		{"skycoin:2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv", M, 4},
+		{"skycoin:2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv?amount=123.456&label=rent", Q, 6},
+		{strings.Repeat("x", 200), L, 9},
+		{strings.Repeat("y", 271), L, 10},
+		{strings.Repeat("z", 98), H, 9},
+		{strings.Repeat("z", 99), H, 10},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.text, func(t *testing.T) {
+			c, err := Encode(tc.text, tc.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Version != tc.version || c.Size != 17+4*tc.version {
+				t.Fatalf("expected version %d, got %d of size %d", tc.version, c.Version, c.Size)
+			}
+
+			// finder pattern centers and the dark module
+			for _, p := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}, {8, c.Size - 8}} {
+				if !c.Black(p[0], p[1]) {
+					t.Fatalf("module %v should be dark", p)
+				}
+			}
+
+			if text := decode(t, c); text != tc.text {
+				t.Fatalf("decoded %q", text)
+			}
+		})
+	}
+
+	if _, err := Encode(strings.Repeat("x", 272), L); err != ErrTooLong {
+		t.Fatalf("expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode("hello", M)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.WritePNG(&buf, 2); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if side := (21 + 2*QuietZone) * 2; img.Bounds().Dx() != side || img.Bounds().Dy() != side {
+		t.Fatalf("unexpected bounds %v", img.Bounds())
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Fatal("quiet zone should be light")
+	}
+	if r, _, _, _ := img.At(2*QuietZone, 2*QuietZone).RGBA(); r != 0 {
+		t.Fatal("finder pattern corner should be dark")
+	}
+
+	svg := c.SVG(4)
+	if !strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="116" height="116" viewBox="0 0 29 29"`) ||
+		!strings.Contains(svg, "M4,4h1v1h-1z") {
+		t.Fatalf("unexpected svg %s", svg)
+	}
+}
@@ -0,0 +1,52 @@
+package qr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// QuietZone is the number of light modules around the code
+const QuietZone = 4
+
+// Image renders the code with its quiet zone, each module being a square of scale pixels
+func (c *Code) Image(scale int) *image.Gray {
+	side := (c.Size + 2*QuietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for py := 0; py < side; py++ {
+		for px := 0; px < side; px++ {
+			v := color.Gray{Y: 0xff}
+			if c.Black(px/scale-QuietZone, py/scale-QuietZone) {
+				v.Y = 0
+			}
+			img.SetGray(px, py, v)
+		}
+	}
+	return img
+}
+
+// WritePNG writes the code as a PNG image, each module being a square of scale pixels
+func (c *Code) WritePNG(w io.Writer, scale int) error {
+	return png.Encode(w, c.Image(scale))
+}
+
+// SVG renders the code with its quiet zone as an SVG image, each module being a square of scale pixels
+func (c *Code) SVG(scale int) string {
+	side := c.Size + 2*QuietZone
+
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Black(x, y) {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+QuietZone, y+QuietZone)
+			}
+		}
+	}
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#ffffff"/><path d="%s" fill="#000000"/></svg>`,
+		side*scale, side*scale, side, side, path.String())
+}
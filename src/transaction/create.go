@@ -0,0 +1,239 @@
+package transaction
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+const (
+	// BurnFactor is the inverse of the fraction of the input coin hours a transaction must burn
+	BurnFactor = 2
+	// MaxInputs is the most inputs the hardware wallet signs in a transaction
+	MaxInputs = 8
+	// MaxOutputs is the most outputs the hardware wallet signs in a transaction
+	MaxOutputs = 8
+	// dropletPrecision is the smallest number of droplets an output may hold, coins have 3 decimals
+	dropletPrecision = 1000
+)
+
+var (
+	// ErrNoDestinations is returned when a transaction has no destination
+	ErrNoDestinations = errors.New("no destinations")
+	// ErrZeroCoins is returned when a destination receives no coins
+	ErrZeroCoins = errors.New("destination coins cannot be zero")
+	// ErrCoinsPrecision is returned when a destination receives a fraction of coins smaller than 0.001
+	ErrCoinsPrecision = errors.New("destination coins have more than 3 decimal places")
+	// ErrInsufficientBalance is returned when the unspent outputs don't hold enough coins
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// ErrInsufficientHours is returned when the unspent outputs don't hold enough coin hours
+	ErrInsufficientHours = errors.New("insufficient coin hours")
+	// ErrTooManyInputs is returned when more than MaxInputs outputs must be spent
+	ErrTooManyInputs = errors.New("too many unspent outputs must be spent, the hardware wallet signs at most 8 inputs")
+	// ErrTooManyOutputs is returned when a transaction would have more than MaxOutputs outputs
+	ErrTooManyOutputs = errors.New("too many outputs, the hardware wallet signs at most 8 outputs")
+	// ErrOverflow is returned when the coins or hours of a transaction overflow
+	ErrOverflow = errors.New("coins or hours overflow")
+)
+
+// UnspentOutput is an output that can be spent by a transaction
+type UnspentOutput struct {
+	Hash    cipher.SHA256
+	Address cipher.Address
+	Coins   uint64
+	// Hours are the coin hours the output holds now
+	Hours uint64
+}
+
+// Destination is an output to create
+type Destination struct {
+	Address cipher.Address
+	Coins   uint64
+	// Hours are the coin hours sent to the destination. If nil, the destination receives
+	// a share of the hours proportional to its coins.
+	Hours *uint64
+}
+
+// Spend is a transaction spending unspent outputs
+type Spend struct {
+	Inputs  []UnspentOutput
+	Outputs []Output
+	// Change is the index of the change output, -1 if there is no change
+	Change int
+	// Fee is the number of coin hours burned
+	Fee uint64
+}
+
+// RequiredFee returns the coin hours a transaction spending hours must burn
+func RequiredFee(hours uint64) uint64 {
+	fee := hours / BurnFactor
+	if hours%BurnFactor != 0 {
+		fee++
+	}
+	return fee
+}
+
+// CheckCoins checks that an output holds a number of coins the network accepts
+func CheckCoins(coins uint64) error {
+	if coins == 0 {
+		return ErrZeroCoins
+	}
+	if coins%dropletPrecision != 0 {
+		return ErrCoinsPrecision
+	}
+	return nil
+}
+
+// Create selects unspent outputs to send coins to the destinations, burns the required fee and
+// distributes the remaining coin hours. Outputs holding more coins are spent first. Change is sent
+// to changeAddress, or to the address of the first spent output if it is nil. Half of the hours
+// that are not sent explicitly are shared by the destinations proportionally to their coins,
+// the change keeps the rest.
+func Create(unspents []UnspentOutput, destinations []Destination, changeAddress *cipher.Address) (*Spend, error) {
+	if len(destinations) == 0 {
+		return nil, ErrNoDestinations
+	}
+
+	var coins, hours, autoCoins uint64
+	for _, d := range destinations {
+		if err := CheckCoins(d.Coins); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if coins, err = add(coins, d.Coins); err != nil {
+			return nil, err
+		}
+		if d.Hours != nil {
+			if hours, err = add(hours, *d.Hours); err != nil {
+				return nil, err
+			}
+		} else {
+			autoCoins += d.Coins
+		}
+	}
+
+	inputs, inputCoins, inputHours, err := selectUnspents(unspents, coins, hours)
+	if err != nil {
+		return nil, err
+	}
+
+	fee := RequiredFee(inputHours)
+	shareable := inputHours - fee - hours
+	changeCoins := inputCoins - coins
+
+	// without change, the hours the destinations don't receive are burned
+	autoHours := shareable
+	if changeCoins != 0 {
+		autoHours = shareable / 2
+	}
+
+	spend := &Spend{
+		Inputs: inputs,
+		Change: -1,
+	}
+
+	var distributed uint64
+	for _, d := range destinations {
+		o := Output{
+			Address: d.Address,
+			Coins:   d.Coins,
+		}
+		if d.Hours != nil {
+			o.Hours = *d.Hours
+		} else {
+			o.Hours = share(autoHours, d.Coins, autoCoins)
+			distributed += o.Hours
+		}
+		spend.Outputs = append(spend.Outputs, o)
+	}
+
+	if changeCoins != 0 {
+		if changeAddress == nil {
+			changeAddress = &inputs[0].Address
+		}
+		spend.Change = len(spend.Outputs)
+		spend.Outputs = append(spend.Outputs, Output{
+			Address: *changeAddress,
+			Coins:   changeCoins,
+			Hours:   shareable - distributed,
+		})
+	}
+
+	if len(spend.Outputs) > MaxOutputs {
+		return nil, ErrTooManyOutputs
+	}
+
+	var outputHours uint64
+	for _, o := range spend.Outputs {
+		outputHours += o.Hours
+	}
+	spend.Fee = inputHours - outputHours
+
+	return spend, nil
+}
+
+// selectUnspents picks the unspent outputs holding the most coins until they hold coins and,
+// once the fee is burned, hours
+func selectUnspents(unspents []UnspentOutput, coins, hours uint64) ([]UnspentOutput, uint64, uint64, error) {
+	sorted := make([]UnspentOutput, len(unspents))
+	copy(sorted, unspents)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Coins != b.Coins {
+			return a.Coins > b.Coins
+		}
+		if a.Hours != b.Hours {
+			return a.Hours > b.Hours
+		}
+		return bytes.Compare(a.Hash[:], b.Hash[:]) < 0
+	})
+
+	var selected []UnspentOutput
+	var inputCoins, inputHours uint64
+	for _, u := range sorted {
+		if inputCoins >= coins && inputHours != 0 && inputHours-RequiredFee(inputHours) >= hours {
+			return selected, inputCoins, inputHours, nil
+		}
+		if len(selected) == MaxInputs {
+			return nil, 0, 0, ErrTooManyInputs
+		}
+
+		var err error
+		if inputCoins, err = add(inputCoins, u.Coins); err != nil {
+			return nil, 0, 0, err
+		}
+		if inputHours, err = add(inputHours, u.Hours); err != nil {
+			return nil, 0, 0, err
+		}
+		selected = append(selected, u)
+	}
+
+	switch {
+	case inputCoins < coins:
+		return nil, 0, 0, ErrInsufficientBalance
+	case inputHours == 0 || inputHours-RequiredFee(inputHours) < hours:
+		return nil, 0, 0, ErrInsufficientHours
+	}
+
+	return selected, inputCoins, inputHours, nil
+}
+
+// share returns the part of hours proportional to coins out of total, rounded down
+func share(hours, coins, total uint64) uint64 {
+	if total == 0 {
+		return 0
+	}
+	n := new(big.Int).Mul(new(big.Int).SetUint64(hours), new(big.Int).SetUint64(coins))
+	return n.Div(n, new(big.Int).SetUint64(total)).Uint64()
+}
+
+func add(a, b uint64) (uint64, error) {
+	if a+b < a {
+		return 0, ErrOverflow
+	}
+	return a + b, nil
+}
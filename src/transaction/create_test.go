@@ -0,0 +1,146 @@
+package transaction
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+func testAddress(t *testing.T, seed string) cipher.Address {
+	_, sk, err := cipher.GenerateDeterministicKeyPair([]byte(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher.MustAddressFromSecKey(sk)
+}
+
+func TestCreate(t *testing.T) {
+	own := testAddress(t, "own")
+	other := testAddress(t, "other")
+	dest := testAddress(t, "dest")
+
+	unspent := func(seed string, address cipher.Address, coins, hours uint64) UnspentOutput {
+		return UnspentOutput{
+			Hash:    cipher.SumSHA256([]byte(seed)),
+			Address: address,
+			Coins:   coins,
+			Hours:   hours,
+		}
+	}
+	small := unspent("small", other, 1000000, 100)
+	large := unspent("large", own, 5000000, 11)
+	hours := func(n uint64) *uint64 {
+		return &n
+	}
+
+	cases := []struct {
+		name         string
+		unspents     []UnspentOutput
+		destinations []Destination
+		change       *cipher.Address
+		spend        *Spend
+		err          error
+	}{
+		{
+			name:         "shared hours and change",
+			unspents:     []UnspentOutput{small, large},
+			destinations: []Destination{{Address: dest, Coins: 2000000}},
+			spend: &Spend{
+				Inputs: []UnspentOutput{large},
+				// 11 hours, 6 are burned, 2 of the 5 left are shared
+				Outputs: []Output{
+					{Address: dest, Coins: 2000000, Hours: 2},
+					{Address: own, Coins: 3000000, Hours: 3},
+				},
+				Change: 1,
+				Fee:    6,
+			},
+		},
+		{
+			name:         "no change",
+			unspents:     []UnspentOutput{small, large},
+			destinations: []Destination{{Address: dest, Coins: 6000000}},
+			spend: &Spend{
+				Inputs: []UnspentOutput{large, small},
+				Outputs: []Output{
+					{Address: dest, Coins: 6000000, Hours: 55},
+				},
+				Change: -1,
+				Fee:    56,
+			},
+		},
+		{
+			name:         "explicit hours spend more outputs",
+			unspents:     []UnspentOutput{small, large},
+			destinations: []Destination{{Address: dest, Coins: 1000000, Hours: hours(20)}},
+			change:       &other,
+			spend: &Spend{
+				Inputs: []UnspentOutput{large, small},
+				Outputs: []Output{
+					{Address: dest, Coins: 1000000, Hours: 20},
+					{Address: other, Coins: 5000000, Hours: 35},
+				},
+				Change: 1,
+				Fee:    56,
+			},
+		},
+		{
+			name:         "insufficient balance",
+			unspents:     []UnspentOutput{small, large},
+			destinations: []Destination{{Address: dest, Coins: 7000000}},
+			err:          ErrInsufficientBalance,
+		},
+		{
+			name:         "insufficient hours",
+			unspents:     []UnspentOutput{small, large},
+			destinations: []Destination{{Address: dest, Coins: 1000000, Hours: hours(100)}},
+			err:          ErrInsufficientHours,
+		},
+		{
+			name:         "no hours",
+			unspents:     []UnspentOutput{unspent("no hours", own, 1000000, 0)},
+			destinations: []Destination{{Address: dest, Coins: 1000000}},
+			err:          ErrInsufficientHours,
+		},
+		{
+			name:         "coins precision",
+			unspents:     []UnspentOutput{large},
+			destinations: []Destination{{Address: dest, Coins: 1000100}},
+			err:          ErrCoinsPrecision,
+		},
+		{
+			name:     "no destinations",
+			unspents: []UnspentOutput{large},
+			err:      ErrNoDestinations,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spend, err := Create(tc.unspents, tc.destinations, tc.change)
+			if err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(spend, tc.spend) {
+				t.Fatalf("expected %+v, got %+v", tc.spend, spend)
+			}
+		})
+	}
+}
+
+func TestCreateTooManyInputs(t *testing.T) {
+	var unspents []UnspentOutput
+	for i := 0; i < MaxInputs+1; i++ {
+		unspents = append(unspents, UnspentOutput{
+			Hash:  cipher.SumSHA256([]byte{byte(i)}),
+			Coins: 1000000,
+			Hours: 1,
+		})
+	}
+
+	_, err := Create(unspents, []Destination{{Coins: 9000000}}, nil)
+	if err != ErrTooManyInputs {
+		t.Fatalf("expected ErrTooManyInputs, got %v", err)
+	}
+}
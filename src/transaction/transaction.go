@@ -0,0 +1,203 @@
+/*
+Package transaction implements the parts of the Skycoin transaction format needed to sign transactions with a hardware wallet.
+*/
+package transaction
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+// Output is a Skycoin transaction output
+type Output struct {
+	Address cipher.Address
+	Coins   uint64
+	Hours   uint64
+}
+
+// Transaction is a Skycoin transaction
+type Transaction struct {
+	// Length is the size of the serialized transaction
+	Length uint32
+	Type   uint8
+	// InnerHash is the hash of the inputs and outputs
+	InnerHash cipher.SHA256
+	// Sigs are the signatures of the inputs, in the same order
+	Sigs []cipher.Sig
+	In   []cipher.SHA256
+	Out  []Output
+}
+
+// headerSize is the size of the serialized Length, Type and InnerHash
+const headerSize = 4 + 1 + 32
+
+// Size returns the size of the serialized transaction
+func (t *Transaction) Size() int {
+	return headerSize + 4 + len(t.Sigs)*len(cipher.Sig{}) + 4 + len(t.In)*32 + 4 + len(t.Out)*37
+}
+
+// UpdateHeader sets the Length and InnerHash of the transaction from its contents
+func (t *Transaction) UpdateHeader() {
+	t.Length = uint32(t.Size())
+	t.InnerHash = HashInner(t.In, t.Out)
+}
+
+// Serialize returns the binary encoding of the transaction
+func (t *Transaction) Serialize() []byte {
+	b := make([]byte, 0, t.Size())
+	b = appendUint32(b, t.Length)
+	b = append(b, t.Type)
+	b = append(b, t.InnerHash[:]...)
+
+	b = appendUint32(b, uint32(len(t.Sigs)))
+	for _, sig := range t.Sigs {
+		b = append(b, sig[:]...)
+	}
+
+	b = appendInputs(b, t.In)
+	return appendOutputs(b, t.Out)
+}
+
+// ErrTruncated is returned when a serialized transaction ends before its contents
+var ErrTruncated = errors.New("serialized transaction is truncated")
+
+// Deserialize decodes a serialized transaction
+func Deserialize(b []byte) (*Transaction, error) {
+	d := decoder{b: b}
+	t := &Transaction{}
+
+	t.Length = d.uint32()
+	t.Type = d.byte()
+	copy(t.InnerHash[:], d.next(32))
+
+	t.Sigs = make([]cipher.Sig, d.count(len(cipher.Sig{})))
+	for i := range t.Sigs {
+		copy(t.Sigs[i][:], d.next(len(cipher.Sig{})))
+	}
+
+	t.In = make([]cipher.SHA256, d.count(32))
+	for i := range t.In {
+		copy(t.In[i][:], d.next(32))
+	}
+
+	t.Out = make([]Output, d.count(37))
+	for i := range t.Out {
+		t.Out[i].Address.Version = d.byte()
+		copy(t.Out[i].Address.Key[:], d.next(20))
+		t.Out[i].Coins = d.uint64()
+		t.Out[i].Hours = d.uint64()
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.b) != 0 {
+		return nil, fmt.Errorf("serialized transaction has %d trailing bytes", len(d.b))
+	}
+	if int(t.Length) != len(b) {
+		return nil, fmt.Errorf("transaction length %d does not match its size %d", t.Length, len(b))
+	}
+
+	return t, nil
+}
+
+// Hash returns the transaction ID, the hash of the serialized transaction
+func (t *Transaction) Hash() cipher.SHA256 {
+	return cipher.SumSHA256(t.Serialize())
+}
+
+// VerifyInput checks that the signature of the input at index i was made by address
+func (t *Transaction) VerifyInput(i int, address cipher.Address) error {
+	if i >= len(t.Sigs) {
+		return fmt.Errorf("input %d has no signature", i)
+	}
+	return cipher.VerifyAddressSignedHash(address, t.Sigs[i], SignatureHash(t.InnerHash, t.In[i]))
+}
+
+// HashInner returns the inner hash of a transaction, the hash of its serialized inputs and outputs
+func HashInner(inputs []cipher.SHA256, outputs []Output) cipher.SHA256 {
+	b := make([]byte, 0, 4+len(inputs)*32+4+len(outputs)*37)
+	b = appendInputs(b, inputs)
+	b = appendOutputs(b, outputs)
+	return cipher.SumSHA256(b)
+}
+
+// SignatureHash returns the hash signed for the input at the given inner hash
+func SignatureHash(innerHash, input cipher.SHA256) cipher.SHA256 {
+	return cipher.AddSHA256(innerHash, input)
+}
+
+func appendUint32(b []byte, n uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], n)
+	return append(b, buf[:]...)
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], n)
+	return append(b, buf[:]...)
+}
+
+func appendInputs(b []byte, inputs []cipher.SHA256) []byte {
+	b = appendUint32(b, uint32(len(inputs)))
+	for _, in := range inputs {
+		b = append(b, in[:]...)
+	}
+	return b
+}
+
+func appendOutputs(b []byte, outputs []Output) []byte {
+	b = appendUint32(b, uint32(len(outputs)))
+	for _, o := range outputs {
+		b = append(b, o.Address.Version)
+		b = append(b, o.Address.Key[:]...)
+		b = appendUint64(b, o.Coins)
+		b = appendUint64(b, o.Hours)
+	}
+	return b
+}
+
+// decoder reads a serialized transaction, once it fails it returns zero values
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || len(d.b) < n {
+		d.err = ErrTruncated
+		return make([]byte, n)
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	return d.next(1)[0]
+}
+
+func (d *decoder) uint32() uint32 {
+	return binary.LittleEndian.Uint32(d.next(4))
+}
+
+func (d *decoder) uint64() uint64 {
+	return binary.LittleEndian.Uint64(d.next(8))
+}
+
+// count reads the length of a list of elements of the given size, it fails if the remaining
+// bytes can't hold the list
+func (d *decoder) count(size int) int {
+	n := d.uint32()
+	if d.err == nil && uint64(n)*uint64(size) > uint64(len(d.b)) {
+		d.err = ErrTruncated
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(n)
+}
@@ -0,0 +1,65 @@
+package transaction
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+func TestSerialize(t *testing.T) {
+	txn := Transaction{
+		Sigs: []cipher.Sig{{1}, {2}},
+		In:   []cipher.SHA256{cipher.SumSHA256([]byte("a")), cipher.SumSHA256([]byte("b"))},
+		Out: []Output{
+			{Address: testAddress(t, "dest"), Coins: 1000000, Hours: 2},
+		},
+	}
+	txn.UpdateHeader()
+
+	b := txn.Serialize()
+	if int(txn.Length) != len(b) {
+		t.Fatalf("length %d does not match the serialized size %d", txn.Length, len(b))
+	}
+	if txn.InnerHash != HashInner(txn.In, txn.Out) {
+		t.Fatal("inner hash was not updated")
+	}
+	if txn.Hash() != cipher.SumSHA256(b) {
+		t.Fatal("hash is not the hash of the serialized transaction")
+	}
+}
+
+func TestDeserialize(t *testing.T) {
+	txn := Transaction{
+		Sigs: []cipher.Sig{{1}},
+		In:   []cipher.SHA256{cipher.SumSHA256([]byte("a"))},
+		Out: []Output{
+			{Address: testAddress(t, "dest"), Coins: 1000000, Hours: 2},
+			{Address: testAddress(t, "change"), Coins: 3000000, Hours: 1},
+		},
+	}
+	txn.UpdateHeader()
+	b := txn.Serialize()
+
+	decoded, err := Deserialize(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*decoded, txn) {
+		t.Fatalf("expected %+v, got %+v", txn, *decoded)
+	}
+
+	if _, err := Deserialize(b[:len(b)-1]); err != ErrTruncated {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+	if _, err := Deserialize(append(b, 0)); err == nil {
+		t.Fatal("trailing bytes were accepted")
+	}
+
+	// a count larger than the remaining bytes must not allocate
+	b[headerSize] = 0xff
+	b[headerSize+3] = 0xff
+	if _, err := Deserialize(b); err != ErrTruncated {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Package uri encodes and parses skycoin payment URIs:
+
+	skycoin:2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv?amount=12.5&hours=10&label=rent&message=march
+
+All the query parameters are optional, amount is in coins and hours is a number of coin hours.
+Unknown parameters are ignored, except those prefixed with req- which the payer must understand.
+*/
+package uri
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/util/droplet"
+)
+
+// Scheme is the scheme of skycoin payment URIs
+const Scheme = "skycoin"
+
+// ErrScheme is returned when parsing a URI which isn't a skycoin URI
+var ErrScheme = errors.New("not a skycoin: URI")
+
+// URI is a skycoin payment URI
+type URI struct {
+	Address string
+	// Coins is the requested amount in droplets, 0 if unset
+	Coins uint64
+	// Hours is the requested amount of coin hours, 0 if unset
+	Hours   uint64
+	Label   string
+	Message string
+}
+
+// Encode encodes the URI, it fails if the amount can't be formatted as coins
+func (u URI) Encode() (string, error) {
+	var params []string
+	if u.Coins != 0 {
+		coins, err := droplet.ToString(u.Coins)
+		if err != nil {
+			return "", err
+		}
+		// trailing zeros of the decimals are dropped, 12.500000 is encoded as 12.5
+		coins = strings.TrimRight(strings.TrimRight(coins, "0"), ".")
+		params = append(params, "amount="+coins)
+	}
+	if u.Hours != 0 {
+		params = append(params, "hours="+strconv.FormatUint(u.Hours, 10))
+	}
+	if u.Label != "" {
+		params = append(params, "label="+escape(u.Label))
+	}
+	if u.Message != "" {
+		params = append(params, "message="+escape(u.Message))
+	}
+
+	s := Scheme + ":" + u.Address
+	if len(params) != 0 {
+		s += "?" + strings.Join(params, "&")
+	}
+	return s, nil
+}
+
+// escape escapes a query value, spaces are encoded as %20 as wallets don't all decode +
+func escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// Parse parses and validates a skycoin payment URI. The scheme is case insensitive and
+// skycoin://address is accepted as well.
+func Parse(s string) (URI, error) {
+	s = strings.TrimSpace(s)
+	if len(s) <= len(Scheme) || !strings.EqualFold(s[:len(Scheme)+1], Scheme+":") {
+		return URI{}, ErrScheme
+	}
+	s = strings.TrimPrefix(s[len(Scheme)+1:], "//")
+
+	address, rawQuery := s, ""
+	if i := strings.IndexByte(s, '?'); i != -1 {
+		address, rawQuery = s[:i], s[i+1:]
+	}
+	address = strings.TrimSuffix(address, "/")
+
+	if _, err := cipher.DecodeBase58Address(address); err != nil {
+		return URI{}, fmt.Errorf("invalid address: %v", err)
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return URI{}, fmt.Errorf("invalid query: %v", err)
+	}
+
+	u := URI{
+		Address: address,
+	}
+	for name, values := range query {
+		if len(values) != 1 {
+			return URI{}, fmt.Errorf("%s is set %d times", name, len(values))
+		}
+		v := values[0]
+
+		switch name {
+		case "amount":
+			if !isDecimal(v) {
+				return URI{}, fmt.Errorf("invalid amount %q", v)
+			}
+			u.Coins, err = droplet.FromString(v)
+			if err != nil {
+				return URI{}, fmt.Errorf("invalid amount: %v", err)
+			}
+		case "hours":
+			u.Hours, err = strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return URI{}, fmt.Errorf("invalid hours: %v", err)
+			}
+		case "label":
+			u.Label = v
+		case "message":
+			u.Message = v
+		default:
+			if strings.HasPrefix(name, "req-") {
+				return URI{}, fmt.Errorf("unsupported required parameter %s", name)
+			}
+		}
+	}
+
+	return u, nil
+}
+
+// isDecimal reports whether s is a plain decimal number, droplet.FromString also accepts exponents and signs
+func isDecimal(s string) bool {
+	digits, dot := 0, false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.' && !dot:
+			dot = true
+		default:
+			return false
+		}
+	}
+	return digits != 0
+}
@@ -0,0 +1,167 @@
+package uri
+
+import (
+	"testing"
+
+	"github.com/skycoin/skycoin/src/util/droplet"
+)
+
+func TestEncode(t *testing.T) {
+	const address = "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv"
+
+	cases := []struct {
+		name     string
+		uri      URI
+		expected string
+		err      error
+	}{
+		{
+			name:     "address only",
+			uri:      URI{Address: address},
+			expected: "skycoin:" + address,
+		},
+		{
+			name: "all parameters",
+			uri: URI{
+				Address: address,
+				Coins:   12500000,
+				Hours:   10,
+				Label:   "rent & bills",
+				Message: "march 2026",
+			},
+			expected: "skycoin:" + address + "?amount=12.5&hours=10&label=rent%20%26%20bills&message=march%202026",
+		},
+		{
+			name:     "whole coins",
+			uri:      URI{Address: address, Coins: 3000000},
+			expected: "skycoin:" + address + "?amount=3",
+		},
+		{
+			name: "amount too large",
+			uri:  URI{Address: address, Coins: 1 << 63},
+			err:  droplet.ErrTooLarge,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := tc.uri.Encode()
+			if err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if s != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, s)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	const address = "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv"
+
+	cases := []struct {
+		name     string
+		uri      string
+		expected URI
+		err      string
+	}{
+		{
+			name:     "address only",
+			uri:      "skycoin:" + address,
+			expected: URI{Address: address},
+		},
+		{
+			name: "all parameters",
+			uri:  "skycoin:" + address + "?amount=12.5&hours=10&label=rent%20%26%20bills&message=march+2026&foo=bar",
+			expected: URI{
+				Address: address,
+				Coins:   12500000,
+				Hours:   10,
+				Label:   "rent & bills",
+				Message: "march 2026",
+			},
+		},
+		{
+			name:     "authority form and upper case scheme",
+			uri:      " SKYCOIN://" + address + "/?amount=1 ",
+			expected: URI{Address: address, Coins: 1000000},
+		},
+		{
+			name: "other scheme",
+			uri:  "bitcoin:" + address,
+			err:  ErrScheme.Error(),
+		},
+		{
+			name: "invalid address",
+			uri:  "skycoin:2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qw",
+			err:  "invalid address: Invalid checksum",
+		},
+		{
+			name: "too many decimals",
+			uri:  "skycoin:" + address + "?amount=0.0000001",
+			err:  "invalid amount: " + droplet.ErrTooManyDecimals.Error(),
+		},
+		{
+			name: "amount overflow",
+			uri:  "skycoin:" + address + "?amount=10000000000000",
+			err:  "invalid amount: " + droplet.ErrTooLarge.Error(),
+		},
+		{
+			name: "exponent amount",
+			uri:  "skycoin:" + address + "?amount=1e3",
+			err:  `invalid amount "1e3"`,
+		},
+		{
+			name: "negative amount",
+			uri:  "skycoin:" + address + "?amount=-1",
+			err:  `invalid amount "-1"`,
+		},
+		{
+			name: "hours overflow",
+			uri:  "skycoin:" + address + "?hours=18446744073709551616",
+			err:  `invalid hours: strconv.ParseUint: parsing "18446744073709551616": value out of range`,
+		},
+		{
+			name: "repeated parameter",
+			uri:  "skycoin:" + address + "?amount=1&amount=2",
+			err:  "amount is set 2 times",
+		},
+		{
+			name: "required parameter",
+			uri:  "skycoin:" + address + "?req-expires=1",
+			err:  "unsupported required parameter req-expires",
+		},
+		{
+			name: "malformed query",
+			uri:  "skycoin:" + address + "?label=%zz",
+			err:  `invalid query: invalid URL escape "%zz"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := Parse(tc.uri)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u != tc.expected {
+				t.Fatalf("expected %+v, got %+v", tc.expected, u)
+			}
+
+			// the parsed URI encodes to an equivalent URI
+			s, err := u.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again, err := Parse(s); err != nil || again != u {
+				t.Fatalf("%s parsed as %+v: %v", s, again, err)
+			}
+		})
+	}
+}